@@ -1,4 +1,36 @@
 // Nakama Tic-Tac-Toe Web Client
+
+// Match protocol version, sent when joining so the server can reject incompatible clients
+const PROTOCOL_VERSION = 1;
+
+// Opcodes sent by the client
+const ClientOpCode = {
+    MOVE: 1,
+    REQUEST_STATE: 2
+};
+
+// Opcodes sent by the server
+const OpCode = {
+    WELCOME: 1,
+    PLAYER_JOINED: 2,
+    PLAYER_LEFT: 3,
+    GAME_UPDATE: 4,
+    GAME_OVER: 5,
+    ERROR: 6,
+    DRAW: 7,
+    TIMEOUT: 8,
+    TIMER_UPDATE: 9,
+    MATCH_CANCELLED: 10,
+    PHASE_CHANGE: 11,
+    STATE_SYNC: 12,
+    PLAYER_RECONNECTED: 13,
+    MATCH_CLOSED: 14,
+    MATCH_TERMINATING: 15,
+    SERVER_RESTARTING: 16,
+    MOVE_ACK: 17,
+    SPECTATOR_COUNT: 18
+};
+
 class NakamaGame {
     constructor() {
         this.client = null;
@@ -13,6 +45,10 @@ class NakamaGame {
         this.gameEnded = false;
         this.playerList = [];
         this.user_id_opponent = null;
+        this.seq = 0;
+        this.boardVersion = 0;
+        this.stateVersion = 0;
+        this.spectating = false;
 
         this.initializeUI();
     }
@@ -81,6 +117,8 @@ class NakamaGame {
 
         this.leaderboardPanel = document.getElementById('leaderboard-panel');
         this.leaderboardTable = document.getElementById('leaderboard-table');
+        this.liveMatchesTable = document.getElementById('live-matches-table');
+        document.getElementById('open-table-btn').addEventListener('click', () => this.openTable());
 
         // Add event listeners
         this.elements.connectBtn.addEventListener('click', () => this.connect());
@@ -142,11 +180,15 @@ class NakamaGame {
             this.addMessage('success', '🎮 Socket connected! Looking for match...');
 
             this.setupSocketHandlers();
-            await this.startMatchmaking();
+            if (!(await this.offerRestore())) {
+                await this.startMatchmaking();
+            }
 
             // Fetch leaderboard after connecting and run this every ten seconds
             this.fetchLeaderboard();
             setInterval(() => this.fetchLeaderboard(), 10000);
+            this.fetchLiveMatches();
+            setInterval(() => this.fetchLiveMatches(), 10000);
 
         } catch (error) {
             this.updateStatus('disconnected', 'Connection Failed');
@@ -160,9 +202,12 @@ class NakamaGame {
         this.socket.onmatchdata = (matchData) => {
             const opCode = matchData.op_code;
             const data = JSON.parse(new TextDecoder().decode(matchData.data));
+            if (opCode !== OpCode.STATE_SYNC) {
+                this.checkStateVersion(data);
+            }
             
             switch (opCode) {
-                case 1: // Welcome message
+                case OpCode.WELCOME: // Welcome message
                     this.addMessage('game', `💌 ${data.message}`);
                     if (data.game_mode) {
                         this.currentGameMode = data.game_mode;
@@ -171,40 +216,78 @@ class NakamaGame {
                     }
                     break;
                     
-                case 2: // Player joined
+                case OpCode.PLAYER_JOINED: // Player joined
                     this.handlePlayerJoined(data);
                     this.playerList.push(data.user_id);
 
                     break;
                     
-                case 3: // Player left
+                case OpCode.PLAYER_LEFT: // Player left
                     this.addMessage('game', `👋 ${data.message}`);
                     this.playerList = this.playerList.filter(id => id !== data.user_id);
                     break;
                     
-                case 4: // Game update
+                case OpCode.GAME_UPDATE: // Game update
                     this.handleGameUpdate(data);
                     break;
                     
-                case 5: // Game over
+                case OpCode.GAME_OVER: // Game over
                     this.handleGameOver(data);
                     break;
 
-                case 6: // Player error
-                    this.addMessage('error', `❌ Error: ${data.error}`);
+                case OpCode.ERROR: // Player error
+                    this.handlePlayerError(data);
                     break;
 
-                case 7: // Game draw
+                case OpCode.DRAW: // Game draw
                     this.handleGameDraw(data);
                     break;
 
-                case 8: // Timeout win
+                case OpCode.TIMEOUT: // Timeout win
                     this.handleTimeoutWin(data);
                     break;
 
-                case 9: // Timer update
+                case OpCode.TIMER_UPDATE: // Timer update
                     this.handleTimerUpdate(data);
                     break;
+
+                case OpCode.MATCH_CANCELLED: // Match cancelled
+                    this.handleMatchCancelled(data);
+                    break;
+
+                case OpCode.PHASE_CHANGE: // Phase change
+                    this.handlePhaseChange(data);
+                    break;
+
+                case OpCode.STATE_SYNC: // Full state sync
+                    this.handleStateSync(data);
+                    break;
+
+                case OpCode.PLAYER_RECONNECTED: // Player reconnected
+                    this.addMessage('game', `🔁 ${data.username || data.user_id} reconnected`);
+                    break;
+
+                case OpCode.MATCH_CLOSED: // Final results, match closed
+                    this.addMessage('info', `🏁 ${data.message} (${data.end_reason})`);
+                    this.elements.newGameBtn.classList.remove('hidden');
+                    break;
+
+                case OpCode.MATCH_TERMINATING: // Match terminating
+                    this.addMessage('error', `🛑 ${data.message} in ${data.grace_seconds}s`);
+                    this.elements.newGameBtn.classList.remove('hidden');
+                    break;
+
+                case OpCode.SERVER_RESTARTING: // Server restarting
+                    this.addMessage('error', `🔧 ${data.message}` + (data.restorable ? ' - you can restore this game when it is back' : ''));
+                    break;
+
+                case OpCode.MOVE_ACK: // Move acknowledged
+                    this.boardVersion = Math.max(this.boardVersion, data.version);
+                    break;
+
+                case OpCode.SPECTATOR_COUNT: // Spectators joined or left
+                    this.addMessage('info', `👀 ${data.count} watching`);
+                    break;
                     
                 default:
                     this.addMessage('info', `🔍 Unknown message: ${JSON.stringify(data)}`);
@@ -215,7 +298,7 @@ class NakamaGame {
         this.socket.onmatchmakermatched = async (matched) => {
             try {
                 this.addMessage('success', `🎯 Match found! Joining match...`);
-                const match = await this.socket.joinMatch(matched.match_id, matched.token);
+                const match = await this.socket.joinMatch(matched.match_id, matched.token, this.joinMetadata());
                 this.matchId = match.match_id;
                 this.addMessage('success', `🏆 Joined match: ${this.matchId}`);
                 this.updateStatus('connected', 'In Match');
@@ -227,6 +310,14 @@ class NakamaGame {
             }
         };
 
+        // Handle notifications, an opponent restoring an interrupted game invites us to it
+        this.socket.onnotification = async (notification) => {
+            if (notification.code === 102 && notification.content && notification.content.match_id) {
+                this.addMessage('success', `♻️ ${notification.subject}`);
+                await this.joinRestoredMatch(notification.content.match_id);
+            }
+        };
+
         // Handle disconnection
         this.socket.ondisconnect = () => {
             this.updateStatus('disconnected', 'Disconnected');
@@ -235,6 +326,88 @@ class NakamaGame {
         };
     }
 
+    async offerRestore() {
+        try {
+            const rpcResponse = await this.client.rpc(this.session, 'ListRestorableMatches', {});
+            const snapshots = rpcResponse.payload || [];
+            if (snapshots.length === 0) {
+                return false;
+            }
+            const snapshot = snapshots[0];
+            if (!window.confirm(`Your ${snapshot.game_mode} game was interrupted by a server restart. Restore it?`)) {
+                return false;
+            }
+            const restoreResponse = await this.client.rpc(this.session, 'RestoreMatch', { match_id: snapshot.match_id });
+            await this.joinRestoredMatch(restoreResponse.payload.match_id);
+            return true;
+        } catch (error) {
+            this.addMessage('error', `❌ Restore failed: ${error.message}`);
+            return false;
+        }
+    }
+
+    async joinRestoredMatch(matchId) {
+        const match = await this.socket.joinMatch(matchId, undefined, this.joinMetadata());
+        this.matchId = match.match_id;
+        this.addMessage('success', `♻️ Rejoined restored game: ${this.matchId}`);
+        this.updateStatus('connected', 'In Match');
+        this.showGameUI();
+    }
+
+    // A state version more than one ahead of ours means a broadcast was missed
+    checkStateVersion(data) {
+        if (data.state_version === undefined) {
+            return;
+        }
+        if (data.state_version > this.stateVersion + 1) {
+            this.requestState();
+        }
+        this.stateVersion = Math.max(this.stateVersion, data.state_version);
+    }
+
+    async requestState() {
+        if (!this.matchId) {
+            return;
+        }
+        try {
+            await this.socket.sendMatchState(this.matchId, ClientOpCode.REQUEST_STATE, "");
+        } catch (error) {
+            console.error('State request failed:', error);
+        }
+    }
+
+    async joinOpenMatch(matchId) {
+        const match = await this.socket.joinMatch(matchId, undefined, this.joinMetadata());
+        this.matchId = match.match_id;
+        this.addMessage('success', `🪑 Joined open table: ${this.matchId}`);
+        this.updateStatus('connected', 'In Match');
+        this.showGameUI();
+    }
+
+    // Open a table anyone can sit down at, then take the first seat
+    async openTable() {
+        if (!this.client || !this.session || this.matchId) return;
+        try {
+            const response = await this.client.rpc(this.session, 'CreateOpenMatch', { mode: this.selectedGameMode });
+            await this.joinOpenMatch(response.payload.match_id);
+        } catch (error) {
+            this.addMessage('error', `❌ Could not open a table: ${error.message}`);
+        }
+    }
+
+    async spectateMatch(matchId) {
+        const match = await this.socket.joinMatch(matchId, undefined, this.joinMetadata('spectator'));
+        this.matchId = match.match_id;
+        this.spectating = true;
+        this.addMessage('success', `👀 Watching match: ${this.matchId}`);
+        this.updateStatus('connected', 'Spectating');
+        this.showGameUI();
+    }
+
+    joinMetadata(role = 'player') {
+        return { protocol_version: String(PROTOCOL_VERSION), role };
+    }
+
     async startMatchmaking() {
         try {
             this.updateStatus('matching', 'Finding match...');
@@ -257,6 +430,20 @@ class NakamaGame {
         }
     }
 
+    handlePlayerError(data) {
+        if (data.board_version !== undefined) {
+            this.boardVersion = data.board_version;
+        }
+        if (data.last_seq !== undefined) {
+            this.seq = Math.max(this.seq, data.last_seq);
+        }
+        // A resend of a move the server already applied needs no attention
+        if (data.code === 'duplicate_action') {
+            return;
+        }
+        this.addMessage('error', `❌ Error: ${data.error}`);
+    }
+
     handlePlayerJoined(data) {
         this.addMessage('game', `👤 ${data.username || data.user_id} joined the game!`);
         
@@ -277,6 +464,10 @@ class NakamaGame {
         if (data.board_state) {
             this.updateBoard(data.board_state);
         }
+
+        if (data.board_version !== undefined) {
+            this.boardVersion = data.board_version;
+        }
         
         if (this.playerCount === 2) {
             // Find opponent username
@@ -294,6 +485,10 @@ class NakamaGame {
         if (data.board_state) {
             this.updateBoard(data.board_state);
         }
+
+        if (data.board_version !== undefined) {
+            this.boardVersion = data.board_version;
+        }
         
         if (data.current_turn) {
             this.currentTurn = data.current_turn;
@@ -383,6 +578,54 @@ class NakamaGame {
         });
     }
 
+    handleMatchCancelled(data) {
+        this.elements.newGameBtn.classList.remove('hidden');
+        this.gameEnded = true;
+        this.addMessage('error', `🚫 ${data.message}`);
+        this.elements.gameState.textContent = `Cancelled - ${data.message}`;
+        this.hideTimer();
+    }
+
+    handlePhaseChange(data) {
+        this.matchPhase = data.phase;
+        if (data.phase === 'playing') {
+            this.addMessage('game', '▶️ Match is live');
+        }
+    }
+
+    handleStateSync(data) {
+        this.mySymbol = data.symbol || "";
+        this.elements.mySymbol.textContent = this.mySymbol || "-";
+        this.playerCount = data.total_players;
+        this.elements.playerCount.textContent = this.playerCount;
+        this.matchPhase = data.phase;
+        this.gameEnded = data.game_ended;
+        this.spectating = !!data.spectating;
+
+        const opponentName = document.getElementById('opponent-name');
+        if (opponentName && data.opponent) {
+            opponentName.textContent = data.opponent;
+        }
+
+        if (data.game_mode) {
+            this.currentGameMode = data.game_mode;
+            this.elements.currentGameMode.textContent = data.game_mode;
+            this.showTimerIfNeeded(data.game_mode);
+        }
+
+        this.currentTurn = data.current_turn;
+        this.boardVersion = data.board_version;
+        this.stateVersion = data.state_version;
+        this.seq = Math.max(this.seq, data.last_seq || 0);
+        this.updateTurnDisplay();
+        this.updateBoard(data.board_state);
+
+        if (data.time_remaining !== undefined && this.currentGameMode === 'timed') {
+            this.updateTimer(data.time_remaining);
+        }
+        this.addMessage('info', '🔄 Game state synchronised');
+    }
+
     handleTimerUpdate(data) {
         if (this.currentGameMode === 'timed') {
             // this.addMessage('server', `Server time remaining: ${data.time_remaining}s`);
@@ -463,8 +706,8 @@ class NakamaGame {
         }
         
         try {
-            const moveData = { row, col };
-            await this.socket.sendMatchState(this.matchId, 1, JSON.stringify(moveData));
+            const moveData = { seq: ++this.seq, version: this.boardVersion, row, col };
+            await this.socket.sendMatchState(this.matchId, ClientOpCode.MOVE, JSON.stringify(moveData));
             this.addMessage('info', `📤 Move sent: ${this.mySymbol} to (${row}, ${col})`);
             
         } catch (error) {
@@ -491,6 +734,10 @@ class NakamaGame {
         this.gameBoard = Array(9).fill("");
         this.isMyTurn = false;
         this.gameEnded = false;
+        this.seq = 0;
+        this.boardVersion = 0;
+        this.stateVersion = 0;
+        this.spectating = false;
         
         // Reset UI
         this.elements.mySymbol.textContent = "-";
@@ -561,24 +808,31 @@ class NakamaGame {
         try {
             // Call the custom RPC to get top N players
             const n = 10;
-            const rpcResponse = await this.client.rpc(this.session, 'GetTopPlayers', JSON.stringify({ n }));
-            const players = rpcResponse.payload || [];
-            this.renderLeaderboard(players);
+            const rpcResponse = await this.client.rpc(this.session, 'GetTopPlayers', { n });
+            const page = rpcResponse.payload || {};
+            this.renderLeaderboard(page.records || [], page.me);
         } catch (error) {
             this.renderEmptyLeaderboard();
         }
     }
 
-    renderLeaderboard(players) {
+    renderLeaderboard(players, me) {
         if (!this.leaderboardTable) return;
         const tbody = this.leaderboardTable.querySelector('tbody');
         tbody.innerHTML = '';
 
-        players.forEach((player, idx) => {
+        const addRow = (player) => {
             const tr = document.createElement('tr');
-            tr.innerHTML = `<td>${idx + 1}</td><td>${player.username || player.owner_id}</td><td>${player.score}</td><td>${player.symbol}</td><td>${player.mode}</td>`;
+            tr.innerHTML = `<td>${player.rank}</td><td>${player.username || player.owner_id}</td><td>${player.score}</td><td>${player.symbol || ''}</td><td>${player.mode || ''}</td>`;
             tbody.appendChild(tr);
-        });
+            return tr;
+        };
+        players.forEach(addRow);
+
+        // Show our own rank below the top players when we are not among them
+        if (me && !players.some(player => player.owner_id === me.owner_id)) {
+            addRow(me).style.fontWeight = 'bold';
+        }
     }
 
     renderEmptyLeaderboard() {
@@ -586,6 +840,40 @@ class NakamaGame {
         const tbody = this.leaderboardTable.querySelector('tbody');
         tbody.innerHTML = '<tr><td colspan="3" style="text-align:center;">No scores yet - play some games!</td></tr>';
     }
+
+    async fetchLiveMatches() {
+        if (!this.client || !this.session) return;
+        try {
+            const live = await this.client.rpc(this.session, 'ListLiveMatches', { kind: 'live' });
+            const open = await this.client.rpc(this.session, 'ListLiveMatches', { kind: 'open' });
+            this.renderLiveMatches([...(open.payload || []), ...(live.payload || [])]);
+        } catch (error) {
+            this.renderLiveMatches([]);
+        }
+    }
+
+    renderLiveMatches(matches) {
+        if (!this.liveMatchesTable) return;
+        const tbody = this.liveMatchesTable.querySelector('tbody');
+        tbody.innerHTML = '';
+
+        if (matches.length === 0) {
+            tbody.innerHTML = '<tr><td colspan="5" style="text-align:center;">No live games right now</td></tr>';
+            return;
+        }
+
+        matches.forEach((match) => {
+            const label = match.label;
+            const open = label.open === 1;
+            const tr = document.createElement('tr');
+            tr.innerHTML = `<td>${label.mode}</td><td>${label.players}/2</td><td>${label.rating}</td><td>${label.spectators}</td><td><button>${open ? 'Join' : 'Watch'}</button></td>`;
+            tr.querySelector('button').addEventListener('click', () => {
+                if (this.matchId) return;
+                open ? this.joinOpenMatch(match.match_id) : this.spectateMatch(match.match_id);
+            });
+            tbody.appendChild(tr);
+        });
+    }
 }
 
 // Initialize the game when the page loads
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"tictac/rules"
+)
+
+const (
+	// arenaStreakWins is how many wins in a row put a player on a streak, where every game scores double
+	arenaStreakWins = 2
+	// arenaRematchWaitSec is how long a player waits before being paired with their last opponent again
+	arenaRematchWaitSec = 10
+	// arenaMaxGameSec is how long an arena game may be played before it is decided by perfect play
+	arenaMaxGameSec = 300
+)
+
+// arenaGraceSec is how long the event runs on after the arena closes, enough for a game paired just before:
+// the players' time to join, then the longest an arena game may be played
+func arenaGraceSec(noShowSec int) int64 {
+	return int64(noShowSec + arenaMaxGameSec)
+}
+
+// ArenaPlayer is an entrant's record in an arena
+type ArenaPlayer struct {
+	UserId       string `json:"user_id"`
+	Score        int64  `json:"score"`
+	Streak       int    `json:"streak"` // wins in a row
+	Games        int    `json:"games"`
+	Wins         int    `json:"wins"`
+	Draws        int    `json:"draws"`
+	Losses       int    `json:"losses"`
+	GamesAsX     int    `json:"games_as_x"`
+	LastOpponent string `json:"last_opponent,omitempty"`
+	MatchId      string `json:"match_id,omitempty"`      // game being played
+	WaitingSince int64  `json:"waiting_since,omitempty"` // unix time the player was queued, 0 if not waiting
+	Paused       bool   `json:"paused"`                  // missed a game, not paired until they join again
+}
+
+// ArenaGame is a game in progress in an arena
+type ArenaGame struct {
+	Number  int    `json:"number"`
+	MatchId string `json:"match_id"`
+	PlayerX string `json:"player_x"`
+	PlayerO string `json:"player_o"`
+}
+
+// Arena runs for a fixed time in which every free player is paired again as soon as their game ends.
+// Wins score 2 and draws 1, doubled while a player is on a streak.
+type Arena struct {
+	ClosesAt int64          `json:"closes_at"` // unix time after which no new games are paired
+	Players  []*ArenaPlayer `json:"players"`
+	Active   []*ArenaGame   `json:"active"`
+	Played   int            `json:"played"` // games created so far, numbers the next game
+	// EndPending is set when the event ended with games still in progress, rewards are paid once the last is in
+	EndPending bool `json:"end_pending,omitempty"`
+}
+
+// player returns the arena record of a user, or nil
+func (a *Arena) player(userId string) *ArenaPlayer {
+	for _, p := range a.Players {
+		if p.UserId == userId {
+			return p
+		}
+	}
+	return nil
+}
+
+// enqueue adds an entrant to the arena, or puts a paused one back in the queue
+func (a *Arena) enqueue(d *directorContext, userId string) string {
+	p := a.player(userId)
+	if p == nil {
+		p = &ArenaPlayer{UserId: userId}
+		a.Players = append(a.Players, p)
+	}
+	if p.MatchId != "" {
+		return "already playing"
+	}
+	p.Paused = false
+	if p.WaitingSince == 0 {
+		p.WaitingSince = d.now
+	}
+	d.changed()
+	return ""
+}
+
+// start queues everyone who signed up before the arena opened
+func (a *Arena) start(d *directorContext) error {
+	for _, e := range d.state.Entrants {
+		a.enqueue(d, e.UserId)
+	}
+	return nil
+}
+
+// tick pairs waiting players until the arena closes, then finishes once the last game is in.
+// Nothing is paired after the close, and the grace that follows covers the longest game, so every game counts.
+func (a *Arena) tick(d *directorContext) {
+	if d.now >= a.ClosesAt {
+		for _, p := range a.Players {
+			if p.WaitingSince != 0 {
+				p.WaitingSince = 0
+				d.changed()
+			}
+		}
+		if len(a.Active) == 0 && d.state.Status == TournamentRunning {
+			d.state.Status = TournamentFinished
+			d.changed()
+			d.logger.Info("=== TOURNAMENT FINISHED === arena %s after %d games", d.state.Id, a.Played)
+		}
+		return
+	}
+
+	// Pair down the waiting players by score, so opponents are as close in score as the queue allows
+	var waiting []*ArenaPlayer
+	for _, p := range a.Players {
+		if p.WaitingSince != 0 && !p.Paused && p.MatchId == "" {
+			waiting = append(waiting, p)
+		}
+	}
+	sort.SliceStable(waiting, func(i, j int) bool { return waiting[i].Score > waiting[j].Score })
+
+	for len(waiting) >= 2 {
+		first, opponent := waiting[0], 1
+		if waiting[1].UserId == first.LastOpponent && first.LastOpponent != "" {
+			switch {
+			case len(waiting) > 2:
+				opponent = 2
+			case d.now-first.WaitingSince < arenaRematchWaitSec:
+				// Give someone else a moment to turn up before a straight rematch
+				return
+			}
+		}
+		second := waiting[opponent]
+		waiting = append(waiting[1:opponent], waiting[opponent+1:]...)
+		a.pair(d, first, second)
+	}
+}
+
+// pair starts a game between two waiting players, X going to whoever has had it less
+func (a *Arena) pair(d *directorContext, first, second *ArenaPlayer) {
+	x, o := first, second
+	if second.GamesAsX*2-second.Games < first.GamesAsX*2-first.Games {
+		x, o = second, first
+	}
+
+	ref := &TournamentRef{Id: d.state.Id, Kind: FormatArena, Game: a.Played}
+	matchId, err := d.createGame(ref, x.UserId, o.UserId, map[string]string{x.UserId: "X", o.UserId: "O"})
+	if err != nil {
+		return // both stay queued and are tried again next tick
+	}
+	a.Played++
+	a.Active = append(a.Active, &ArenaGame{Number: ref.Game, MatchId: matchId, PlayerX: x.UserId, PlayerO: o.UserId})
+	for _, p := range []*ArenaPlayer{x, o} {
+		p.MatchId = matchId
+		p.WaitingSince = 0
+	}
+	x.LastOpponent, o.LastOpponent = o.UserId, x.UserId
+	d.changed()
+}
+
+// result scores a finished arena game and queues both players again. A player who never joined scores nothing
+// and is paused until they join again. Their opponent scores nothing either and keeps their streak as it was,
+// so a game nobody played cannot be farmed for points.
+func (a *Arena) result(d *directorContext, record *MatchRecord) {
+	index := -1
+	for i, game := range a.Active {
+		if game.MatchId == record.MatchId {
+			index = i
+		}
+	}
+	if index < 0 {
+		d.logger.Warn("Ignoring result of %s, not an active arena game", record.MatchId)
+		return
+	}
+	game := a.Active[index]
+	a.Active = append(a.Active[:index], a.Active[index+1:]...)
+	d.changed()
+
+	present := map[string]bool{}
+	for _, p := range record.Players {
+		present[p.UserId] = true
+	}
+
+	for _, side := range [][2]string{{game.PlayerX, game.PlayerO}, {game.PlayerO, game.PlayerX}} {
+		p := a.player(side[0])
+		if p == nil {
+			continue
+		}
+		p.MatchId = ""
+		noShow := !present[side[0]] && record.StartedAt == 0
+		opponentNoShow := !present[side[1]] && record.StartedAt == 0
+
+		switch {
+		case noShow:
+			p.Paused = true
+			p.Streak = 0
+		case opponentNoShow:
+			// Not a game, the player is queued again with their score and streak untouched
+		case record.Winner == p.UserId:
+			a.score(p, 2, true, side[0] == game.PlayerX)
+		case record.Winner != "":
+			a.score(p, 0, false, side[0] == game.PlayerX)
+			p.Losses++
+		case record.EndReason == rules.EndReasonDraw || record.EndReason == rules.EndReasonAdjudicated:
+			a.score(p, 1, false, side[0] == game.PlayerX)
+			p.Draws++
+		}
+
+		if !p.Paused && d.now < a.ClosesAt {
+			p.WaitingSince = d.now
+		}
+		d.recordScore(p.UserId, p.Score, int64(p.Wins))
+	}
+	d.logger.Info("Arena game %d of %s ended %s, winner: %q", game.Number, d.state.Id, record.EndReason, record.Winner)
+}
+
+// score adds a played game to a player's record, doubling the points while they are on a streak
+func (a *Arena) score(p *ArenaPlayer, points int64, won, asX bool) {
+	if p.Streak >= arenaStreakWins {
+		points *= 2
+	}
+	p.Score += points
+	p.Games++
+	if asX {
+		p.GamesAsX++
+	}
+	if won {
+		p.Wins++
+		p.Streak++
+	} else {
+		p.Streak = 0
+	}
+}
+
+// standings orders players by score, then by wins
+func (a *Arena) standings(t *TournamentState) []*TournamentStanding {
+	players := append([]*ArenaPlayer(nil), a.Players...)
+	sort.SliceStable(players, func(i, j int) bool {
+		if players[i].Score != players[j].Score {
+			return players[i].Score > players[j].Score
+		}
+		return players[i].Wins > players[j].Wins
+	})
+
+	standings := make([]*TournamentStanding, 0, len(players))
+	for i, p := range players {
+		standing := &TournamentStanding{Place: i + 1, UserId: p.UserId, Points: float64(p.Score), Streak: p.Streak}
+		if e := t.entrant(p.UserId); e != nil {
+			standing.Username = e.Username
+		}
+		if i > 0 && players[i-1].Score == p.Score && players[i-1].Wins == p.Wins {
+			standing.Place = standings[i-1].Place
+		}
+		standings = append(standings, standing)
+	}
+	return standings
+}
+
+// placings returns the places of the standings, players who never finished a game are not placed
+func (a *Arena) placings(t *TournamentState) map[string]int {
+	placings := map[string]int{}
+	for _, standing := range a.standings(t) {
+		if p := a.player(standing.UserId); p != nil && p.Games > 0 {
+			placings[standing.UserId] = standing.Place
+		}
+	}
+	return placings
+}
+
+// newArenaStandingsMessage describes the arena as it is now
+func newArenaStandingsMessage(t *TournamentState) *ArenaStandingsMessage {
+	return &ArenaStandingsMessage{
+		TournamentId: t.Id,
+		Status:       t.Status,
+		ClosesAt:     t.Arena.ClosesAt,
+		Games:        len(t.Arena.Active),
+		Standings:    t.Arena.standings(t),
+	}
+}
+
+// rpcCreateArenaTournament is the server to server RPC creating an arena. The arena opens when signup ends
+// and runs for duration_seconds, players may join until it closes.
+func rpcCreateArenaTournament(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if userId, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string); userId != "" {
+		return "", errPermissionDenied
+	}
+
+	req, err := parseCreateTournamentRequest(payload)
+	if err != nil {
+		return "", err
+	}
+	state, err := createTournament(ctx, logger, nk, FormatArena, req, systemClock{}.Now().Unix())
+	if err != nil {
+		return "", err
+	}
+
+	respBytes, _ := json.Marshal(state)
+	return string(respBytes), nil
+}
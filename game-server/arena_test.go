@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"tictac/rules"
+)
+
+// directorNakama is what an arena director talks to: storage, matches, notifications, wallets and tournament records
+type directorNakama struct {
+	testNakama
+	matches  int
+	params   []map[string]interface{} // params of every match created
+	payments map[string]int64
+}
+
+func (nk *directorNakama) MatchCreate(ctx context.Context, module string, params map[string]interface{}) (string, error) {
+	nk.matches++
+	nk.params = append(nk.params, params)
+	return fmt.Sprintf("game-%d.node", nk.matches), nil
+}
+
+func (nk *directorNakama) NotificationSend(ctx context.Context, userID, subject string, content map[string]interface{}, code int, sender string, persistent bool) error {
+	return nil
+}
+
+func (nk *directorNakama) TournamentRecordWrite(ctx context.Context, id, ownerID, username string, score, subscore int64, metadata map[string]interface{}, operatorOverride *int) (*api.LeaderboardRecord, error) {
+	return &api.LeaderboardRecord{LeaderboardId: id, OwnerId: ownerID, Score: score}, nil
+}
+
+func (nk *directorNakama) WalletUpdate(ctx context.Context, userID string, changeset map[string]int64, metadata map[string]interface{}, updateLedger bool) (map[string]int64, map[string]int64, error) {
+	nk.payments[userID] += changeset["coins"]
+	return nil, nil, nil
+}
+
+// arenaHarness runs a tournament director for an arena that is already open
+type arenaHarness struct {
+	t          *testing.T
+	ctx        context.Context
+	director   *TournamentDirector
+	clock      *fakeClock
+	nk         *directorNakama
+	dispatcher *testDispatcher
+	ds         *DirectorState
+	stopped    bool
+}
+
+func newArenaHarness(t *testing.T, players ...string) *arenaHarness {
+	h := &arenaHarness{
+		t:          t,
+		ctx:        context.Background(),
+		clock:      &fakeClock{now: time.Unix(1700000000, 0)},
+		nk:         &directorNakama{payments: map[string]int64{}},
+		dispatcher: &testDispatcher{},
+	}
+	h.director = &TournamentDirector{clock: h.clock}
+	state := &TournamentState{
+		Id:           "arena-1",
+		Format:       FormatArena,
+		Mode:         GameModeClassic,
+		Status:       TournamentSignup,
+		SignupEndsAt: h.clock.Now().Unix(),
+		EndsAt:       h.clock.Now().Unix() + 600 + arenaGraceSec(120),
+		MaxSize:      64,
+		NoShowSec:    120,
+		Rewards:      []int64{100, 50},
+		Arena:        &Arena{ClosesAt: h.clock.Now().Unix() + 600},
+	}
+	for _, userId := range players {
+		state.Entrants = append(state.Entrants, &TournamentEntrant{UserId: userId, Username: userId})
+	}
+	h.ds = &DirectorState{Tournament: state, InitialStatus: TournamentSignup, Encodings: make(map[string]Encoding)}
+	h.tick()
+	if state.Status != TournamentRunning {
+		t.Fatalf("arena status after signup = %s, want %s", state.Status, TournamentRunning)
+	}
+	return h
+}
+
+// tick runs the director loop once
+func (h *arenaHarness) tick() {
+	if h.director.MatchLoop(h.ctx, testLogger{}, nil, h.nk, h.dispatcher, 0, h.ds, nil) == nil {
+		h.stopped = true
+	}
+}
+
+// signal sends the director a signal and fails the test if it is refused
+func (h *arenaHarness) signal(signal *TournamentSignal) {
+	signalBytes, _ := json.Marshal(signal)
+	_, data := h.director.MatchSignal(h.ctx, testLogger{}, nil, h.nk, h.dispatcher, 0, h.ds, string(signalBytes))
+	var reply tournamentSignalReply
+	if err := json.Unmarshal([]byte(data), &reply); err != nil || reply.Error != "" {
+		h.t.Fatalf("signal %s refused: %s %v", signal.Type, reply.Error, err)
+	}
+}
+
+// finish reports a game of the arena as played to the end
+func (h *arenaHarness) finish(game *ArenaGame, winner string) {
+	reason := rules.EndReasonWin
+	if winner == "" {
+		reason = rules.EndReasonDraw
+	}
+	h.signal(&TournamentSignal{Type: "result", Record: &MatchRecord{
+		MatchId:    game.MatchId,
+		Players:    []MatchRecordPlayer{{UserId: game.PlayerX, Symbol: "X"}, {UserId: game.PlayerO, Symbol: "O"}},
+		Winner:     winner,
+		EndReason:  reason,
+		Tournament: &TournamentRef{Id: "arena-1", Kind: FormatArena, Game: game.Number},
+		StartedAt:  h.clock.Now().Unix(),
+	}})
+}
+
+func TestArenaGraceCoversTheLongestGame(t *testing.T) {
+	h := newArenaHarness(t, "alice", "bob")
+	params := h.nk.params[len(h.nk.params)-1]
+	if params["max_game_seconds"] != float64(arenaMaxGameSec) {
+		t.Fatalf("arena game params = %v, want max_game_seconds %d", params, arenaMaxGameSec)
+	}
+	if longest := int64(120 + arenaMaxGameSec); arenaGraceSec(120) < longest {
+		t.Errorf("grace = %ds, shorter than a game can take (%ds)", arenaGraceSec(120), longest)
+	}
+}
+
+func TestArenaEndWaitsForGamesInProgress(t *testing.T) {
+	h := newArenaHarness(t, "alice", "bob")
+	arena := h.ds.Tournament.Arena
+	if len(arena.Active) != 1 {
+		t.Fatalf("%d games paired, want 1", len(arena.Active))
+	}
+	game := arena.Active[0]
+
+	// The arena closes and the event ends while the game is still being played
+	h.clock.Advance(time.Hour)
+	h.tick()
+	h.signal(&TournamentSignal{Type: "end"})
+	if h.ds.Tournament.Status == TournamentEnded || !arena.EndPending || len(h.nk.payments) != 0 {
+		t.Fatalf("status %s, end pending %v, %d paid: the end must wait for the game", h.ds.Tournament.Status, arena.EndPending, len(h.nk.payments))
+	}
+	h.tick()
+	if h.stopped {
+		t.Fatal("director stopped with a game in progress")
+	}
+
+	h.finish(game, game.PlayerO)
+	h.tick()
+	if h.ds.Tournament.Status != TournamentEnded || !h.stopped {
+		t.Fatalf("status %s, director stopped %v after the last game, want ended", h.ds.Tournament.Status, h.stopped)
+	}
+	if h.nk.payments[game.PlayerO] != 100 || h.nk.payments[game.PlayerX] != 50 {
+		t.Errorf("payments = %v, want 100 to the winner of the late game and 50 to the loser", h.nk.payments)
+	}
+	if n := h.nk.matches; n != 1 {
+		t.Errorf("%d games created, want none after the close", n)
+	}
+}
+
+func TestArenaEndsAtOnceWithoutGamesInProgress(t *testing.T) {
+	h := newArenaHarness(t, "alice", "bob")
+	game := h.ds.Tournament.Arena.Active[0]
+	h.finish(game, game.PlayerX)
+
+	h.clock.Advance(time.Hour)
+	h.tick()
+	h.signal(&TournamentSignal{Type: "end"})
+	if h.ds.Tournament.Status != TournamentEnded || h.nk.payments[game.PlayerX] != 100 {
+		t.Errorf("status %s, payments %v, want the arena ended and paid", h.ds.Tournament.Status, h.nk.payments)
+	}
+}
+
+func TestArenaNoShowScoresNothing(t *testing.T) {
+	h := newArenaHarness(t, "alice", "bob")
+	arena := h.ds.Tournament.Arena
+	game := arena.Active[0]
+	present := arena.player(game.PlayerX)
+	present.Streak, present.Score = arenaStreakWins, 6
+
+	// The match was cancelled with only one player in it
+	h.signal(&TournamentSignal{Type: "result", Record: &MatchRecord{
+		MatchId:    game.MatchId,
+		Players:    []MatchRecordPlayer{{UserId: game.PlayerX, Symbol: "X"}},
+		Winner:     game.PlayerX,
+		EndReason:  rules.EndReasonCancelled,
+		Tournament: &TournamentRef{Id: "arena-1", Kind: FormatArena, Game: game.Number},
+	}})
+
+	if present.Score != 6 || present.Streak != arenaStreakWins || present.Games != 0 || present.Wins != 0 {
+		t.Errorf("player left alone has score %d, streak %d, %d games, %d wins; want 6, %d, 0, 0",
+			present.Score, present.Streak, present.Games, present.Wins, arenaStreakWins)
+	}
+	if present.WaitingSince == 0 || present.Paused {
+		t.Errorf("player left alone is not queued again: waiting since %d, paused %v", present.WaitingSince, present.Paused)
+	}
+	if absent := arena.player(game.PlayerO); !absent.Paused || absent.Score != 0 {
+		t.Errorf("player who never joined: paused %v with score %d, want paused with 0", absent.Paused, absent.Score)
+	}
+	if _, placed := arena.placings(h.ds.Tournament)[game.PlayerX]; placed {
+		t.Error("a player whose only game was a no-show is placed")
+	}
+}
+
+func TestArenaStreakDoublesPoints(t *testing.T) {
+	h := newArenaHarness(t, "alice", "bob")
+	arena := h.ds.Tournament.Arena
+	alice := arena.player("alice")
+
+	for i, want := range []int64{2, 4, 8, 12} {
+		if len(arena.Active) != 1 {
+			t.Fatalf("%d games paired before game %d, want 1", len(arena.Active), i+1)
+		}
+		h.finish(arena.Active[0], "alice")
+		if alice.Score != want {
+			t.Fatalf("score after %d wins = %d, want %d", i+1, alice.Score, want)
+		}
+		// Only the two of them are left, so the rematch waits a moment for someone else
+		h.clock.Advance(arenaRematchWaitSec * time.Second)
+		h.tick()
+	}
+	if bob := arena.player("bob"); bob.Score != 0 || bob.Losses != 4 {
+		t.Errorf("bob has score %d with %d losses, want 0 with 4", bob.Score, bob.Losses)
+	}
+
+	// A draw breaks the streak and scores single points again
+	h.finish(arena.Active[0], "")
+	if alice.Score != 14 || alice.Streak != 0 {
+		t.Errorf("after a draw alice has score %d on a streak of %d, want 14 and 0", alice.Score, alice.Streak)
+	}
+}
+
+func TestArenaGamesTakeTheSpectatorDelay(t *testing.T) {
+	h := newArenaHarness(t, "alice", "bob")
+	moves, sec := 2, 15
+	h.ds.Tournament.SpectatorDelay = SpectatorDelay{Moves: &moves, Sec: &sec}
+
+	h.finish(h.ds.Tournament.Arena.Active[0], "alice")
+	h.clock.Advance(arenaRematchWaitSec * time.Second)
+	h.tick()
+	if len(h.nk.params) != 2 {
+		t.Fatalf("%d games created, want a rematch", len(h.nk.params))
+	}
+
+	m := NewMatchWithMode(GameModeClassic, defaultMatchConfig())
+	state, _, _ := m.MatchInit(h.ctx, testLogger{}, nil, &testNakama{}, h.nk.params[1])
+	matchState := state.(*MatchState)
+	if matchState.SpectatorDelayMoves != moves || matchState.SpectatorDelaySec != sec {
+		t.Errorf("game delays spectators %d moves and %ds, want %d and %ds", matchState.SpectatorDelayMoves, matchState.SpectatorDelaySec, moves, sec)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math/bits"
+	"sort"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// bracketMaxGames is how many games a bracket pairing may take before drawn games are settled by seed
+const bracketMaxGames = 3
+
+// How a bracket game was decided
+const (
+	BracketResultPlayed = "played"  // a player won the game
+	BracketResultBye    = "bye"     // there was no opponent
+	BracketResultNoShow = "no_show" // the opponent never joined
+	BracketResultSeed   = "seed"    // every game was drawn, the better seed goes through
+	BracketResultVoid   = "void"    // neither player joined or was left, nobody goes through
+)
+
+// BracketGame is one pairing of a single elimination bracket
+type BracketGame struct {
+	Round   int    `json:"round"`
+	Index   int    `json:"index"`
+	PlayerA string `json:"player_a,omitempty"` // empty for a bye
+	PlayerB string `json:"player_b,omitempty"`
+	MatchId string `json:"match_id,omitempty"` // game being played, cleared to replay a drawn or void game
+	Games   int    `json:"games"`              // games played so far, including draws and void games
+	Decided bool   `json:"decided"`
+	Winner  string `json:"winner,omitempty"`
+	Result  string `json:"result,omitempty"`
+}
+
+// Bracket is a single elimination bracket seeded by rating, the winner of game i plays on in game i/2 of the next round
+type Bracket struct {
+	Size     int              `json:"size"` // slots in the first round, a power of two
+	Rounds   [][]*BracketGame `json:"rounds"`
+	Champion string           `json:"champion,omitempty"`
+}
+
+// bracketSeedOrder returns the seeds of the first round slots in order, so that the top seeds meet as late as possible
+func bracketSeedOrder(size int) []int {
+	order := []int{1}
+	for n := 2; n <= size; n *= 2 {
+		next := make([]int, 0, n)
+		for _, seed := range order {
+			next = append(next, seed, n+1-seed)
+		}
+		order = next
+	}
+	return order
+}
+
+// start seeds the entrants by rating and lays out every round. Missing players in the first round are byes,
+// which go to the top seeds.
+func (b *Bracket) start(d *directorContext) error {
+	t := d.state
+	entrants := append([]*TournamentEntrant(nil), t.Entrants...)
+	// Earlier signups win ties
+	sort.SliceStable(entrants, func(i, j int) bool { return entrants[i].Rating > entrants[j].Rating })
+	for i, e := range entrants {
+		e.Seed = i + 1
+	}
+
+	b.Size = 2
+	for b.Size < len(entrants) {
+		b.Size *= 2
+	}
+	b.Rounds = nil
+	for games := b.Size / 2; games >= 1; games /= 2 {
+		round := make([]*BracketGame, games)
+		for i := range round {
+			round[i] = &BracketGame{Round: len(b.Rounds), Index: i}
+		}
+		b.Rounds = append(b.Rounds, round)
+	}
+
+	order := bracketSeedOrder(b.Size)
+	for i, game := range b.Rounds[0] {
+		if seed := order[2*i]; seed <= len(entrants) {
+			game.PlayerA = entrants[seed-1].UserId
+		}
+		if seed := order[2*i+1]; seed <= len(entrants) {
+			game.PlayerB = entrants[seed-1].UserId
+		}
+	}
+	d.logger.Info("Seeded %d players into a bracket of %d", len(entrants), b.Size)
+	return nil
+}
+
+// tick settles byes, fills later rounds as earlier games are decided and starts every game that is ready
+func (b *Bracket) tick(d *directorContext) {
+	for r, round := range b.Rounds {
+		for _, game := range round {
+			if game.Decided {
+				continue
+			}
+			if r > 0 {
+				feederA, feederB := b.Rounds[r-1][2*game.Index], b.Rounds[r-1][2*game.Index+1]
+				if !feederA.Decided || !feederB.Decided {
+					continue
+				}
+				game.PlayerA, game.PlayerB = feederA.Winner, feederB.Winner
+			}
+
+			switch {
+			case game.PlayerA == "" && game.PlayerB == "":
+				b.decide(d, game, "", BracketResultVoid)
+			case game.PlayerA == "":
+				b.decide(d, game, game.PlayerB, BracketResultBye)
+			case game.PlayerB == "":
+				b.decide(d, game, game.PlayerA, BracketResultBye)
+			case game.MatchId == "":
+				ref := &TournamentRef{Id: d.state.Id, Kind: FormatBracket, Round: r, Game: game.Index}
+				if matchId, err := d.createGame(ref, game.PlayerA, game.PlayerB, nil); err == nil {
+					game.MatchId = matchId
+					game.Games++
+					d.changed()
+				}
+			}
+		}
+	}
+
+	final := b.Rounds[len(b.Rounds)-1][0]
+	if final.Decided && d.state.Status == TournamentRunning {
+		b.Champion = final.Winner
+		d.state.Status = TournamentFinished
+		d.changed()
+		d.logger.Info("=== TOURNAMENT FINISHED === %s, champion: %q", d.state.Id, b.Champion)
+	}
+}
+
+// result applies a finished game: a winner goes through, drawn and void games are replayed,
+// and players who never joined are knocked out
+func (b *Bracket) result(d *directorContext, record *MatchRecord) {
+	ref := record.Tournament
+	if ref.Round < 0 || ref.Round >= len(b.Rounds) || ref.Game < 0 || ref.Game >= len(b.Rounds[ref.Round]) {
+		d.logger.Error("Result of %s is for an unknown bracket game", record.MatchId)
+		return
+	}
+	game := b.Rounds[ref.Round][ref.Game]
+	if game.Decided || game.MatchId != record.MatchId {
+		d.logger.Warn("Ignoring stale result of %s", record.MatchId)
+		return
+	}
+
+	present := map[string]bool{}
+	for _, p := range record.Players {
+		present[p.UserId] = true
+	}
+
+	switch {
+	case record.Winner == game.PlayerA || record.Winner == game.PlayerB:
+		b.decide(d, game, record.Winner, BracketResultPlayed)
+	case !present[game.PlayerA] && !present[game.PlayerB]:
+		b.decide(d, game, "", BracketResultVoid)
+	case !present[game.PlayerB] && record.StartedAt == 0:
+		b.decide(d, game, game.PlayerA, BracketResultNoShow)
+	case !present[game.PlayerA] && record.StartedAt == 0:
+		b.decide(d, game, game.PlayerB, BracketResultNoShow)
+	case game.Games >= bracketMaxGames:
+		// Drawn again, the better seed goes through
+		winner := game.PlayerA
+		if a, other := d.state.entrant(game.PlayerA), d.state.entrant(game.PlayerB); a != nil && other != nil && other.Seed < a.Seed {
+			winner = game.PlayerB
+		}
+		b.decide(d, game, winner, BracketResultSeed)
+	default:
+		// Drawn or void, play again
+		d.logger.Info("Bracket game %d of round %d ended %s, replaying", game.Index, game.Round, record.EndReason)
+		game.MatchId = ""
+		d.changed()
+	}
+}
+
+// decide settles a game and records how far both players got
+func (b *Bracket) decide(d *directorContext, game *BracketGame, winner, result string) {
+	game.Decided = true
+	game.Winner = winner
+	game.Result = result
+	d.changed()
+
+	if winner != "" {
+		// The score is the number of rounds a player got through
+		d.recordScore(winner, int64(game.Round+1), 0)
+	}
+	d.logger.Info("Bracket game %d of round %d decided (%s), winner: %q", game.Index, game.Round, result, winner)
+}
+
+// roundPlace is the place shared by everyone knocked out in a round: behind the 2^(rounds-r-1) players
+// who got further, so both losing semi-finalists are third and the next place is fifth
+func (b *Bracket) roundPlace(round int) int {
+	return 1<<(len(b.Rounds)-round-1) + 1
+}
+
+// placings ranks entrants by the round they went out in: the champion first, then the runner-up,
+// then both losing semi-finalists and so on. Players still in when the event ends share the place of their round,
+// winners waiting for their next opponent that of the next round.
+func (b *Bracket) placings(t *TournamentState) map[string]int {
+	placings := map[string]int{}
+	for r, round := range b.Rounds {
+		for _, game := range round {
+			for _, userId := range []string{game.PlayerA, game.PlayerB} {
+				if userId != "" {
+					placings[userId] = b.roundPlace(r)
+				}
+			}
+			if game.Decided && game.Winner != "" && r+1 < len(b.Rounds) {
+				placings[game.Winner] = b.roundPlace(r + 1)
+			}
+		}
+	}
+	if b.Champion != "" {
+		placings[b.Champion] = 1
+	}
+	return placings
+}
+
+// standings lists entrants by placing, then seed. Points are the rounds a player got through.
+func (b *Bracket) standings(t *TournamentState) []*TournamentStanding {
+	placings := b.placings(t)
+	standings := make([]*TournamentStanding, 0, len(placings))
+	for _, e := range t.Entrants {
+		place, ok := placings[e.UserId]
+		if !ok {
+			continue
+		}
+		standings = append(standings, &TournamentStanding{
+			Place:    place,
+			UserId:   e.UserId,
+			Username: e.Username,
+			Points:   float64(len(b.Rounds) - bits.Len(uint(place-1))),
+		})
+	}
+	seeds := map[string]int{}
+	for _, e := range t.Entrants {
+		seeds[e.UserId] = e.Seed
+	}
+	sort.SliceStable(standings, func(i, j int) bool {
+		if standings[i].Place != standings[j].Place {
+			return standings[i].Place < standings[j].Place
+		}
+		return seeds[standings[i].UserId] < seeds[standings[j].UserId]
+	})
+	return standings
+}
+
+// rpcCreateBracketTournament is the server to server RPC creating a single elimination tournament
+func rpcCreateBracketTournament(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if userId, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string); userId != "" {
+		return "", errPermissionDenied
+	}
+
+	req, err := parseCreateTournamentRequest(payload)
+	if err != nil {
+		return "", err
+	}
+	state, err := createTournament(ctx, logger, nk, FormatBracket, req, systemClock{}.Now().Unix())
+	if err != nil {
+		return "", err
+	}
+
+	respBytes, _ := json.Marshal(state)
+	return string(respBytes), nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import "testing"
+
+// bracketGame is a first or later round game, decided when winner is set
+func bracketGame(round, index int, a, b, winner string) *BracketGame {
+	return &BracketGame{Round: round, Index: index, PlayerA: a, PlayerB: b, Decided: winner != "", Winner: winner}
+}
+
+func TestBracketPlacingsUseCompetitionRanking(t *testing.T) {
+	state := &TournamentState{}
+	for i, userId := range []string{"p1", "p2", "p3", "p4", "p5", "p6", "p7", "p8"} {
+		state.Entrants = append(state.Entrants, &TournamentEntrant{UserId: userId, Username: userId, Seed: i + 1})
+	}
+	firstRound := []*BracketGame{
+		bracketGame(0, 0, "p1", "p8", "p1"),
+		bracketGame(0, 1, "p4", "p5", "p4"),
+		bracketGame(0, 2, "p2", "p7", "p2"),
+		bracketGame(0, 3, "p3", "p6", "p3"),
+	}
+
+	tests := []struct {
+		name   string
+		rounds [][]*BracketGame
+		champ  string
+		places map[string]int
+		points map[string]float64
+	}{
+		{
+			name: "finished",
+			rounds: [][]*BracketGame{
+				firstRound,
+				{bracketGame(1, 0, "p1", "p4", "p1"), bracketGame(1, 1, "p2", "p3", "p2")},
+				{bracketGame(2, 0, "p1", "p2", "p1")},
+			},
+			champ:  "p1",
+			places: map[string]int{"p1": 1, "p2": 2, "p3": 3, "p4": 3, "p5": 5, "p6": 5, "p7": 5, "p8": 5},
+			points: map[string]float64{"p1": 3, "p2": 2, "p3": 1, "p4": 1, "p5": 0, "p8": 0},
+		},
+		{
+			name: "ended during the semi-finals",
+			rounds: [][]*BracketGame{
+				firstRound,
+				{bracketGame(1, 0, "p1", "p4", "p1"), bracketGame(1, 1, "p2", "p3", "")},
+				{bracketGame(2, 0, "", "", "")},
+			},
+			places: map[string]int{"p1": 2, "p2": 3, "p3": 3, "p4": 3, "p5": 5, "p6": 5, "p7": 5, "p8": 5},
+			points: map[string]float64{"p1": 2, "p2": 1, "p4": 1, "p7": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &Bracket{Size: 8, Rounds: tt.rounds, Champion: tt.champ}
+			placings := b.placings(state)
+			for userId, want := range tt.places {
+				if got, ok := placings[userId]; !ok || got != want {
+					t.Errorf("place of %s = %d (placed %v), want %d", userId, got, ok, want)
+				}
+			}
+
+			standings := b.standings(state)
+			for i, standing := range standings {
+				if i > 0 && standing.Place < standings[i-1].Place {
+					t.Errorf("standings out of order at %d: place %d after %d", i, standing.Place, standings[i-1].Place)
+				}
+				if want, ok := tt.points[standing.UserId]; ok && standing.Points != want {
+					t.Errorf("points of %s = %v, want %v rounds won", standing.UserId, standing.Points, want)
+				}
+			}
+		})
+	}
+}
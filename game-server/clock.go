@@ -0,0 +1,15 @@
+package main
+
+import "time"
+
+// Clock supplies wall-clock time to the match handler so it can be replaced when testing
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock reads the real time
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,10 @@
+module tictac/cmd/verify-replays
+
+go 1.25.0
+
+require (
+	github.com/lib/pq v1.12.3
+	tictac v0.0.0
+)
+
+replace tictac => ../..
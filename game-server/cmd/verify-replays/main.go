@@ -0,0 +1,383 @@
+// Command verify-replays re-simulates stored match records with the rules the match handler uses
+// and reports every record whose stored outcome, or leaderboard entry, disagrees with the replay.
+//
+// Records are read from a storage export file or straight from the Nakama database:
+//
+//	verify-replays -file matches.json -leaderboard-file leaderboard.json
+//	verify-replays -db "postgres://root@localhost:26257/nakama?sslmode=disable"
+//
+// It exits with status 1 if any discrepancy was found.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"tictac/rules"
+)
+
+const matchRecordCollection = "matches"
+
+// modes are the game modes that have leaderboards
+var modes = []string{"classic", "timed"}
+
+// matchRecord mirrors the JSON of the plugin's MatchRecord, only the fields the replay needs
+type matchRecord struct {
+	MatchId  string `json:"match_id"`
+	GameMode string `json:"game_mode"`
+	Players  []struct {
+		UserId   string `json:"user_id"`
+		Username string `json:"username"`
+		Symbol   string `json:"symbol"`
+	} `json:"players"`
+	StartBoard rules.Board `json:"start_board"`
+	Moves      []struct {
+		UserId string `json:"user_id"`
+		Symbol string `json:"symbol"`
+		Row    int    `json:"row"`
+		Col    int    `json:"col"`
+	} `json:"moves"`
+	Board     rules.Board     `json:"board"`
+	Winner    string          `json:"winner_id"`
+	EndReason rules.EndReason `json:"end_reason"`
+	EndedAt   int64           `json:"ended_at"`
+}
+
+// storageObject is one object in a storage export, the value may be a JSON string or an object
+type storageObject struct {
+	Collection string          `json:"collection"`
+	Key        string          `json:"key"`
+	UserId     string          `json:"user_id"`
+	Value      json.RawMessage `json:"value"`
+}
+
+// leaderboardRecord is one leaderboard record, the expiry is unix seconds and 0 if it never resets
+type leaderboardRecord struct {
+	LeaderboardId string `json:"leaderboard_id"`
+	OwnerId       string `json:"owner_id"`
+	Score         int64  `json:"score"`
+	ExpiryTime    int64  `json:"expiry_time"`
+}
+
+func main() {
+	file := flag.String("file", "", "storage export of the matches collection, a JSON array or one object per line")
+	dsn := flag.String("db", "", "Postgres connection string of the Nakama database")
+	leaderboardFile := flag.String("leaderboard-file", "", "leaderboard records of the per-mode boards as a JSON array, checked against the verified results")
+	period := flag.Duration("leaderboard-period", 7*24*time.Hour, "length of a weekly leaderboard period, ending at the record's expiry time")
+	flag.Parse()
+
+	if (*file == "") == (*dsn == "") {
+		fmt.Fprintln(os.Stderr, "exactly one of -file or -db is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var records []*matchRecord
+	var board []*leaderboardRecord
+	var err error
+	if *file != "" {
+		records, err = readRecordsFile(*file)
+		if err == nil && *leaderboardFile != "" {
+			board, err = readLeaderboardFile(*leaderboardFile)
+		}
+	} else {
+		records, board, err = readDatabase(*dsn)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	problems := 0
+	report := func(format string, args ...interface{}) {
+		problems++
+		fmt.Printf(format+"\n", args...)
+	}
+
+	var verified []*matchRecord
+	for _, record := range records {
+		if err := verifyRecord(record); err != nil {
+			report("match %s: %v", record.MatchId, err)
+			continue
+		}
+		verified = append(verified, record)
+	}
+	if board != nil {
+		verifyLeaderboard(verified, board, *period, report)
+	}
+
+	fmt.Printf("checked %d match records and %d leaderboard records, %d discrepancies\n", len(records), len(board), problems)
+	if problems > 0 {
+		os.Exit(1)
+	}
+}
+
+// verifyRecord replays the moves of a record from its start board and checks the stored outcome against the result
+func verifyRecord(record *matchRecord) error {
+	if !rules.IsReachable(record.StartBoard) {
+		return fmt.Errorf("start board cannot arise in play")
+	}
+	symbols := make(map[string]string, len(record.Players))
+	for _, p := range record.Players {
+		symbols[p.UserId] = p.Symbol
+	}
+
+	board := record.StartBoard
+	for i, move := range record.Moves {
+		if symbols[move.UserId] != move.Symbol {
+			return fmt.Errorf("move %d: player %s does not play %s", i+1, move.UserId, move.Symbol)
+		}
+		if side := rules.SideToMove(board); move.Symbol != side {
+			return fmt.Errorf("move %d: %s moved but it was %s's turn", i+1, move.Symbol, side)
+		}
+		if err := rules.CheckMove(board, move.Row, move.Col); err != nil {
+			return fmt.Errorf("move %d (%d,%d): %v", i+1, move.Row, move.Col, err)
+		}
+		board[move.Row*3+move.Col] = move.Symbol
+	}
+	if board != record.Board {
+		return fmt.Errorf("stored board %v, replay ends on %v", record.Board, board)
+	}
+
+	winner := rules.Winner(board)
+	decided := winner != "" || rules.IsBoardFull(board)
+	stored := ""
+	if record.Winner != "" {
+		var ok bool
+		if stored, ok = symbols[record.Winner]; !ok {
+			return fmt.Errorf("winner %s is not a player", record.Winner)
+		}
+	}
+
+	switch record.EndReason {
+	case rules.EndReasonWin:
+		if winner == "" || stored != winner {
+			return fmt.Errorf("stored win for %q, replay winner is %q", stored, winner)
+		}
+	case rules.EndReasonDraw:
+		if !decided || winner != "" || stored != "" {
+			return fmt.Errorf("stored draw, replay winner is %q and the board is full: %t", winner, rules.IsBoardFull(board))
+		}
+	case rules.EndReasonTimeout, rules.EndReasonForfeit:
+		if decided {
+			return fmt.Errorf("stored %s on a board that was already decided", record.EndReason)
+		}
+		if stored == "" {
+			return fmt.Errorf("stored %s without a winner", record.EndReason)
+		}
+		// Only the player on move can run out of time, either player may leave and forfeit
+		if toMove := rules.SideToMove(board); record.EndReason == rules.EndReasonTimeout && stored == toMove {
+			return fmt.Errorf("stored timeout won by %s, who was on move", stored)
+		}
+	case rules.EndReasonAdjudicated:
+		if decided {
+			return fmt.Errorf("stored adjudication on a board that was already decided")
+		}
+		if expected := rules.Adjudicate(board); stored != expected {
+			return fmt.Errorf("stored adjudication for %q, perfect play gives %q", stored, expected)
+		}
+	case rules.EndReasonVoid, rules.EndReasonIdle, rules.EndReasonCancelled, rules.EndReasonAbandoned:
+		if stored != "" || decided {
+			return fmt.Errorf("stored %s with winner %q on a board that is decided: %t", record.EndReason, stored, decided)
+		}
+	default:
+		return fmt.Errorf("unknown end reason %q", record.EndReason)
+	}
+	return nil
+}
+
+// verifyLeaderboard checks the leaderboard scores against the points of the verified games.
+// Weekly scores must equal the points scored in the latest period and every player who scored must have a record.
+// All-time boards also hold points from before match records were kept, so their scores may only be higher.
+func verifyLeaderboard(records []*matchRecord, board []*leaderboardRecord, period time.Duration, report func(string, ...interface{})) {
+	for _, mode := range modes {
+		for _, p := range rules.Periods {
+			id := rules.LeaderboardId(mode, p)
+			var boardRecords []*leaderboardRecord
+			// Only the latest period is checked, older records may have been cleared by a reset
+			latest := int64(0)
+			for _, r := range board {
+				if r.LeaderboardId == id {
+					boardRecords = append(boardRecords, r)
+					if r.ExpiryTime > latest {
+						latest = r.ExpiryTime
+					}
+				}
+			}
+
+			expected := make(map[string]int64)
+			for _, record := range records {
+				inPeriod := latest == 0 || (record.EndedAt >= latest-int64(period.Seconds()) && record.EndedAt < latest)
+				if record.GameMode != mode || !inPeriod {
+					continue
+				}
+				for _, player := range record.Players {
+					expected[player.UserId] += rules.ResultPoints(mode, rules.ResultFor(player.UserId, record.Winner, record.EndReason))
+				}
+			}
+
+			seen := make(map[string]bool)
+			for _, r := range boardRecords {
+				if r.ExpiryTime != latest {
+					continue
+				}
+				seen[r.OwnerId] = true
+				switch {
+				case p == rules.PeriodAllTime && r.Score < expected[r.OwnerId]:
+					report("leaderboard %s %s: score %d is below the %d points of verified games", id, r.OwnerId, r.Score, expected[r.OwnerId])
+				case p != rules.PeriodAllTime && r.Score != expected[r.OwnerId]:
+					report("leaderboard %s %s: score %d, verified games give %d", id, r.OwnerId, r.Score, expected[r.OwnerId])
+				}
+			}
+
+			owners := make([]string, 0, len(expected))
+			for owner, points := range expected {
+				if points > 0 && !seen[owner] {
+					owners = append(owners, owner)
+				}
+			}
+			sort.Strings(owners)
+			for _, owner := range owners {
+				report("leaderboard %s %s: no record for %d points of verified games", id, owner, expected[owner])
+			}
+		}
+	}
+}
+
+// readRecordsFile reads the match records out of a storage export
+func readRecordsFile(path string) ([]*matchRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []*storageObject
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &objects); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(nil, 16<<20)
+		for line := 1; scanner.Scan(); line++ {
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			var object storageObject
+			if err := json.Unmarshal(scanner.Bytes(), &object); err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+			}
+			objects = append(objects, &object)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var records []*matchRecord
+	for _, object := range objects {
+		if object.Collection != matchRecordCollection {
+			continue
+		}
+		value := []byte(object.Value)
+		var s string
+		if json.Unmarshal(value, &s) == nil {
+			value = []byte(s)
+		}
+		record, err := decodeRecord(object.Key, value)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// readLeaderboardFile reads leaderboard records as listed by the Nakama API
+func readLeaderboardFile(path string) ([]*leaderboardRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var records []*leaderboardRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return records, nil
+}
+
+// readDatabase reads the match records and leaderboard records from the Nakama database
+func readDatabase(dsn string) ([]*matchRecord, []*leaderboardRecord, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT key, value FROM storage WHERE collection = $1", matchRecordCollection)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var records []*matchRecord
+	for rows.Next() {
+		var key string
+		var value []byte
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, nil, err
+		}
+		record, err := decodeRecord(key, value)
+		if err != nil {
+			return nil, nil, err
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var ids []string
+	for _, mode := range modes {
+		for _, period := range rules.Periods {
+			ids = append(ids, rules.LeaderboardId(mode, period))
+		}
+	}
+	rows, err = db.Query("SELECT leaderboard_id, owner_id, score, expiry_time FROM leaderboard_record WHERE leaderboard_id = ANY($1)", pq.Array(ids))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	board := []*leaderboardRecord{}
+	for rows.Next() {
+		var r leaderboardRecord
+		var expiry time.Time
+		if err := rows.Scan(&r.LeaderboardId, &r.OwnerId, &r.Score, &expiry); err != nil {
+			return nil, nil, err
+		}
+		// Records that never expire are stored with the zero unix time
+		r.ExpiryTime = expiry.Unix()
+		board = append(board, &r)
+	}
+	return records, board, rows.Err()
+}
+
+// decodeRecord decodes one stored match record
+func decodeRecord(key string, value []byte) (*matchRecord, error) {
+	var record matchRecord
+	if err := json.Unmarshal(value, &record); err != nil {
+		return nil, fmt.Errorf("match %s: %v", key, err)
+	}
+	if record.MatchId == "" {
+		record.MatchId = key
+	}
+	return &record, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// MatchConfig holds server-wide match settings read from the runtime environment
+type MatchConfig struct {
+	InviteReservationSec int               // seconds invited players have to join before the match is cancelled
+	ReconnectGraceSec    int               // seconds a disconnected player keeps their seat before forfeiting
+	PauseClockModes      map[GameMode]bool // modes whose turn clock stops while a player is disconnected
+	EndLingerSec         int               // seconds a finished match stays open before it is closed
+	IdleLimitSec         int               // seconds without any activity before a match is closed
+	ShutdownPolicy       ShutdownPolicy    // what happens to unfinished games when the server stops
+	RateLimitPerSec      int               // messages per second a presence may send on average
+	RateLimitBurst       int               // messages a presence may send in a burst
+	MaxPayloadBytes      int               // largest match message accepted from a client
+	KickAfterViolations  int               // rate limit violations before a presence is kicked
+	SpectatorDelayMoves  int               // default number of moves spectators lag behind the players
+	SpectatorDelaySec    int               // default number of seconds spectators lag behind the players
+}
+
+// defaultMatchConfig returns the settings used when nothing is configured
+func defaultMatchConfig() *MatchConfig {
+	return &MatchConfig{
+		InviteReservationSec: 30,
+		ReconnectGraceSec:    30,
+		PauseClockModes:      map[GameMode]bool{GameModeTimed: true},
+		EndLingerSec:         10,
+		IdleLimitSec:         300,
+		ShutdownPolicy:       ShutdownPolicyVoid,
+		RateLimitPerSec:      5,
+		RateLimitBurst:       10,
+		MaxPayloadBytes:      256,
+		KickAfterViolations:  50,
+		SpectatorDelayMoves:  0,
+		SpectatorDelaySec:    0,
+	}
+}
+
+// loadMatchConfig reads match settings from the runtime env section of the server config
+func loadMatchConfig(ctx context.Context, logger runtime.Logger) *MatchConfig {
+	config := defaultMatchConfig()
+
+	env, ok := ctx.Value(runtime.RUNTIME_CTX_ENV).(map[string]string)
+	if !ok {
+		return config
+	}
+
+	config.InviteReservationSec = envInt(logger, env, "invite_reservation_seconds", config.InviteReservationSec)
+	config.ReconnectGraceSec = envInt(logger, env, "reconnect_grace_seconds", config.ReconnectGraceSec)
+	config.EndLingerSec = envInt(logger, env, "end_linger_seconds", config.EndLingerSec)
+	config.IdleLimitSec = envInt(logger, env, "idle_limit_seconds", config.IdleLimitSec)
+	config.RateLimitPerSec = envInt(logger, env, "rate_limit_per_second", config.RateLimitPerSec)
+	config.RateLimitBurst = envInt(logger, env, "rate_limit_burst", config.RateLimitBurst)
+	config.MaxPayloadBytes = envInt(logger, env, "max_payload_bytes", config.MaxPayloadBytes)
+	config.KickAfterViolations = envInt(logger, env, "kick_after_violations", config.KickAfterViolations)
+	config.SpectatorDelayMoves = envIntMin(logger, env, "spectator_delay_moves", config.SpectatorDelayMoves, 0)
+	config.SpectatorDelaySec = envIntMin(logger, env, "spectator_delay_seconds", config.SpectatorDelaySec, 0)
+	switch policy := ShutdownPolicy(env["shutdown_policy"]); policy {
+	case ShutdownPolicyVoid, ShutdownPolicyAdjudicate:
+		config.ShutdownPolicy = policy
+	case "":
+	default:
+		logger.Warn("Invalid value %q for runtime env shutdown_policy, using %s", policy, config.ShutdownPolicy)
+	}
+	if modes, ok := env["reconnect_pause_clock_modes"]; ok {
+		config.PauseClockModes = make(map[GameMode]bool)
+		for _, mode := range strings.Split(modes, ",") {
+			if mode = strings.TrimSpace(mode); mode != "" {
+				config.PauseClockModes[GameMode(mode)] = true
+			}
+		}
+	}
+
+	logger.Info("Match config: %+v", *config)
+	return config
+}
+
+// envInt returns the positive integer value of key, or fallback if it is missing or invalid
+func envInt(logger runtime.Logger, env map[string]string, key string, fallback int) int {
+	return envIntMin(logger, env, key, fallback, 1)
+}
+
+// envIntMin returns the integer value of key if it is at least min, or fallback if it is missing or invalid
+func envIntMin(logger runtime.Logger, env map[string]string, key string, fallback int, min int) int {
+	value, ok := env[key]
+	if !ok || value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < min {
+		logger.Warn("Invalid value %q for runtime env %s, using %d", value, key, fallback)
+		return fallback
+	}
+	return parsed
+}
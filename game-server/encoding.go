@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/protobuf/proto"
+	"tictac/pb"
+)
+
+//go:generate protoc --go_out=. --go_opt=module=tictac match.proto
+
+// Encoding is the wire format a presence asked for in its "encoding" join metadata
+type Encoding string
+
+const (
+	EncodingJSON     Encoding = "json"     // default, one JSON object per message
+	EncodingProtobuf Encoding = "protobuf" // binary messages defined in match.proto
+
+	encodingMetadata = "encoding"
+)
+
+// parseEncoding reads the encoding from the join metadata, reporting false for unknown values
+func parseEncoding(metadata map[string]string) (Encoding, bool) {
+	switch Encoding(metadata[encodingMetadata]) {
+	case "", EncodingJSON:
+		return EncodingJSON, true
+	case EncodingProtobuf:
+		return EncodingProtobuf, true
+	}
+	return "", false
+}
+
+// protoMessage is implemented by every message in match.proto, converting it to its generated form
+type protoMessage interface {
+	toProto() proto.Message
+}
+
+// encodeMessage renders message in the given encoding
+func encodeMessage(encoding Encoding, message interface{}) []byte {
+	if encoding == EncodingProtobuf {
+		if pm, ok := message.(protoMessage); ok {
+			messageBytes, _ := proto.Marshal(pm.toProto())
+			return messageBytes
+		}
+	}
+	messageBytes, _ := json.Marshal(message)
+	return messageBytes
+}
+
+// encodingOf returns the encoding chosen by a session
+func encodingOf(matchState *MatchState, sessionId string) Encoding {
+	if encoding, ok := matchState.Encodings[sessionId]; ok {
+		return encoding
+	}
+	return EncodingJSON
+}
+
+// usesProtobuf reports whether any session in the match asked for protobuf
+func usesProtobuf(matchState *MatchState) bool {
+	for _, encoding := range matchState.Encodings {
+		if encoding == EncodingProtobuf {
+			return true
+		}
+	}
+	return false
+}
+
+// connectedPresences returns the presences currently in the match
+func connectedPresences(matchState *MatchState) []runtime.Presence {
+	return append(playerPresences(matchState), matchState.Spectators...)
+}
+
+// playerPresences returns the seated players currently in the match
+func playerPresences(matchState *MatchState) []runtime.Presence {
+	presences := make([]runtime.Presence, 0, len(matchState.Players)+len(matchState.Spectators))
+	for _, p := range matchState.Players {
+		if _, away := matchState.Disconnected[p.GetUserId()]; !away {
+			presences = append(presences, p)
+		}
+	}
+	return presences
+}
+
+// decodeMoveAction reads a MoveAction in the sender's encoding
+func decodeMoveAction(encoding Encoding, data []byte, action *MoveAction) error {
+	if encoding != EncodingProtobuf {
+		return json.Unmarshal(data, action)
+	}
+	var msg pb.MoveAction
+	if err := proto.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+	*action = MoveAction{Seq: msg.Seq, Version: msg.Version, Row: int(msg.Row), Col: int(msg.Col)}
+	return nil
+}
+
+// protoInts converts a list of ints to the int32s match.proto declares
+func protoInts(v []int) []int32 {
+	if v == nil {
+		return nil
+	}
+	ints := make([]int32, len(v))
+	for i, n := range v {
+		ints[i] = int32(n)
+	}
+	return ints
+}
+
+func (a *MoveAction) toProto() proto.Message {
+	return &pb.MoveAction{Seq: a.Seq, Version: a.Version, Row: int32(a.Row), Col: int32(a.Col)}
+}
+
+func (msg *WelcomeMessage) toProto() proto.Message {
+	return &pb.WelcomeMessage{
+		Message:         msg.Message,
+		PlayerCount:     int32(msg.PlayerCount),
+		GameMode:        string(msg.GameMode),
+		TurnTimeLimit:   msg.TurnTimeLimit,
+		ProtocolVersion: int32(msg.ProtocolVersion),
+	}
+}
+
+func (msg *PlayerJoinedMessage) toProto() proto.Message {
+	return &pb.PlayerJoinedMessage{
+		Message:       msg.Message,
+		UserId:        msg.UserId,
+		Username:      msg.Username,
+		TotalPlayers:  int32(msg.TotalPlayers),
+		Opponent:      msg.Opponent,
+		CurrentTurn:   msg.CurrentTurn,
+		BoardState:    msg.BoardState[:],
+		BoardVersion:  msg.BoardVersion,
+		Symbol:        msg.Symbol,
+		GameMode:      string(msg.GameMode),
+		TurnTimeLimit: msg.TurnTimeLimit,
+		TimeRemaining: msg.TimeRemaining,
+		StateVersion:  msg.StateVersion,
+	}
+}
+
+func (msg *PlayerLeftMessage) toProto() proto.Message {
+	return &pb.PlayerLeftMessage{
+		Message:          msg.Message,
+		UserId:           msg.UserId,
+		ReconnectSeconds: int32(msg.ReconnectSeconds),
+		ClockPaused:      msg.ClockPaused,
+		StateVersion:     msg.StateVersion,
+	}
+}
+
+func (msg *GameUpdateMessage) toProto() proto.Message {
+	return &pb.GameUpdateMessage{
+		BoardState:    msg.BoardState[:],
+		BoardVersion:  msg.BoardVersion,
+		CurrentTurn:   msg.CurrentTurn,
+		GameMode:      string(msg.GameMode),
+		TimeRemaining: msg.TimeRemaining,
+		StateVersion:  msg.StateVersion,
+	}
+}
+
+func (msg *GameOverMessage) toProto() proto.Message {
+	return &pb.GameOverMessage{
+		Message:       msg.Message,
+		WinnerId:      msg.WinnerId,
+		EndReason:     string(msg.EndReason),
+		BoardState:    msg.BoardState[:],
+		GameMode:      string(msg.GameMode),
+		WinningStrike: protoInts(msg.WinningStrike),
+		StateVersion:  msg.StateVersion,
+	}
+}
+
+func (msg *ErrorMessage) toProto() proto.Message {
+	return &pb.ErrorMessage{
+		Error:        msg.Error,
+		Code:         string(msg.Code),
+		Seq:          msg.Seq,
+		LastSeq:      msg.LastSeq,
+		BoardVersion: msg.BoardVersion,
+	}
+}
+
+func (msg *TimerUpdateMessage) toProto() proto.Message {
+	return &pb.TimerUpdateMessage{TimeRemaining: msg.TimeRemaining, CurrentTurn: msg.CurrentTurn}
+}
+
+func (msg *MatchCancelledMessage) toProto() proto.Message {
+	return &pb.MatchCancelledMessage{Message: msg.Message, Reason: msg.Reason}
+}
+
+func (msg *PhaseChangeMessage) toProto() proto.Message {
+	return &pb.PhaseChangeMessage{
+		Phase:         string(msg.Phase),
+		PreviousPhase: string(msg.PreviousPhase),
+		CurrentTurn:   msg.CurrentTurn,
+		BoardState:    msg.BoardState[:],
+		StateVersion:  msg.StateVersion,
+	}
+}
+
+func (msg *StateSyncMessage) toProto() proto.Message {
+	return &pb.StateSyncMessage{
+		UserId:        msg.UserId,
+		Phase:         string(msg.Phase),
+		BoardState:    msg.BoardState[:],
+		BoardVersion:  msg.BoardVersion,
+		LastSeq:       msg.LastSeq,
+		CurrentTurn:   msg.CurrentTurn,
+		Symbol:        msg.Symbol,
+		PlayerSymbols: msg.PlayerSymbols,
+		Opponent:      msg.Opponent,
+		TotalPlayers:  int32(msg.TotalPlayers),
+		Disconnected:  msg.Disconnected,
+		GameMode:      string(msg.GameMode),
+		GameEnded:     msg.GameEnded,
+		WinnerId:      msg.WinnerId,
+		EndReason:     string(msg.EndReason),
+		TurnTimeLimit: msg.TurnTimeLimit,
+		TimeRemaining: msg.TimeRemaining,
+		StateVersion:  msg.StateVersion,
+		Spectating:    msg.Spectating,
+		Spectators:    int32(msg.Spectators),
+	}
+}
+
+func (msg *PlayerReconnectedMessage) toProto() proto.Message {
+	return &pb.PlayerReconnectedMessage{
+		Message:      msg.Message,
+		UserId:       msg.UserId,
+		Username:     msg.Username,
+		StateVersion: msg.StateVersion,
+	}
+}
+
+func (msg *MatchClosedMessage) toProto() proto.Message {
+	return &pb.MatchClosedMessage{
+		Message:       msg.Message,
+		WinnerId:      msg.WinnerId,
+		EndReason:     string(msg.EndReason),
+		BoardState:    msg.BoardState[:],
+		PlayerSymbols: msg.PlayerSymbols,
+		GameMode:      string(msg.GameMode),
+	}
+}
+
+func (msg *MatchTerminatingMessage) toProto() proto.Message {
+	return &pb.MatchTerminatingMessage{
+		Message:      msg.Message,
+		EndReason:    string(msg.EndReason),
+		GraceSeconds: int32(msg.GraceSeconds),
+	}
+}
+
+func (msg *ServerRestartingMessage) toProto() proto.Message {
+	return &pb.ServerRestartingMessage{
+		Message:    msg.Message,
+		Policy:     string(msg.Policy),
+		BoardState: msg.BoardState[:],
+		Restorable: msg.Restorable,
+	}
+}
+
+func (msg *MoveAckMessage) toProto() proto.Message {
+	return &pb.MoveAckMessage{Seq: msg.Seq, Version: msg.Version}
+}
+
+func (msg *SpectatorCountMessage) toProto() proto.Message {
+	return &pb.SpectatorCountMessage{Count: int32(msg.Count)}
+}
+
+func (msg *ArenaStandingsMessage) toProto() proto.Message {
+	standings := make([]*pb.TournamentStanding, 0, len(msg.Standings))
+	for _, standing := range msg.Standings {
+		standings = append(standings, standing.toProto().(*pb.TournamentStanding))
+	}
+	return &pb.ArenaStandingsMessage{
+		TournamentId: msg.TournamentId,
+		Status:       string(msg.Status),
+		ClosesAt:     msg.ClosesAt,
+		Games:        int32(msg.Games),
+		Standings:    standings,
+	}
+}
+
+func (s *TournamentStanding) toProto() proto.Message {
+	return &pb.TournamentStanding{
+		Place:           int32(s.Place),
+		UserId:          s.UserId,
+		Username:        s.Username,
+		Points:          s.Points,
+		Buchholz:        s.Buchholz,
+		SonnebornBerger: s.SonnebornBerger,
+		Streak:          int32(s.Streak),
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"tictac/pb"
+)
+
+// dropZero removes the values proto3 leaves off the wire, so both forms can be compared
+func dropZero(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			if e = dropZero(e); e == nil {
+				delete(v, k)
+			} else {
+				v[k] = e
+			}
+		}
+		if len(v) == 0 {
+			return nil
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+		// Elements keep their place in the list, an element with every field zero becomes nil
+		for i, e := range v {
+			v[i] = dropZero(e)
+		}
+	case string:
+		if v == "" {
+			return nil
+		}
+	case float64:
+		if v == 0 {
+			return nil
+		}
+	case bool:
+		if !v {
+			return nil
+		}
+	case nil:
+		return nil
+	}
+	return v
+}
+
+// fillMessage sets every field of a message to a value that is not its zero value
+func fillMessage(v reflect.Value, seed int) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		fillMessage(v.Elem(), seed)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			fillMessage(v.Field(i), seed*31+i+1)
+		}
+	case reflect.String:
+		v.SetString(fmt.Sprintf("s%d", seed))
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(seed%1000 + 1))
+	case reflect.Float64:
+		v.SetFloat(float64(seed%1000) + 0.5)
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			fillMessage(v.Index(i), seed+i)
+		}
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 3, 3))
+		for i := 0; i < 3; i++ {
+			fillMessage(v.Index(i), seed+i)
+		}
+	case reflect.Map:
+		m := reflect.MakeMap(v.Type())
+		for i := 0; i < 2; i++ {
+			key, value := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+			fillMessage(key, seed+i)
+			fillMessage(value, seed+i+10)
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+	}
+}
+
+// protoMessages returns one of every message with a protobuf encoding
+func protoMessages() []protoMessage {
+	return []protoMessage{
+		&MoveAction{},
+		&WelcomeMessage{},
+		&PlayerJoinedMessage{},
+		&PlayerLeftMessage{},
+		&GameUpdateMessage{},
+		&GameOverMessage{},
+		&ErrorMessage{},
+		&TimerUpdateMessage{},
+		&MatchCancelledMessage{},
+		&PhaseChangeMessage{},
+		&StateSyncMessage{},
+		&PlayerReconnectedMessage{},
+		&MatchClosedMessage{},
+		&MatchTerminatingMessage{},
+		&ServerRestartingMessage{},
+		&MoveAckMessage{},
+		&SpectatorCountMessage{},
+		&ArenaStandingsMessage{},
+		&TournamentStanding{},
+	}
+}
+
+// TestProtoEncodingMatchesJSON decodes every message's protobuf with the code generated from match.proto
+// and checks it carries the same values as the JSON form of the message
+func TestProtoEncodingMatchesJSON(t *testing.T) {
+	seen := map[protoreflect.FullName]bool{}
+
+	for i, msg := range protoMessages() {
+		name := reflect.TypeOf(msg).Elem().Name()
+		t.Run(name, func(t *testing.T) {
+			fillMessage(reflect.ValueOf(msg), i+1)
+
+			decoded := msg.toProto().ProtoReflect().Type().New().Interface()
+			seen[decoded.ProtoReflect().Descriptor().FullName()] = true
+			if err := proto.Unmarshal(encodeMessage(EncodingProtobuf, msg), decoded); err != nil {
+				t.Fatalf("decoding protobuf: %v", err)
+			}
+
+			// Generated messages carry the proto field names as JSON tags, which are the names protocol.go uses
+			var fromProto, fromJson map[string]interface{}
+			protoJson, _ := json.Marshal(decoded)
+			if err := json.Unmarshal(protoJson, &fromProto); err != nil {
+				t.Fatalf("decoding generated message JSON: %v", err)
+			}
+			if err := json.Unmarshal(encodeMessage(EncodingJSON, msg), &fromJson); err != nil {
+				t.Fatalf("decoding JSON: %v", err)
+			}
+
+			if got, want := dropZero(fromProto), dropZero(fromJson); !reflect.DeepEqual(got, want) {
+				t.Errorf("protobuf and JSON differ\nprotobuf: %v\njson:     %v", got, want)
+			}
+		})
+	}
+
+	messages := pb.File_match_proto.Messages()
+	for i := 0; i < messages.Len(); i++ {
+		if name := messages.Get(i).FullName(); !seen[name] {
+			t.Errorf("match.proto declares %s but no message encodes to it", name)
+		}
+	}
+}
+
+// TestDecodeMoveAction reads back an encoded move in both encodings
+func TestDecodeMoveAction(t *testing.T) {
+	want := MoveAction{Seq: 12, Version: 7, Row: 2, Col: 1}
+	jsonBytes, _ := json.Marshal(&want)
+
+	for encoding, data := range map[Encoding][]byte{EncodingJSON: jsonBytes, EncodingProtobuf: encodeMessage(EncodingProtobuf, &want)} {
+		var got MoveAction
+		if err := decodeMoveAction(encoding, data, &got); err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		if got != want {
+			t.Errorf("%s: decoded %+v, want %+v", encoding, got, want)
+		}
+	}
+}
+
+// benchmarkMessages are the messages sent most often: after every move, on every resync and once a second
+func benchmarkMessages() map[string]interface{} {
+	board := [9]string{"X", "O", "X", "", "O", "", "", "X", ""}
+	return map[string]interface{}{
+		"GameUpdate": &GameUpdateMessage{
+			BoardState:    board,
+			BoardVersion:  5,
+			CurrentTurn:   "4ec4f126-3f9d-11e7-84ef-b7c182b36521",
+			GameMode:      GameModeTimed,
+			TimeRemaining: 27,
+			StateVersion:  14,
+		},
+		"StateSync": &StateSyncMessage{
+			UserId:       "4ec4f126-3f9d-11e7-84ef-b7c182b36521",
+			Phase:        PhasePlaying,
+			BoardState:   board,
+			BoardVersion: 5,
+			LastSeq:      3,
+			CurrentTurn:  "4ec4f126-3f9d-11e7-84ef-b7c182b36521",
+			Symbol:       "X",
+			PlayerSymbols: map[string]string{
+				"4ec4f126-3f9d-11e7-84ef-b7c182b36521": "X",
+				"9d2f8a10-3f9d-11e7-84ef-b7c182b36521": "O",
+			},
+			Opponent:      "bob",
+			TotalPlayers:  2,
+			Disconnected:  []string{},
+			GameMode:      GameModeTimed,
+			TurnTimeLimit: 30,
+			TimeRemaining: 27,
+			StateVersion:  14,
+			Spectators:    3,
+		},
+		"TimerUpdate": &TimerUpdateMessage{
+			TimeRemaining: 27,
+			CurrentTurn:   "4ec4f126-3f9d-11e7-84ef-b7c182b36521",
+		},
+	}
+}
+
+func benchmarkEncoding(b *testing.B, encoding Encoding) {
+	for name, msg := range benchmarkMessages() {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			var size int
+			for i := 0; i < b.N; i++ {
+				size = len(encodeMessage(encoding, msg))
+			}
+			b.ReportMetric(float64(size), "bytes/msg")
+		})
+	}
+}
+
+func BenchmarkEncodeJSON(b *testing.B) {
+	benchmarkEncoding(b, EncodingJSON)
+}
+
+func BenchmarkEncodeProtobuf(b *testing.B) {
+	benchmarkEncoding(b, EncodingProtobuf)
+}
+
+func BenchmarkDecodeMoveJSON(b *testing.B) {
+	data, _ := json.Marshal(&MoveAction{Seq: 12, Version: 7, Row: 2, Col: 1})
+	var action MoveAction
+	for i := 0; i < b.N; i++ {
+		_ = decodeMoveAction(EncodingJSON, data, &action)
+	}
+}
+
+func BenchmarkDecodeMoveProtobuf(b *testing.B) {
+	data := encodeMessage(EncodingProtobuf, &MoveAction{Seq: 12, Version: 7, Row: 2, Col: 1})
+	var action MoveAction
+	for i := 0; i < b.N; i++ {
+		_ = decodeMoveAction(EncodingProtobuf, data, &action)
+	}
+}
+
+// TestArenaStandingsFollowWatcherEncoding checks a director sends opcode 19 to each watcher in their encoding
+func TestArenaStandingsFollowWatcherEncoding(t *testing.T) {
+	td := &TournamentDirector{clock: &fakeClock{}}
+	ds := &DirectorState{
+		Tournament: &TournamentState{
+			Id:     "arena-1",
+			Format: FormatArena,
+			Status: TournamentRunning,
+			Arena:  &Arena{ClosesAt: 1700000600, Players: []*ArenaPlayer{{UserId: "alice", Score: 4, Streak: 2}}},
+		},
+		Encodings: make(map[string]Encoding),
+	}
+	ctx := context.Background()
+	dispatcher := &testDispatcher{}
+	jsonWatcher := testPresence{userId: "bob", sessionId: "s-bob"}
+	protoWatcher := testPresence{userId: "carol", sessionId: "s-carol"}
+
+	for presence, encoding := range map[testPresence]Encoding{jsonWatcher: EncodingJSON, protoWatcher: EncodingProtobuf} {
+		if _, ok, reason := td.MatchJoinAttempt(ctx, testLogger{}, nil, nil, dispatcher, 1, ds, presence, map[string]string{encodingMetadata: string(encoding)}); !ok {
+			t.Fatalf("%s refused: %s", presence.userId, reason)
+		}
+	}
+	td.MatchJoin(ctx, testLogger{}, nil, nil, dispatcher, 1, ds, []runtime.Presence{jsonWatcher, protoWatcher})
+
+	if len(dispatcher.sent) != 2 {
+		t.Fatalf("sent %d messages, want one per encoding", len(dispatcher.sent))
+	}
+	for _, msg := range dispatcher.sent {
+		if msg.opCode != OpCodeArenaStandings || len(msg.presences) != 1 {
+			t.Fatalf("sent opcode %d to %d presences, want opcode %d to one watcher", msg.opCode, len(msg.presences), OpCodeArenaStandings)
+		}
+		var standings ArenaStandingsMessage
+		switch msg.presences[0].GetSessionId() {
+		case jsonWatcher.sessionId:
+			if err := json.Unmarshal(msg.data, &standings); err != nil {
+				t.Fatalf("JSON watcher got %q: %v", msg.data, err)
+			}
+		case protoWatcher.sessionId:
+			var decoded pb.ArenaStandingsMessage
+			if err := proto.Unmarshal(msg.data, &decoded); err != nil {
+				t.Fatalf("protobuf watcher got undecodable standings: %v", err)
+			}
+			if decoded.TournamentId != "arena-1" || len(decoded.Standings) != 1 || decoded.Standings[0].Streak != 2 {
+				t.Errorf("protobuf standings = %v", &decoded)
+			}
+			continue
+		}
+		if standings.TournamentId != "arena-1" || len(standings.Standings) != 1 || standings.Standings[0].Streak != 2 {
+			t.Errorf("JSON standings = %+v", standings)
+		}
+	}
+
+	td.MatchLeave(ctx, testLogger{}, nil, nil, dispatcher, 2, ds, []runtime.Presence{protoWatcher})
+	if len(ds.Watchers) != 1 || ds.Encodings[protoWatcher.sessionId] != "" {
+		t.Errorf("after a watcher left: %d watchers, encodings %v", len(ds.Watchers), ds.Encodings)
+	}
+}
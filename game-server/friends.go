@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"tictac/rules"
+)
+
+const (
+	friendsPageSize   = 1000 // the most FriendsList returns at once
+	ownerRecordsBatch = 100
+)
+
+// FriendsLeaderboard is a leaderboard narrowed down to the caller and their friends
+type FriendsLeaderboard struct {
+	Mode    GameMode            `json:"mode"`
+	Period  string              `json:"period"`
+	Records []*LeaderboardEntry `json:"records"` // ranked within the group, GlobalRank keeps the rank on the full board
+	Me      *LeaderboardEntry   `json:"me,omitempty"`
+}
+
+// listFriendIds returns the user IDs of every mutual friend of userId
+func listFriendIds(ctx context.Context, nk runtime.NakamaModule, userId string) ([]string, error) {
+	mutual := 0
+	var ids []string
+	cursor := ""
+	for {
+		friends, next, err := nk.FriendsList(ctx, userId, friendsPageSize, &mutual, cursor)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range friends {
+			ids = append(ids, f.GetUser().GetId())
+		}
+		if next == "" {
+			return ids, nil
+		}
+		cursor = next
+	}
+}
+
+// friendsBoard is one leaderboard asked for in a GetFriendsLeaderboard request
+type friendsBoard struct {
+	Mode   GameMode `json:"mode"`
+	Period string   `json:"period"`
+}
+
+// rpcGetFriendsLeaderboard returns the standings of the caller and their friends on several boards at once.
+// The request lists the boards as "boards", each a mode and period; without it every mode and period is returned.
+// Boards come back in the order asked for.
+func rpcGetFriendsLeaderboard(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userId, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userId == "" {
+		return "", errNoUserId
+	}
+
+	var req struct {
+		Boards []friendsBoard `json:"boards"`
+	}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			return "", errBadInput
+		}
+	}
+	if len(req.Boards) == 0 {
+		for _, mode := range leaderboardModes {
+			for _, period := range rules.Periods {
+				req.Boards = append(req.Boards, friendsBoard{Mode: mode, Period: period})
+			}
+		}
+	}
+	if len(req.Boards) > len(leaderboardModes)*len(rules.Periods) {
+		return "", errBadInput
+	}
+	for i, b := range req.Boards {
+		mode, period, err := parseLeaderboardBoard(b.Mode, b.Period)
+		if err != nil {
+			return "", err
+		}
+		req.Boards[i] = friendsBoard{Mode: mode, Period: period}
+	}
+
+	ownerIds, err := listFriendIds(ctx, nk, userId)
+	if err != nil {
+		logger.Error("FriendsList error: %v", err)
+		return "", errInternal
+	}
+	ownerIds = append(ownerIds, userId)
+
+	resp := struct {
+		Boards []*FriendsLeaderboard `json:"boards"`
+	}{Boards: make([]*FriendsLeaderboard, 0, len(req.Boards))}
+	for _, b := range req.Boards {
+		board, err := friendsLeaderboard(ctx, logger, nk, userId, ownerIds, b.Mode, b.Period)
+		if err != nil {
+			return "", err
+		}
+		resp.Boards = append(resp.Boards, board)
+	}
+
+	respBytes, _ := json.Marshal(resp)
+	return string(respBytes), nil
+}
+
+// friendsLeaderboard ranks the owners' records on one board within the group
+func friendsLeaderboard(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userId string, ownerIds []string, mode GameMode, period string) (*FriendsLeaderboard, error) {
+	id := rules.LeaderboardId(string(mode), period)
+	board := &FriendsLeaderboard{Mode: mode, Period: period, Records: []*LeaderboardEntry{}}
+	for start := 0; start < len(ownerIds); start += ownerRecordsBatch {
+		end := start + ownerRecordsBatch
+		if end > len(ownerIds) {
+			end = len(ownerIds)
+		}
+		_, ownerRecords, _, _, err := nk.LeaderboardRecordsList(ctx, id, ownerIds[start:end], 1, "", 0)
+		if err != nil {
+			logger.Error("LeaderboardRecordsList error: %v", err)
+			return nil, errInternal
+		}
+		for _, r := range ownerRecords {
+			board.Records = append(board.Records, newLeaderboardEntry(logger, r))
+		}
+	}
+
+	// Order as the full board does, then rank within the group with ties sharing a rank
+	sort.SliceStable(board.Records, func(i, j int) bool {
+		a, b := board.Records[i], board.Records[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.Rank < b.Rank
+	})
+	for i, entry := range board.Records {
+		entry.GlobalRank = entry.Rank
+		entry.Rank = int64(i + 1)
+		if i > 0 && entry.Score == board.Records[i-1].Score {
+			entry.Rank = board.Records[i-1].Rank
+		}
+		if entry.OwnerId == userId {
+			board.Me = entry
+		}
+	}
+	return board, nil
+}
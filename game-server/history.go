@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"tictac/rules"
+)
+
+const (
+	matchHistoryCollection = "match_history"
+	matchHistoryIndex      = "match_history_idx"
+	matchHistoryMaxEntries = 1000000
+)
+
+// MatchResult is how a finished game went for one player, worked out by rules.ResultFor
+type MatchResult = rules.Result
+
+// MatchHistoryEntry is one finished game in a player's history, stored under the player
+type MatchHistoryEntry struct {
+	UserId       string      `json:"user_id"`
+	MatchId      string      `json:"match_id"`
+	OpponentId   string      `json:"opponent_id"`
+	OpponentName string      `json:"opponent_name"`
+	Symbol       string      `json:"symbol"`
+	Mode         GameMode    `json:"mode"`
+	Result       MatchResult `json:"result"`
+	EndReason    EndReason   `json:"end_reason"`
+	Duration     int64       `json:"duration"` // seconds from the start of play to the end
+	EndedAt      int64       `json:"ended_at"`
+}
+
+// registerMatchHistoryIndex indexes history entries so they can be filtered and paged by end time
+func registerMatchHistoryIndex(initializer runtime.Initializer) error {
+	return initializer.RegisterStorageIndex(matchHistoryIndex, matchHistoryCollection, "",
+		[]string{"user_id", "mode", "result", "ended_at"},
+		[]string{"ended_at"},
+		matchHistoryMaxEntries, false)
+}
+
+// matchHistoryWrites builds the history entry of every player in a finished game.
+// Games that never started leave no history.
+func matchHistoryWrites(record *MatchRecord) []*runtime.StorageWrite {
+	if record.StartedAt == 0 {
+		return nil
+	}
+
+	var writes []*runtime.StorageWrite
+	for _, p := range record.Players {
+		entry := &MatchHistoryEntry{
+			UserId:    p.UserId,
+			MatchId:   record.MatchId,
+			Symbol:    p.Symbol,
+			Mode:      record.GameMode,
+			Result:    rules.ResultFor(p.UserId, record.Winner, record.EndReason),
+			EndReason: record.EndReason,
+			Duration:  record.EndedAt - record.StartedAt,
+			EndedAt:   record.EndedAt,
+		}
+		for _, o := range record.Players {
+			if o.UserId != p.UserId {
+				entry.OpponentId = o.UserId
+				entry.OpponentName = o.Username
+			}
+		}
+
+		entryBytes, _ := json.Marshal(entry)
+		writes = append(writes, &runtime.StorageWrite{
+			Collection:      matchHistoryCollection,
+			Key:             record.MatchId,
+			UserID:          p.UserId,
+			Value:           string(entryBytes),
+			PermissionRead:  1,
+			PermissionWrite: 0,
+		})
+	}
+	return writes
+}
+
+// MatchHistoryPage is a page of history entries and the cursor of the next page
+type MatchHistoryPage struct {
+	Matches []*MatchHistoryEntry `json:"matches"`
+	Cursor  string               `json:"cursor,omitempty"`
+}
+
+// matchHistoryRequest is the payload of ListMyMatches and ListUserMatches
+type matchHistoryRequest struct {
+	UserId string      `json:"user_id"` // ListUserMatches only
+	Mode   GameMode    `json:"mode"`
+	Result MatchResult `json:"result"`
+	Limit  int         `json:"limit"`
+	Cursor string      `json:"cursor"`
+}
+
+// rpcListMyMatches returns the caller's finished games, newest first
+func rpcListMyMatches(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userId, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userId == "" {
+		return "", errNoUserId
+	}
+
+	req, err := parseMatchHistoryRequest(payload)
+	if err != nil {
+		return "", err
+	}
+	return listMatchHistory(ctx, logger, nk, userId, userId, req)
+}
+
+// rpcListUserMatches is the server to server variant of ListMyMatches for any user
+func rpcListUserMatches(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if userId, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string); userId != "" {
+		return "", errPermissionDenied
+	}
+
+	req, err := parseMatchHistoryRequest(payload)
+	if err != nil {
+		return "", err
+	}
+	if req.UserId == "" {
+		return "", errBadInput
+	}
+	return listMatchHistory(ctx, logger, nk, "", req.UserId, req)
+}
+
+// parseMatchHistoryRequest decodes and checks a history request, applying the default page size
+func parseMatchHistoryRequest(payload string) (*matchHistoryRequest, error) {
+	req := &matchHistoryRequest{Limit: 20}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			return nil, errBadInput
+		}
+	}
+	if req.Limit <= 0 || req.Limit > 100 {
+		return nil, errBadInput
+	}
+	switch req.Mode {
+	case "", GameModeClassic, GameModeTimed:
+	default:
+		return nil, errBadInput
+	}
+	switch req.Result {
+	case "", rules.ResultWin, rules.ResultLoss, rules.ResultDraw, rules.ResultVoid:
+	default:
+		return nil, errBadInput
+	}
+	return req, nil
+}
+
+// listMatchHistory pages through the history of userId as callerId sees it, an empty callerId is the server
+func listMatchHistory(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, callerId, userId string, req *matchHistoryRequest) (string, error) {
+	query := fmt.Sprintf("+value.user_id:%q", userId)
+	if req.Mode != "" {
+		query += " +value.mode:" + string(req.Mode)
+	}
+	if req.Result != "" {
+		query += " +value.result:" + string(req.Result)
+	}
+
+	objects, cursor, err := nk.StorageIndexList(ctx, callerId, matchHistoryIndex, query, req.Limit, []string{"-ended_at"}, req.Cursor)
+	if err != nil {
+		logger.Error("StorageIndexList error: %v", err)
+		return "", errInternal
+	}
+
+	page := &MatchHistoryPage{Matches: []*MatchHistoryEntry{}, Cursor: cursor}
+	for _, object := range objects.GetObjects() {
+		var entry MatchHistoryEntry
+		if err := json.Unmarshal([]byte(object.GetValue()), &entry); err != nil {
+			logger.Error("match history unmarshal error: %v", err)
+			continue
+		}
+		page.Matches = append(page.Matches, &entry)
+	}
+
+	respBytes, _ := json.Marshal(page)
+	return string(respBytes), nil
+}
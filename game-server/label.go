@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"tictac/rules"
+)
+
+// MatchLabel is the JSON label of a match, indexed by Nakama so MatchList can query it.
+// Flags are 0 or 1 so they can be matched exactly in label queries.
+type MatchLabel struct {
+	Mode       GameMode   `json:"mode"`
+	Phase      MatchPhase `json:"phase"`
+	Players    int        `json:"players"`
+	Rating     int64      `json:"rating"` // average rating of the seated players
+	Spectators int        `json:"spectators"`
+	Private    int        `json:"private"` // 1 if hidden from the live match browser
+	Open       int        `json:"open"`    // 1 if anyone may take the free seat
+}
+
+// newMatchLabel describes the match as it is now
+func newMatchLabel(matchState *MatchState) *MatchLabel {
+	label := &MatchLabel{
+		Mode:       matchState.GameMode,
+		Phase:      matchState.Phase,
+		Players:    len(matchState.Players),
+		Spectators: len(matchState.Spectators),
+	}
+	if matchState.Private {
+		label.Private = 1
+	}
+	if matchState.Phase == PhaseWaiting && len(matchState.Players) < 2 && len(matchState.Invited) == 0 && !matchState.Private {
+		label.Open = 1
+	}
+
+	var total int64
+	for _, p := range matchState.Players {
+		total += matchState.Ratings[p.GetUserId()]
+	}
+	if len(matchState.Players) > 0 {
+		label.Rating = total / int64(len(matchState.Players))
+	}
+	return label
+}
+
+// encodeLabel renders the label of the match
+func encodeLabel(matchState *MatchState) string {
+	labelBytes, _ := json.Marshal(newMatchLabel(matchState))
+	return string(labelBytes)
+}
+
+// updateLabel pushes the label to Nakama if it changed since the last update
+func updateLabel(logger runtime.Logger, dispatcher runtime.MatchDispatcher, matchState *MatchState) {
+	label := encodeLabel(matchState)
+	if label == matchState.Label {
+		return
+	}
+	if err := dispatcher.MatchLabelUpdate(label); err != nil {
+		logger.Error("Failed to update match label: %v", err)
+		return
+	}
+	matchState.Label = label
+}
+
+// lookupRating returns the player's all-time score in the game mode, or 0 if they have none
+func lookupRating(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, mode GameMode, userId string) int64 {
+	_, ownerRecords, _, _, err := nk.LeaderboardRecordsList(ctx, rules.LeaderboardId(string(mode), rules.PeriodAllTime), []string{userId}, 1, "", 0)
+	if err != nil {
+		logger.Error("Failed to read rating of %s: %v", userId, err)
+		return 0
+	}
+	if len(ownerRecords) == 0 {
+		return 0
+	}
+	return ownerRecords[0].GetScore()
+}
+
+// LiveMatch is one entry returned by ListLiveMatches
+type LiveMatch struct {
+	MatchId string      `json:"match_id"`
+	Size    int32       `json:"size"`
+	Label   *MatchLabel `json:"label"`
+}
+
+// rpcListLiveMatches lists public matches that can be watched ("live") or joined ("open")
+func rpcListLiveMatches(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	req := struct {
+		Kind      string   `json:"kind"`
+		Mode      GameMode `json:"mode"`
+		MinRating *int64   `json:"min_rating"`
+		MaxRating *int64   `json:"max_rating"`
+		Limit     int      `json:"limit"`
+	}{Kind: "live", Limit: 20}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			return "", errBadInput
+		}
+	}
+	if req.Limit <= 0 || req.Limit > 100 {
+		return "", errBadInput
+	}
+
+	query := "+label.private:0"
+	switch req.Kind {
+	case "live":
+		query += " +label.phase:" + string(PhasePlaying)
+	case "open":
+		query += " +label.open:1"
+	default:
+		return "", errBadInput
+	}
+	switch req.Mode {
+	case "":
+	case GameModeClassic, GameModeTimed:
+		query += " +label.mode:" + string(req.Mode)
+	default:
+		return "", errBadInput
+	}
+	if req.MinRating != nil {
+		query += fmt.Sprintf(" +label.rating:>=%d", *req.MinRating)
+	}
+	if req.MaxRating != nil {
+		query += fmt.Sprintf(" +label.rating:<=%d", *req.MaxRating)
+	}
+
+	matches, err := nk.MatchList(ctx, req.Limit, true, "", nil, nil, query)
+	if err != nil {
+		logger.Error("MatchList error: %v", err)
+		return "", errInternal
+	}
+
+	live := []*LiveMatch{}
+	for _, match := range matches {
+		var label MatchLabel
+		if err := json.Unmarshal([]byte(match.GetLabel().GetValue()), &label); err != nil {
+			logger.Error("match label unmarshal error: %v", err)
+			continue
+		}
+		live = append(live, &LiveMatch{
+			MatchId: match.GetMatchId(),
+			Size:    match.GetSize(),
+			Label:   &label,
+		})
+	}
+
+	respBytes, _ := json.Marshal(live)
+	return string(respBytes), nil
+}
+
+// rpcCreateOpenMatch creates a table anyone may sit down at, listed by ListLiveMatches as "open" until both seats
+// are taken. The caller joins it with the returned match ID like any other player, and may set how far behind
+// spectators watch it.
+func rpcCreateOpenMatch(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userId, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userId == "" {
+		return "", errNoUserId
+	}
+
+	req := struct {
+		Mode GameMode `json:"mode"`
+		SpectatorDelay
+	}{Mode: GameModeClassic}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			return "", errBadInput
+		}
+	}
+	switch req.Mode {
+	case GameModeClassic, GameModeTimed:
+	default:
+		return "", errBadInput
+	}
+	if !req.SpectatorDelay.valid() {
+		return "", errBadInput
+	}
+
+	params := map[string]interface{}{"mode": req.Mode}
+	req.SpectatorDelay.addParams(params)
+	matchId, err := nk.MatchCreate(ctx, "lobby_"+string(req.Mode), matchParams(params))
+	if err != nil {
+		logger.Error("MatchCreate error: %v", err)
+		return "", errInternal
+	}
+	logger.Info("User %s opened table %s", userId, matchId)
+
+	respBytes, _ := json.Marshal(map[string]string{"match_id": matchId})
+	return string(respBytes), nil
+}
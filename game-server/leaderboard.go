@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"tictac/rules"
+)
+
+const (
+	// legacyLeaderboardId is the single weekly board used before the per-mode boards, see migrateLegacyLeaderboard
+	legacyLeaderboardId = "TicTacToeLeaderboard"
+
+	migrationCollection  = "migrations"
+	leaderboardMigration = "leaderboard_per_mode"
+)
+
+// leaderboardModes are the game modes that have their own leaderboards
+var leaderboardModes = []GameMode{GameModeClassic, GameModeTimed}
+
+// leaderboardReset returns the reset schedule of a leaderboard period
+func leaderboardReset(period string) string {
+	if period == rules.PeriodWeekly {
+		return "0 0 * * 1"
+	}
+	return ""
+}
+
+// createLeaderboards creates the weekly and all-time board of every game mode.
+// Scores add up, every game adds the points of its result. Ranks are kept so players can see their own.
+func createLeaderboards(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) error {
+	for _, mode := range leaderboardModes {
+		for _, period := range rules.Periods {
+			id := rules.LeaderboardId(string(mode), period)
+			if err := nk.LeaderboardCreate(ctx, id, true, "desc", "incr", leaderboardReset(period), nil, true); err != nil {
+				logger.Error("unable to create leaderboard %s: %v", id, err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeMatchScores adds the points of a finished game to the boards of its mode, for every player who scored
+func writeMatchScores(ctx context.Context, nk runtime.NakamaModule, logger runtime.Logger, record *MatchRecord) {
+	for _, p := range record.Players {
+		result := rules.ResultFor(p.UserId, record.Winner, record.EndReason)
+		points := rules.ResultPoints(string(record.GameMode), result)
+		if points == 0 {
+			continue
+		}
+
+		metadata := map[string]interface{}{
+			"symbol": p.Symbol,
+			"mode":   record.GameMode,
+		}
+		for _, period := range rules.Periods {
+			id := rules.LeaderboardId(string(record.GameMode), period)
+			if _, err := nk.LeaderboardRecordWrite(ctx, id, p.UserId, p.Username, points, 0, metadata, nil); err != nil {
+				logger.Error("Failed to write leaderboard record to %s: %v", id, err)
+				continue
+			}
+		}
+		logger.Info("Wrote leaderboard records for %s: %d points for a %s (%s mode)", p.Username, points, result, record.GameMode)
+	}
+}
+
+// leaderboardMigrationLeaseSec is how long a started migration may go without progress before another start takes it over
+const leaderboardMigrationLeaseSec = 60
+
+// leaderboardMigrationState is the progress of migrateLegacyLeaderboard, stored so a migration that stopped
+// part way resumes where it left off
+type leaderboardMigrationState struct {
+	Status    string                       `json:"status"`           // started or done
+	Cursor    string                       `json:"cursor,omitempty"` // cursor of the legacy page being migrated
+	Index     int                          `json:"index"`            // records of that page already migrated
+	Migrated  int                          `json:"migrated"`
+	Pending   *leaderboardMigrationPending `json:"pending,omitempty"`
+	UpdatedAt int64                        `json:"updated_at"`
+}
+
+// leaderboardMigrationPending is the record being written, with the owner's score before the write,
+// so a resumed migration can tell whether the write landed
+type leaderboardMigrationPending struct {
+	OwnerId string `json:"owner_id"`
+	Id      string `json:"leaderboard_id"`
+	Score   int64  `json:"score"`
+}
+
+// ownerScore returns an owner's score on a leaderboard, 0 if they have no record
+func ownerScore(ctx context.Context, nk runtime.NakamaModule, id, ownerId string) (int64, error) {
+	_, ownerRecords, _, _, err := nk.LeaderboardRecordsList(ctx, id, []string{ownerId}, 1, "", 0)
+	if err != nil {
+		return 0, err
+	}
+	for _, r := range ownerRecords {
+		if r.GetOwnerId() == ownerId {
+			return r.GetScore(), nil
+		}
+	}
+	return 0, nil
+}
+
+// startLegacyLeaderboardMigration runs the migration, and if it could not finish, for example because a migration
+// that stopped in the last leaseholder's hands is not yet free to take over, retries it in the background
+// every lease period until it is done
+func startLegacyLeaderboardMigration(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) {
+	if migrateLegacyLeaderboard(ctx, logger, nk) {
+		return
+	}
+	go func() {
+		for {
+			time.Sleep(leaderboardMigrationLeaseSec * time.Second)
+			if migrateLegacyLeaderboard(ctx, logger, nk) {
+				return
+			}
+		}
+	}()
+}
+
+// migrateLegacyLeaderboard moves the records of the old single leaderboard onto the per-mode all-time boards, once.
+// The old board kept the best single game of the current week, so each record is carried over as one win
+// in the mode it was scored in, and the old board is deleted afterwards. The weekly boards start empty.
+// Progress is saved after every record, so a migration interrupted by a crash or a failed write is resumed by
+// a later attempt without counting any record twice or skipping one. It returns false if the migration still
+// has to be finished, by this or another node.
+func migrateLegacyLeaderboard(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) bool {
+	now := systemClock{}.Now().Unix()
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{
+		Collection: migrationCollection,
+		Key:        leaderboardMigration,
+	}})
+	if err != nil {
+		logger.Error("Failed to read leaderboard migration: %v", err)
+		return false
+	}
+
+	// Claim the migration first so two nodes starting together cannot both add the old points
+	state := &leaderboardMigrationState{}
+	version := "*"
+	if len(objects) > 0 {
+		if err := json.Unmarshal([]byte(objects[0].GetValue()), state); err != nil {
+			logger.Error("Failed to decode leaderboard migration: %v", err)
+			return true // a state we cannot read will not get better by retrying
+		}
+		if state.Status == "done" {
+			return true
+		}
+		if now-state.UpdatedAt < leaderboardMigrationLeaseSec {
+			return false // being migrated elsewhere, or stopped too recently to tell
+		}
+		version = objects[0].GetVersion()
+		logger.Info("=== LEADERBOARD MIGRATION === Resuming after %d records", state.Migrated)
+	}
+	save := func() bool {
+		state.Status = "started"
+		state.UpdatedAt = systemClock{}.Now().Unix()
+		stateBytes, _ := json.Marshal(state)
+		acks, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+			Collection:      migrationCollection,
+			Key:             leaderboardMigration,
+			Value:           string(stateBytes),
+			Version:         version,
+			PermissionRead:  0,
+			PermissionWrite: 0,
+		}})
+		if err != nil {
+			logger.Warn("Leaderboard migration taken over elsewhere, stopping: %v", err)
+			return false
+		}
+		version = acks[0].GetVersion()
+		return true
+	}
+	if !save() {
+		return false
+	}
+
+	// A write that was in flight when the last migration stopped counts once the owner's score has moved
+	if pending := state.Pending; pending != nil {
+		score, err := ownerScore(ctx, nk, pending.Id, pending.OwnerId)
+		if err != nil {
+			logger.Error("Failed to check the interrupted migration of %s: %v", pending.OwnerId, err)
+			return false
+		}
+		if score != pending.Score {
+			state.Index++
+			state.Migrated++
+		}
+		state.Pending = nil
+		if !save() {
+			return false
+		}
+	}
+
+	logger.Info("=== LEADERBOARD MIGRATION === Moving %s records to the per-mode leaderboards", legacyLeaderboardId)
+	for {
+		records, _, next, _, err := nk.LeaderboardRecordsList(ctx, legacyLeaderboardId, nil, 100, state.Cursor, 0)
+		if err != nil {
+			// A new install never had the old board
+			logger.Info("No legacy leaderboard to migrate: %v", err)
+			break
+		}
+		for i, r := range records {
+			if i < state.Index {
+				continue
+			}
+			var meta struct {
+				Symbol string   `json:"Symbol"`
+				Mode   GameMode `json:"Mode"`
+			}
+			if r.GetMetadata() != "" {
+				if err := json.Unmarshal([]byte(r.GetMetadata()), &meta); err != nil {
+					logger.Error("metadata unmarshal error: %v", err)
+				}
+			}
+			// Records without a mode are told apart by the old scores, 1 for classic and 2 for timed
+			if meta.Mode != GameModeClassic && meta.Mode != GameModeTimed {
+				meta.Mode = GameModeClassic
+				if r.GetScore() >= 2 {
+					meta.Mode = GameModeTimed
+				}
+			}
+
+			id := rules.LeaderboardId(string(meta.Mode), rules.PeriodAllTime)
+			score, err := ownerScore(ctx, nk, id, r.GetOwnerId())
+			if err != nil {
+				logger.Error("Failed to read the %s record of %s, stopping the migration: %v", id, r.GetOwnerId(), err)
+				return false
+			}
+			state.Pending = &leaderboardMigrationPending{OwnerId: r.GetOwnerId(), Id: id, Score: score}
+			if !save() {
+				return false
+			}
+
+			// A failed write stops the migration with the record still pending, so the next attempt retries it
+			// and the legacy board is kept until every record is in
+			metadata := map[string]interface{}{"symbol": meta.Symbol, "mode": meta.Mode}
+			if _, err := nk.LeaderboardRecordWrite(ctx, id, r.GetOwnerId(), r.GetUsername().GetValue(), rules.WinPoints(string(meta.Mode)), 0, metadata, nil); err != nil {
+				logger.Error("Failed to migrate leaderboard record of %s to %s, stopping the migration: %v", r.GetOwnerId(), id, err)
+				return false
+			}
+			state.Migrated++
+			state.Pending = nil
+			state.Index = i + 1
+			if !save() {
+				return false
+			}
+		}
+		if next == "" {
+			break
+		}
+		state.Cursor = next
+		state.Index = 0
+	}
+
+	if state.Migrated > 0 {
+		if err := nk.LeaderboardDelete(ctx, legacyLeaderboardId); err != nil {
+			logger.Error("Failed to delete legacy leaderboard: %v", err)
+		}
+	}
+	// Marked done only once every record is in
+	state.Status = "done"
+	state.UpdatedAt = systemClock{}.Now().Unix()
+	stateBytes, _ := json.Marshal(state)
+	if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+		Collection:      migrationCollection,
+		Key:             leaderboardMigration,
+		Value:           string(stateBytes),
+		Version:         version,
+		PermissionRead:  0,
+		PermissionWrite: 0,
+	}}); err != nil {
+		logger.Error("Failed to record leaderboard migration: %v", err)
+		return false
+	}
+	logger.Info("=== LEADERBOARD MIGRATION DONE === Migrated %d records", state.Migrated)
+	return true
+}
+
+// LeaderboardEntry is one record as returned by GetTopPlayers and GetFriendsLeaderboard
+type LeaderboardEntry struct {
+	Rank       int64  `json:"rank"`
+	GlobalRank int64  `json:"global_rank,omitempty"` // rank on the full board, when Rank is within a group
+	OwnerId    string `json:"owner_id"`
+	Username   string `json:"username"`
+	Score      int64  `json:"score"`
+	Symbol     string `json:"symbol,omitempty"` // symbol and mode of the owner's last scoring game
+	Mode       string `json:"mode,omitempty"`
+}
+
+// LeaderboardPage is a page of a leaderboard with the caller's own record, if they have one
+type LeaderboardPage struct {
+	Mode       GameMode            `json:"mode"`
+	Period     string              `json:"period"`
+	Records    []*LeaderboardEntry `json:"records"`
+	Me         *LeaderboardEntry   `json:"me,omitempty"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+	PrevCursor string              `json:"prev_cursor,omitempty"`
+}
+
+// newLeaderboardEntry converts a leaderboard record, decoding the metadata written by writeMatchScores
+func newLeaderboardEntry(logger runtime.Logger, r *api.LeaderboardRecord) *LeaderboardEntry {
+	var meta struct {
+		Symbol string `json:"symbol"`
+		Mode   string `json:"mode"`
+	}
+	if r.GetMetadata() != "" {
+		if err := json.Unmarshal([]byte(r.GetMetadata()), &meta); err != nil {
+			logger.Error("metadata unmarshal error: %v", err)
+		}
+	}
+	return &LeaderboardEntry{
+		Rank:     r.GetRank(),
+		OwnerId:  r.GetOwnerId(),
+		Username: r.GetUsername().GetValue(),
+		Score:    r.GetScore(),
+		Symbol:   meta.Symbol,
+		Mode:     meta.Mode,
+	}
+}
+
+// parseLeaderboardBoard checks the mode and period of a leaderboard request, applying the defaults
+func parseLeaderboardBoard(mode GameMode, period string) (GameMode, string, error) {
+	switch mode {
+	case "":
+		mode = GameModeClassic
+	case GameModeClassic, GameModeTimed:
+	default:
+		return "", "", errBadInput
+	}
+	switch period {
+	case "":
+		period = rules.PeriodAllTime
+	case rules.PeriodWeekly, rules.PeriodAllTime:
+	default:
+		return "", "", errBadInput
+	}
+	return mode, period, nil
+}
+
+// rpcGetTopPlayers returns a page of a leaderboard: from the top, from a cursor, or around an owner.
+// The caller's own record is included even when it is not on the page.
+func rpcGetTopPlayers(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userId, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+
+	req := struct {
+		N           int      `json:"n"`
+		Mode        GameMode `json:"mode"`
+		Period      string   `json:"period"`
+		Cursor      string   `json:"cursor"`
+		AroundOwner string   `json:"around_owner"`
+	}{N: 10}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			return "", errBadInput
+		}
+	}
+	if req.N <= 0 || req.N > 100 {
+		return "", errBadInput
+	}
+	mode, period, err := parseLeaderboardBoard(req.Mode, req.Period)
+	if err != nil {
+		return "", err
+	}
+	id := rules.LeaderboardId(string(mode), period)
+
+	page := &LeaderboardPage{Mode: mode, Period: period, Records: []*LeaderboardEntry{}}
+	var records []*api.LeaderboardRecord
+	if req.AroundOwner != "" {
+		list, err := nk.LeaderboardRecordsHaystack(ctx, id, req.AroundOwner, req.N, req.Cursor, 0)
+		if err != nil {
+			logger.Error("LeaderboardRecordsHaystack error: %v", err)
+			if req.Cursor != "" {
+				return "", errBadInput
+			}
+			return "", errInternal
+		}
+		records, page.NextCursor, page.PrevCursor = list.GetRecords(), list.GetNextCursor(), list.GetPrevCursor()
+	} else {
+		var ownerIds []string
+		if userId != "" {
+			ownerIds = []string{userId}
+		}
+		var ownerRecords []*api.LeaderboardRecord
+		records, ownerRecords, page.NextCursor, page.PrevCursor, err = nk.LeaderboardRecordsList(ctx, id, ownerIds, req.N, req.Cursor, 0)
+		if err != nil {
+			logger.Error("LeaderboardRecordsList error: %v", err)
+			if req.Cursor != "" {
+				return "", errBadInput // a cursor from another board or a tampered one
+			}
+			return "", errInternal
+		}
+		if len(ownerRecords) > 0 {
+			page.Me = newLeaderboardEntry(logger, ownerRecords[0])
+		}
+	}
+
+	for _, r := range records {
+		entry := newLeaderboardEntry(logger, r)
+		page.Records = append(page.Records, entry)
+		if page.Me == nil && userId != "" && entry.OwnerId == userId {
+			page.Me = entry
+		}
+	}
+	if page.Me == nil && userId != "" && req.AroundOwner != "" {
+		_, ownerRecords, _, _, err := nk.LeaderboardRecordsList(ctx, id, []string{userId}, 1, "", 0)
+		if err != nil {
+			logger.Error("LeaderboardRecordsList error: %v", err)
+			return "", errInternal
+		}
+		if len(ownerRecords) > 0 {
+			page.Me = newLeaderboardEntry(logger, ownerRecords[0])
+		}
+	}
+
+	respBytes, _ := json.Marshal(page)
+	return string(respBytes), nil
+}
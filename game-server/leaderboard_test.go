@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"tictac/rules"
+)
+
+// errCrash stands in for the server dying part way through a migration
+var errCrash = errors.New("crash")
+
+// migrationNakama keeps storage objects and leaderboards in memory and can crash on a given leaderboard write
+type migrationNakama struct {
+	runtime.NakamaModule
+	objects   map[string]*api.StorageObject
+	versions  int
+	boards    map[string]map[string]int64
+	legacy    []*api.LeaderboardRecord
+	writes    int
+	crashAt   int  // leaderboard write that crashes, 0 for none
+	crashLate bool // crash after the write landed instead of before
+	failAt    int  // leaderboard write that returns an error without landing, 0 for none
+}
+
+func newMigrationNakama(legacy int) *migrationNakama {
+	nk := &migrationNakama{objects: map[string]*api.StorageObject{}, boards: map[string]map[string]int64{}}
+	for i := 0; i < legacy; i++ {
+		meta := `{"Symbol":"X","Mode":"classic"}`
+		if i%3 == 0 {
+			meta = `{"Symbol":"O","Mode":"timed"}`
+		}
+		nk.legacy = append(nk.legacy, &api.LeaderboardRecord{
+			OwnerId:  fmt.Sprintf("user-%03d", i),
+			Username: wrapperspb.String(fmt.Sprintf("player%d", i)),
+			Score:    1,
+			Metadata: meta,
+		})
+	}
+	return nk
+}
+
+func (nk *migrationNakama) StorageRead(ctx context.Context, reads []*runtime.StorageRead) ([]*api.StorageObject, error) {
+	var objects []*api.StorageObject
+	for _, r := range reads {
+		if o := nk.objects[r.Collection+"/"+r.Key]; o != nil {
+			objects = append(objects, o)
+		}
+	}
+	return objects, nil
+}
+
+func (nk *migrationNakama) StorageWrite(ctx context.Context, writes []*runtime.StorageWrite) ([]*api.StorageObjectAck, error) {
+	var acks []*api.StorageObjectAck
+	for _, w := range writes {
+		key := w.Collection + "/" + w.Key
+		existing := nk.objects[key]
+		if (w.Version == "*" && existing != nil) || (w.Version != "" && w.Version != "*" && (existing == nil || existing.Version != w.Version)) {
+			return nil, errors.New("version check failed")
+		}
+		nk.versions++
+		version := strconv.Itoa(nk.versions)
+		nk.objects[key] = &api.StorageObject{Collection: w.Collection, Key: w.Key, Value: w.Value, Version: version}
+		acks = append(acks, &api.StorageObjectAck{Collection: w.Collection, Key: w.Key, Version: version})
+	}
+	return acks, nil
+}
+
+func (nk *migrationNakama) LeaderboardRecordsList(ctx context.Context, id string, ownerIDs []string, limit int, cursor string, expiry int64) ([]*api.LeaderboardRecord, []*api.LeaderboardRecord, string, string, error) {
+	if id == legacyLeaderboardId {
+		if nk.legacy == nil {
+			return nil, nil, "", "", errors.New("leaderboard not found")
+		}
+		start, _ := strconv.Atoi(cursor)
+		end := min(start+limit, len(nk.legacy))
+		next := ""
+		if end < len(nk.legacy) {
+			next = strconv.Itoa(end)
+		}
+		return nk.legacy[start:end], nil, next, "", nil
+	}
+	var owners []*api.LeaderboardRecord
+	for _, owner := range ownerIDs {
+		if score, ok := nk.boards[id][owner]; ok {
+			owners = append(owners, &api.LeaderboardRecord{LeaderboardId: id, OwnerId: owner, Score: score})
+		}
+	}
+	return nil, owners, "", "", nil
+}
+
+func (nk *migrationNakama) LeaderboardRecordWrite(ctx context.Context, id, ownerID, username string, score, subscore int64, metadata map[string]interface{}, overrideOperator *int) (*api.LeaderboardRecord, error) {
+	nk.writes++
+	if nk.writes == nk.failAt {
+		return nil, errors.New("leaderboard unavailable")
+	}
+	if nk.writes == nk.crashAt && !nk.crashLate {
+		panic(errCrash)
+	}
+	if nk.boards[id] == nil {
+		nk.boards[id] = map[string]int64{}
+	}
+	nk.boards[id][ownerID] += score
+	if nk.writes == nk.crashAt {
+		panic(errCrash)
+	}
+	return &api.LeaderboardRecord{LeaderboardId: id, OwnerId: ownerID, Score: nk.boards[id][ownerID]}, nil
+}
+
+func (nk *migrationNakama) LeaderboardDelete(ctx context.Context, id string) error {
+	if id == legacyLeaderboardId {
+		nk.legacy = nil
+	}
+	return nil
+}
+
+// migrate runs the migration, reporting whether it crashed
+func (nk *migrationNakama) migrate() (crashed bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			if r != errCrash {
+				panic(r)
+			}
+			crashed = true
+		}
+	}()
+	migrateLegacyLeaderboard(context.Background(), testLogger{}, nk)
+	return false
+}
+
+// expireLease ages the stored migration so the next start takes it over, as it would once the lease ran out
+func (nk *migrationNakama) expireLease(t *testing.T) {
+	o := nk.objects[migrationCollection+"/"+leaderboardMigration]
+	var state leaderboardMigrationState
+	if err := json.Unmarshal([]byte(o.Value), &state); err != nil {
+		t.Fatal(err)
+	}
+	state.UpdatedAt = 0
+	value, _ := json.Marshal(state)
+	o.Value = string(value)
+}
+
+func (nk *migrationNakama) status(t *testing.T) leaderboardMigrationState {
+	var state leaderboardMigrationState
+	if err := json.Unmarshal([]byte(nk.objects[migrationCollection+"/"+leaderboardMigration].Value), &state); err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func TestLegacyLeaderboardMigrationResumes(t *testing.T) {
+	const legacy = 250 // three pages of the legacy board
+
+	tests := []struct {
+		name      string
+		crashAt   int
+		crashLate bool
+	}{
+		{"no crash", 0, false},
+		{"crash before a write lands", 130, false},
+		{"crash after a write lands", 130, true},
+		{"crash on the first record", 1, false},
+		{"crash on the last record", legacy, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nk := newMigrationNakama(legacy)
+			nk.crashAt, nk.crashLate = tt.crashAt, tt.crashLate
+
+			if crashed := nk.migrate(); crashed != (tt.crashAt != 0) {
+				t.Fatalf("crashed = %v, want %v", crashed, tt.crashAt != 0)
+			}
+			if tt.crashAt != 0 {
+				if got := nk.status(t).Status; got != "started" {
+					t.Fatalf("status after the crash = %q, want started", got)
+				}
+				// A start within the lease leaves the migration to whoever holds it
+				nk.migrate()
+				if got := nk.status(t).Status; got != "started" {
+					t.Fatalf("status after a start within the lease = %q, want started", got)
+				}
+				nk.expireLease(t)
+				if nk.migrate() {
+					t.Fatal("resumed migration crashed")
+				}
+			}
+
+			state := nk.status(t)
+			if state.Status != "done" || state.Migrated != legacy {
+				t.Fatalf("status %q with %d migrated, want done with %d", state.Status, state.Migrated, legacy)
+			}
+			if nk.legacy != nil {
+				t.Error("legacy leaderboard was not deleted")
+			}
+
+			// Every legacy record is exactly one win on its mode's all-time board
+			for i, r := range newMigrationNakama(legacy).legacy {
+				mode := "classic"
+				if i%3 == 0 {
+					mode = "timed"
+				}
+				id := rules.LeaderboardId(mode, rules.PeriodAllTime)
+				if got, want := nk.boards[id][r.OwnerId], rules.WinPoints(mode); got != want {
+					t.Errorf("%s has %d on %s, want %d", r.OwnerId, got, id, want)
+				}
+			}
+			for id := range nk.boards {
+				for _, mode := range leaderboardModes {
+					if id == rules.LeaderboardId(string(mode), rules.PeriodWeekly) {
+						t.Errorf("migration wrote to the weekly board %s", id)
+					}
+				}
+			}
+
+			// Starting again once done changes nothing
+			writes := nk.writes
+			nk.migrate()
+			if nk.writes != writes {
+				t.Errorf("a start after the migration finished made %d more writes", nk.writes-writes)
+			}
+		})
+	}
+}
+
+func TestLegacyLeaderboardMigrationRetriesFailedWrites(t *testing.T) {
+	const legacy = 150
+
+	nk := newMigrationNakama(legacy)
+	nk.failAt = 120
+	if migrateLegacyLeaderboard(context.Background(), testLogger{}, nk) {
+		t.Fatal("migration with a failed write reported it was finished")
+	}
+	state := nk.status(t)
+	if state.Status != "started" || state.Pending == nil || state.Migrated != nk.failAt-1 {
+		t.Fatalf("after the failed write: status %q, pending %v, %d migrated, want started with record %d pending",
+			state.Status, state.Pending, state.Migrated, nk.failAt)
+	}
+	if nk.legacy == nil {
+		t.Fatal("legacy leaderboard deleted with a record not migrated")
+	}
+
+	// The retry once the lease runs out writes the failed record and finishes
+	nk.expireLease(t)
+	if !migrateLegacyLeaderboard(context.Background(), testLogger{}, nk) {
+		t.Fatal("retried migration did not finish")
+	}
+	if state := nk.status(t); state.Status != "done" || state.Migrated != legacy {
+		t.Fatalf("status %q with %d migrated, want done with %d", state.Status, state.Migrated, legacy)
+	}
+	if nk.legacy != nil {
+		t.Error("legacy leaderboard was not deleted")
+	}
+	for i, r := range newMigrationNakama(legacy).legacy {
+		mode := "classic"
+		if i%3 == 0 {
+			mode = "timed"
+		}
+		id := rules.LeaderboardId(mode, rules.PeriodAllTime)
+		if got, want := nk.boards[id][r.OwnerId], rules.WinPoints(mode); got != want {
+			t.Errorf("%s has %d on %s, want %d", r.OwnerId, got, id, want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"tictac/rules"
+)
+
+// EndReason describes why a match ended, the reasons are defined in the rules package so the tools share them
+type EndReason = rules.EndReason
+
+// endGame marks the game as finished, adds the result to the leaderboards and persists the outcome.
+// Callers broadcast their own game over message first.
+func (m *Match) endGame(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, matchState *MatchState, winner string, reason EndReason) {
+	flushSpectatorFeed(dispatcher, matchState)
+
+	matchState.GameEnded = true
+	matchState.Winner = winner
+	matchState.EndReason = reason
+	matchState.EndedTick = tick
+	matchState.EndedAt = m.clock.Now().Unix()
+	setPhase(logger, dispatcher, matchState, PhaseFinished)
+
+	logger.Info("=== GAME ENDED === reason: %s, winner: %q", reason, winner)
+
+	matchId, _ := ctx.Value(runtime.RUNTIME_CTX_MATCH_ID).(string)
+	record := m.newMatchRecord(matchId, matchState)
+	writeMatchScores(ctx, nk, logger, record)
+	m.persistMatchRecord(ctx, nk, logger, matchState)
+	if record.Tournament != nil {
+		reportTournamentResult(ctx, logger, nk, record)
+	}
+}
+
+// shouldTerminate decides whether the match has run its course and records why
+func (m *Match) shouldTerminate(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, matchState *MatchState) bool {
+	// Finished games stay open a little while so players can see the result
+	if matchState.GameEnded {
+		if countConnected(matchState) == 0 {
+			logger.Info("All players left the finished match")
+			return true
+		}
+		return tick-matchState.EndedTick >= int64(m.config.EndLingerSec*m.tickRate)
+	}
+
+	if matchState.Phase == PhaseWaiting && matchState.HadPlayers && len(matchState.Players) == 0 {
+		logger.Info("All players left before the game started")
+		m.endGame(ctx, logger, nk, dispatcher, tick, matchState, "", rules.EndReasonAbandoned)
+		return true
+	}
+
+	if tick-matchState.LastActivityTick >= int64(m.config.IdleLimitSec*m.tickRate) {
+		logger.Info("Match idle since tick %d, closing", matchState.LastActivityTick)
+		m.endGame(ctx, logger, nk, dispatcher, tick, matchState, "", rules.EndReasonIdle)
+		return true
+	}
+
+	return false
+}
+
+// checkGameDeadline ends a game still being played when its time is up, deciding it by perfect play.
+// Reports whether the game ended.
+func (m *Match) checkGameDeadline(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, matchState *MatchState) bool {
+	if matchState.GameDeadlineTick == 0 || tick < matchState.GameDeadlineTick {
+		return false
+	}
+
+	winner := adjudicatedWinner(matchState)
+	logger.Info("Game reached its %ds limit, adjudicated winner: %q", matchState.MaxGameSec, winner)
+	broadcast(dispatcher, matchState, OpCodeGameOver, &GameOverMessage{
+		Message:      "Time limit reached, the game is decided by perfect play",
+		WinnerId:     winner,
+		EndReason:    rules.EndReasonAdjudicated,
+		BoardState:   matchState.TicTacToe,
+		GameMode:     matchState.GameMode,
+		StateVersion: nextStateVersion(matchState),
+	}, nil)
+
+	m.endGame(ctx, logger, nk, dispatcher, tick, matchState, winner, rules.EndReasonAdjudicated)
+	return true
+}
+
+// adjudicatedWinner returns the player who wins the position with perfect play, empty for a draw
+func adjudicatedWinner(matchState *MatchState) string {
+	symbol := rules.Adjudicate(matchState.TicTacToe)
+	if symbol == "" {
+		return ""
+	}
+	for userId, s := range matchState.PlayerSymbols {
+		if s == symbol {
+			return userId
+		}
+	}
+	return ""
+}
+
+// sendFinalResults tells everyone still in the match how it ended before it closes
+func sendFinalResults(dispatcher runtime.MatchDispatcher, matchState *MatchState) {
+	broadcast(dispatcher, matchState, OpCodeMatchClosed, &MatchClosedMessage{
+		Message:       "Match closed",
+		WinnerId:      matchState.Winner,
+		EndReason:     matchState.EndReason,
+		BoardState:    matchState.TicTacToe,
+		PlayerSymbols: matchState.PlayerSymbols,
+		GameMode:      matchState.GameMode,
+	}, nil)
+}
+
+// countConnected returns the number of seated players who are currently connected
+func countConnected(matchState *MatchState) int {
+	return len(matchState.Players) - len(matchState.Disconnected)
+}
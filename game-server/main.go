@@ -3,17 +3,22 @@ package main
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 
 	"github.com/heroiclabs/nakama-common/rtapi"
 	"github.com/heroiclabs/nakama-common/runtime"
 )
 
 var (
-	errInternal = runtime.NewError("internal server error", 13)
+	errInternal         = runtime.NewError("internal server error", 13)
+	errBadInput         = runtime.NewError("input contained invalid data", 3)
+	errNotFound         = runtime.NewError("not found", 5)
+	errNoUserId         = runtime.NewError("no user ID in context", 16)
+	errPermissionDenied = runtime.NewError("permission denied", 7)
 )
 
 func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	config := loadMatchConfig(ctx, logger)
+
 	initializer.RegisterBeforeRt("MatchmakerAdd", func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, in *rtapi.Envelope) (*rtapi.Envelope, error) {
 		req, ok := in.Message.(*rtapi.Envelope_MatchmakerAdd)
 		if !ok {
@@ -53,9 +58,14 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 			}
 		}
 
+		invited := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			invited = append(invited, entry.GetPresence().GetUserId())
+		}
+
 		logger.Info("Creating match for game mode: %s with %d players", gameMode, len(entries))
 		matchLabel := "lobby_" + gameMode
-		matchId, err := nk.MatchCreate(ctx, matchLabel, map[string]interface{}{"mode": gameMode, "invited": entries})
+		matchId, err := nk.MatchCreate(ctx, matchLabel, matchParams(map[string]interface{}{"mode": gameMode, "invited": invited}))
 		if err != nil {
 			return "", err
 		}
@@ -68,7 +78,7 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 	// Register match handlers for each game mode
 	if err := initializer.RegisterMatch("lobby_classic", func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule) (runtime.Match, error) {
 		logger.Info("=== CREATING NEW CLASSIC MATCH INSTANCE ===")
-		match := NewMatchWithMode("classic")
+		match := NewMatchWithMode(GameModeClassic, config)
 		logger.Info("=== CLASSIC MATCH INSTANCE CREATED SUCCESSFULLY ===")
 		return match, nil
 	}); err != nil {
@@ -78,7 +88,7 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 
 	if err := initializer.RegisterMatch("lobby_timed", func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule) (runtime.Match, error) {
 		logger.Info("=== CREATING NEW TIMED MATCH INSTANCE ===")
-		match := NewMatchWithMode("timed")
+		match := NewMatchWithMode(GameModeTimed, config)
 		logger.Info("=== TIMED MATCH INSTANCE CREATED SUCCESSFULLY ===")
 		return match, nil
 	}); err != nil {
@@ -86,67 +96,120 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 		return err
 	}
 
-	id := "TicTacToeLeaderboard"
-	authoritative := true
-	sort := "desc"
-	operator := "best"
-	reset := "0 0 * * 1"
+	if err := createLeaderboards(ctx, logger, nk); err != nil {
+		return err
+	}
+	startLegacyLeaderboardMigration(ctx, logger, nk)
 
-	if err := nk.LeaderboardCreate(ctx, id, authoritative, sort, operator, reset, nil, false); err != nil {
-		logger.Error("unable to create leaderboard: %v", err)
+	if err := initializer.RegisterRpc("GetTopPlayers", rpcGetTopPlayers); err != nil {
+		logger.Error("unable to register GetTopPlayers RPC: %v", err)
+		return err
 	}
 
-	// Register RPC for top N leaderboard
-	if err := initializer.RegisterRpc("GetTopPlayers", func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if err := initializer.RegisterRpc("GetFriendsLeaderboard", rpcGetFriendsLeaderboard); err != nil {
+		logger.Error("unable to register GetFriendsLeaderboard RPC: %v", err)
+		return err
+	}
 
-		n := 10
-		if payload != "" {
-			var req struct {
-				N int `json:"n"`
-			}
-			if err := json.Unmarshal([]byte(payload), &req); err == nil && req.N > 0 {
-				n = req.N
-			}
-		}
-		// Fetch top N records
-		records, _, _, _, err := nk.LeaderboardRecordsList(ctx, "TicTacToeLeaderboard", nil, n, "", 0)
-		if err != nil {
-			logger.Error("LeaderboardRecordsList error: %v", err)
-			return "{}", errInternal
-		}
-		// Prepare response
-		type Player struct {
-			Username string `json:"username"`
-			OwnerId  string `json:"owner_id"`
-			Score    int64  `json:"score"`
-			Symbol   string `json:"symbol,omitempty"`
-			Mode     string `json:"mode,omitempty"`
-		}
+	if err := initializer.RegisterRpc("ListRestorableMatches", rpcListRestorableMatches); err != nil {
+		logger.Error("unable to register ListRestorableMatches RPC: %v", err)
+		return err
+	}
 
-		type Metadata struct {
-			Symbol string `json:"symbol"`
-			Mode   string `json:"mode"`
-		}
-		var players []Player
-		for _, r := range records {
-			var meta Metadata
-			if r.GetMetadata() != "" {
-				if err := json.Unmarshal([]byte(r.GetMetadata()), &meta); err != nil {
-					logger.Error("metadata unmarshal error: %v", err)
-				}
-			}
-			players = append(players, Player{
-				Username: r.GetUsername().GetValue(),
-				OwnerId:  r.GetOwnerId(),
-				Score:    r.GetScore(),
-				Symbol:   meta.Symbol,
-				Mode:     meta.Mode,
-			})
-		}
-		respBytes, _ := json.Marshal(players)
-		return string(respBytes), nil
+	if err := initializer.RegisterRpc("RestoreMatch", rpcRestoreMatch); err != nil {
+		logger.Error("unable to register RestoreMatch RPC: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterRpc("ListLiveMatches", rpcListLiveMatches); err != nil {
+		logger.Error("unable to register ListLiveMatches RPC: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterRpc("CreateOpenMatch", rpcCreateOpenMatch); err != nil {
+		logger.Error("unable to register CreateOpenMatch RPC: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterRpc("GetReplay", rpcGetReplay); err != nil {
+		logger.Error("unable to register GetReplay RPC: %v", err)
+		return err
+	}
+
+	if err := registerMatchHistoryIndex(initializer); err != nil {
+		logger.Error("unable to register match history index: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterRpc("ListMyMatches", rpcListMyMatches); err != nil {
+		logger.Error("unable to register ListMyMatches RPC: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterRpc("ListUserMatches", rpcListUserMatches); err != nil {
+		logger.Error("unable to register ListUserMatches RPC: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterRpc("ExportMatch", rpcExportMatch); err != nil {
+		logger.Error("unable to register ExportMatch RPC: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterRpc("ImportNotation", rpcImportNotation); err != nil {
+		logger.Error("unable to register ImportNotation RPC: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterRpc("GetPlayerStats", rpcGetPlayerStats); err != nil {
+		logger.Error("unable to register GetPlayerStats RPC: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterMatch(tournamentDirectorModule, func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule) (runtime.Match, error) {
+		return NewTournamentDirector(), nil
 	}); err != nil {
-		logger.Error("unable to register GetTopPlayers RPC: %v", err)
+		logger.Error("unable to register tournament director: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterRpc("CreateBracketTournament", rpcCreateBracketTournament); err != nil {
+		logger.Error("unable to register CreateBracketTournament RPC: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterRpc("CreateSwissTournament", rpcCreateSwissTournament); err != nil {
+		logger.Error("unable to register CreateSwissTournament RPC: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterRpc("CreateArenaTournament", rpcCreateArenaTournament); err != nil {
+		logger.Error("unable to register CreateArenaTournament RPC: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterRpc("JoinTournament", rpcJoinTournament); err != nil {
+		logger.Error("unable to register JoinTournament RPC: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterRpc("GetTournament", rpcGetTournament); err != nil {
+		logger.Error("unable to register GetTournament RPC: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterRpc("GetTournamentStandings", rpcGetTournamentStandings); err != nil {
+		logger.Error("unable to register GetTournamentStandings RPC: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterTournamentEnd(tournamentEndHook); err != nil {
+		logger.Error("unable to register tournament end hook: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterShutdown(shutdownHook); err != nil {
+		logger.Error("unable to register shutdown hook: %v", err)
 		return err
 	}
 
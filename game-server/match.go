@@ -5,10 +5,10 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"time"
+	"slices"
 
 	"github.com/heroiclabs/nakama-common/runtime"
-	"google.golang.org/protobuf/encoding/protojson"
+	"tictac/rules"
 )
 
 // GameMode represents different game modes
@@ -19,74 +19,137 @@ const (
 	GameModeTimed   GameMode = "timed"
 )
 
+// timedTurnLimitSec is how long a player has for each move in timed mode
+const timedTurnLimitSec = 30
+
 // MatchState represents the persistent state of the match
 type MatchState struct {
 	Players       []runtime.Presence `json:"players"`
-	PlayerActions map[string][]byte  `json:"player_actions"`
 	TicTacToe     [9]string          `json:"tictactoe"`
 	PlayerSymbols map[string]string  `json:"player_symbols"`
 	CurrentTurn   string             `json:"current_turn"`
 	GameStarted   bool               `json:"game_started"`
+	Phase         MatchPhase         `json:"phase"`
 	GameEnded     bool               `json:"game_ended"`
 	Winner        string             `json:"winner,omitempty"`
 
+	// Matchmaker reservation
+	Invited             []string `json:"invited,omitempty"`              // user IDs allowed to join, empty means open
+	ReservationDeadline int64    `json:"reservation_deadline,omitempty"` // tick by which all invited players must have joined
+
+	// Seats taken by players who passed the join attempt but have not joined yet, by session ID
+	PendingPlayers map[string]*PendingSeat `json:"pending_players"`
+
+	// Tournament the game belongs to, nil for casual games
+	Tournament      *TournamentRef    `json:"tournament,omitempty"`
+	AssignedSymbols map[string]string `json:"assigned_symbols,omitempty"` // user ID to the symbol they must play
+
+	// Live match browser
+	Private bool             `json:"private"` // hidden from ListLiveMatches and never listed as open, joined by match ID
+	Ratings map[string]int64 `json:"ratings"` // user ID to rating at join
+	Label   string           `json:"label"`   // last label pushed to Nakama
+
+	// Replay
+	Restored   bool        `json:"restored"`
+	StartBoard [9]string   `json:"start_board"` // position the game started from, empty unless restored or imported
+	Moves      []MatchMove `json:"moves"`
+
+	// Move sequencing, every accepted move bumps the board version
+	BoardVersion int64            `json:"board_version"`
+	LastSeq      map[string]int64 `json:"last_seq"` // highest accepted sequence number per user
+
+	// Bumped on every broadcast state change so clients can detect missed messages
+	StateVersion int64 `json:"state_version"`
+
+	// Spectators watch without a seat, pending ones have passed the join attempt but not joined yet
+	Spectators        []runtime.Presence `json:"spectators"`
+	PendingSpectators map[string]bool    `json:"pending_spectators"` // session IDs
+
+	// Spectators lag this many moves and seconds behind the players, queued broadcasts wait in the feed
+	SpectatorDelayMoves int                   `json:"spectator_delay_moves"`
+	SpectatorDelaySec   int                   `json:"spectator_delay_seconds"`
+	SpectatorFeed       []*SpectatorFeedEntry `json:"-"`
+	SpectatorView       *StateSyncMessage     `json:"-"` // state after the last released entry
+
+	// Wire format per session ID, sessions not listed use JSON
+	Encodings map[string]Encoding `json:"encodings"`
+
+	// Flood protection, session ID to token bucket
+	RateBuckets map[string]*RateBucket `json:"rate_buckets"`
+
+	// Seats held for disconnected players, user ID to the tick they left
+	Disconnected map[string]int64 `json:"disconnected"`
+
+	// Lifecycle
+	HadPlayers       bool      `json:"had_players"`                  // someone has joined at least once
+	LastActivityTick int64     `json:"last_activity_tick"`           // tick of the last join, leave or accepted move
+	EndReason        EndReason `json:"end_reason,omitempty"`         // why the game ended
+	EndedTick        int64     `json:"ended_tick,omitempty"`         // tick the game ended on
+	StartedAt        int64     `json:"started_at,omitempty"`         // unix time play started
+	MaxGameSec       int       `json:"max_game_seconds,omitempty"`   // longest the game may be played for, 0 for no limit
+	GameDeadlineTick int64     `json:"game_deadline_tick,omitempty"` // tick on which an unfinished game is adjudicated
+	EndedAt          int64     `json:"ended_at,omitempty"`           // unix time the game ended
+	Persisted        bool      `json:"persisted"`                    // match record has been written to storage
+
 	// Game mode specific fields
 	GameMode         GameMode `json:"game_mode"`
 	TurnTimeLimit    int64    `json:"turn_time_limit,omitempty"`    // seconds per turn
-	CurrentTurnStart int64    `json:"current_turn_start,omitempty"` // timestamp when current turn started
+	TurnDeadlineTick int64    `json:"turn_deadline_tick,omitempty"` // tick on which the current turn times out
 	TimeRemaining    int64    `json:"time_remaining,omitempty"`     // seconds remaining for current turn
 }
 
 // Match represents our custom match implementation (now just configuration)
 type Match struct {
-	matchLabel  string
-	tickRate    int
-	gameMode    GameMode
-	marshaler   *protojson.MarshalOptions
-	unmarshaler *protojson.UnmarshalOptions
+	tickRate int
+	gameMode GameMode
+	config   *MatchConfig
+	clock    Clock
 }
 
 func NewMatch() *Match {
 	return &Match{
-		matchLabel: "lobby",
-		tickRate:   10,
-		gameMode:   GameModeClassic,
-		marshaler: &protojson.MarshalOptions{
-			UseEnumNumbers: true,
-		},
-		unmarshaler: &protojson.UnmarshalOptions{
-			DiscardUnknown: false,
-		},
+		tickRate: 10,
+		gameMode: GameModeClassic,
+		config:   defaultMatchConfig(),
+		clock:    systemClock{},
 	}
 }
 
-// NewMatchWithMode creates a match with specific game mode
-func NewMatchWithMode(mode GameMode) *Match {
+// NewMatchWithMode creates a match with specific game mode and server config
+func NewMatchWithMode(mode GameMode, config *MatchConfig) *Match {
 	match := NewMatch()
 	match.gameMode = mode
-	match.matchLabel = fmt.Sprintf("lobby_%s", mode)
+	match.config = config
 	return match
 }
 
 // newMatchState creates a new initial match state
 func newMatchState(gameMode GameMode) *MatchState {
 	state := &MatchState{
-		Players:       []runtime.Presence{},
-		PlayerActions: make(map[string][]byte),
-		TicTacToe:     [9]string{"", "", "", "", "", "", "", "", ""},
-		PlayerSymbols: make(map[string]string),
-		CurrentTurn:   "",
-		GameStarted:   false,
-		GameEnded:     false,
-		Winner:        "",
-		GameMode:      gameMode,
+		Players:           []runtime.Presence{},
+		TicTacToe:         [9]string{"", "", "", "", "", "", "", "", ""},
+		PlayerSymbols:     make(map[string]string),
+		LastSeq:           make(map[string]int64),
+		Disconnected:      make(map[string]int64),
+		RateBuckets:       make(map[string]*RateBucket),
+		Encodings:         make(map[string]Encoding),
+		Spectators:        []runtime.Presence{},
+		PendingSpectators: make(map[string]bool),
+		PendingPlayers:    make(map[string]*PendingSeat),
+		Ratings:           make(map[string]int64),
+		CurrentTurn:       "",
+		GameStarted:       false,
+		Phase:             PhaseWaiting,
+		GameEnded:         false,
+		Winner:            "",
+		GameMode:          gameMode,
 	}
 
 	// Set timed mode specific settings
 	if gameMode == GameModeTimed {
-		state.TurnTimeLimit = 30 // 30 seconds per turn
-		state.CurrentTurnStart = 0
-		state.TimeRemaining = 30
+		state.TurnTimeLimit = timedTurnLimitSec
+		state.TurnDeadlineTick = 0
+		state.TimeRemaining = timedTurnLimitSec
 	}
 
 	return state
@@ -105,22 +168,11 @@ func getMatchState(state interface{}) *MatchState {
 	return newMatchState(GameModeClassic)
 }
 
-var gameWin = [8][3]int{
-	{0, 1, 2}, // Rows
-	{3, 4, 5},
-	{6, 7, 8},
-	{0, 3, 6}, // Columns
-	{1, 4, 7},
-	{2, 5, 8},
-	{0, 4, 8}, // Diagonals
-	{2, 4, 6},
-}
-
 // MatchInit initializes the match
 // MatchInit initializes the match
 func (m *Match) MatchInit(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, params map[string]interface{}) (interface{}, int, string) {
 	logger.Info("=== MATCH INITIALIZED ===")
-	logger.Info("Match created with tick rate: %d, label: %s", m.tickRate, m.matchLabel)
+	logger.Info("Match created with tick rate: %d", m.tickRate)
 	logger.Info("Match creation params: %v", params)
 
 	// Check if game mode is specified in params
@@ -134,14 +186,97 @@ func (m *Match) MatchInit(ctx context.Context, logger runtime.Logger, db *sql.DB
 
 	// Return initial match state with the specified game mode
 	initialState := newMatchState(gameMode)
-	logger.Info("Match initialized with mode: %s", initialState.GameMode)
-	return initialState, m.tickRate, m.matchLabel
+
+	// Put an interrupted game back where it stopped
+	if snapshot, ok := snapshotParam(logger, params); ok {
+		restoreSnapshot(initialState, snapshot)
+		initialState.Restored = true
+		initialState.StartBoard = snapshot.Board
+		logger.Info("Restoring snapshot of match %s", snapshot.MatchId)
+	} else if paramInto(params, "start_board", &initialState.StartBoard) {
+		// Custom game from an imported position
+		initialState.TicTacToe = initialState.StartBoard
+		logger.Info("Starting from position %v", initialState.StartBoard)
+	}
+
+	// Only matchmade players may take a seat, and only for a limited time
+	initialState.Invited = invitedUserIds(params)
+	if len(initialState.Invited) > 0 {
+		reservationSec := intParam(params, "reservation_seconds", m.config.InviteReservationSec)
+		initialState.ReservationDeadline = int64(reservationSec * m.tickRate)
+		logger.Info("Seats reserved for %v until tick %d", initialState.Invited, initialState.ReservationDeadline)
+	}
+
+	initialState.Private, _ = params["private"].(bool)
+	var ref TournamentRef
+	if paramInto(params, "tournament", &ref) {
+		initialState.Tournament = &ref
+	}
+	paramInto(params, "symbols", &initialState.AssignedSymbols)
+
+	// Per match spectator delay, falling back to the server default
+	initialState.SpectatorDelayMoves = intParam(params, "spectator_delay_moves", m.config.SpectatorDelayMoves)
+	initialState.SpectatorDelaySec = intParam(params, "spectator_delay_seconds", m.config.SpectatorDelaySec)
+	initialState.SpectatorView = newStateSyncMessage("", initialState)
+
+	// Tournaments that must know when their games are over cap how long they are played
+	initialState.MaxGameSec = intParam(params, "max_game_seconds", 0)
+
+	initialState.Label = encodeLabel(initialState)
+	logger.Info("Match initialized with mode: %s, label: %s", initialState.GameMode, initialState.Label)
+	return initialState, m.tickRate, initialState.Label
 }
 
 // MatchJoinAttempt is called when a user attempts to join the match
 func (m *Match) MatchJoinAttempt(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, presence runtime.Presence, metadata map[string]string) (interface{}, bool, string) {
 	logger.Info("=== MATCH JOIN ATTEMPT === Player %s attempting to join match", presence.GetUserId())
-	return state, true, ""
+
+	matchState := getMatchState(state)
+
+	if !checkProtocolVersion(metadata) {
+		logger.Info("Rejected player %s: protocol version %q", presence.GetUserId(), metadata[protocolVersionMetadata])
+		return matchState, false, fmt.Sprintf("incompatible protocol version, server speaks %d to %d", MinimumProtocolVersion, ProtocolVersion)
+	}
+
+	encoding, ok := parseEncoding(metadata)
+	if !ok {
+		logger.Info("Rejected player %s: encoding %q", presence.GetUserId(), metadata[encodingMetadata])
+		return matchState, false, "unsupported encoding, use json or protobuf"
+	}
+
+	role, ok := parseRole(metadata)
+	if !ok {
+		logger.Info("Rejected player %s: role %q", presence.GetUserId(), metadata[roleMetadata])
+		return matchState, false, "unsupported role, use player or spectator"
+	}
+
+	// Spectators need no invitation or free seat, but a seated player cannot watch their own game
+	if role == RoleSpectator {
+		if isPlayer(presence.GetUserId(), matchState) {
+			logger.Info("Rejected spectator %s: already a player", presence.GetUserId())
+			return matchState, false, "already a player in this match"
+		}
+		matchState.Encodings[presence.GetSessionId()] = encoding
+		matchState.PendingSpectators[presence.GetSessionId()] = true
+		return matchState, true, ""
+	}
+
+	if len(matchState.Invited) > 0 && !slices.Contains(matchState.Invited, presence.GetUserId()) {
+		logger.Info("Rejected player %s: not invited", presence.GetUserId())
+		return matchState, false, "not invited to this match"
+	}
+
+	if !isPlayer(presence.GetUserId(), matchState) {
+		if len(matchState.Players)+pendingSeats(matchState, tick, m.tickRate, presence.GetUserId()) >= 2 {
+			logger.Info("Rejected player %s: match is full", presence.GetUserId())
+			return matchState, false, "match is full"
+		}
+		// Hold the seat until the join lands, so a concurrent attempt cannot take it too
+		matchState.PendingPlayers[presence.GetSessionId()] = &PendingSeat{UserId: presence.GetUserId(), Tick: tick}
+	}
+
+	matchState.Encodings[presence.GetSessionId()] = encoding
+	return matchState, true, ""
 }
 
 // MatchJoin is called when a user successfully joins the match
@@ -153,80 +288,96 @@ func (m *Match) MatchJoin(ctx context.Context, logger runtime.Logger, db *sql.DB
 
 	// Add all new players to our list first
 	for _, presence := range presences {
-		// Prevent duplicate entries
-		for _, p := range matchState.Players {
-			if p.GetUserId() == presence.GetUserId() {
+		if matchState.PendingSpectators[presence.GetSessionId()] {
+			addSpectator(logger, dispatcher, matchState, presence)
+			continue
+		}
+		delete(matchState.PendingPlayers, presence.GetSessionId())
+		matchState.HadPlayers = true
+		matchState.LastActivityTick = tick
+
+		// Returning players take back their held seat
+		if replacePresence(matchState, presence) {
+			if _, away := matchState.Disconnected[presence.GetUserId()]; away {
+				m.reconnectPlayer(logger, dispatcher, matchState, presence)
+			} else {
 				logger.Info("Player %s already in match, skipping", presence.GetUserId())
-				continue
 			}
+			continue
 		}
 		matchState.Players = append(matchState.Players, presence)
+		matchState.Ratings[presence.GetUserId()] = lookupRating(ctx, logger, nk, matchState.GameMode, presence.GetUserId())
 		logger.Info("=== PLAYER JOINED === Player %s joined match (total players: %d)", presence.GetUserId(), len(matchState.Players))
 	}
 
-	// Assign symbols to players if not already assigned
-	if len(matchState.Players) == 2 {
+	// Assign symbols to players once both seats are filled
+	if matchState.Phase == PhaseWaiting && len(matchState.Players) == 2 {
 		symbols := []string{"X", "O"}
 		for i, player := range matchState.Players {
 			if _, exists := matchState.PlayerSymbols[player.GetUserId()]; !exists {
-				matchState.PlayerSymbols[player.GetUserId()] = symbols[i%2]
-				logger.Info("Assigned symbol %s to player %s", symbols[i%2], player.GetUserId())
-				// Set the first player to join as the current turn
-				if matchState.CurrentTurn == "" {
+				symbol := symbols[i%2]
+				if assigned, ok := matchState.AssignedSymbols[player.GetUserId()]; ok {
+					symbol = assigned
+				}
+				matchState.PlayerSymbols[player.GetUserId()] = symbol
+				logger.Info("Assigned symbol %s to player %s", symbol, player.GetUserId())
+				// The side to move starts, X unless the game began from a position
+				if matchState.CurrentTurn == "" && symbol == rules.SideToMove(matchState.TicTacToe) {
 					matchState.CurrentTurn = player.GetUserId()
 					logger.Info("It's now player %s's turn", matchState.CurrentTurn)
-
-					// Start timer for timed mode
-					if matchState.GameMode == GameModeTimed {
-						matchState.CurrentTurnStart = time.Now().Unix()
-						matchState.TimeRemaining = matchState.TurnTimeLimit
-						logger.Info("Started timer for timed mode: %d seconds", matchState.TurnTimeLimit)
-					}
 				}
 			}
 		}
 
 		// Send messages to players
+		stateVersion := nextStateVersion(matchState)
 		for _, presence := range matchState.Players {
 			// Welcome message
-			messageData := map[string]interface{}{
-				"message":      fmt.Sprintf("Welcome to %s mode!", matchState.GameMode),
-				"player_count": len(matchState.Players),
-				"game_mode":    matchState.GameMode,
+			welcome := &WelcomeMessage{
+				Message:         fmt.Sprintf("Welcome to %s mode!", matchState.GameMode),
+				PlayerCount:     len(matchState.Players),
+				GameMode:        matchState.GameMode,
+				ProtocolVersion: ProtocolVersion,
 			}
 
 			// Add timed mode specific info
 			if matchState.GameMode == GameModeTimed {
-				messageData["turn_time_limit"] = matchState.TurnTimeLimit
+				welcome.TurnTimeLimit = matchState.TurnTimeLimit
 			}
 
-			messageBytes, _ := json.Marshal(messageData)
-			dispatcher.BroadcastMessage(1, messageBytes, []runtime.Presence{presence}, nil, true)
+			broadcast(dispatcher, matchState, OpCodeWelcome, welcome, []runtime.Presence{presence})
 
 			// Game state announcement
-			announceData := map[string]interface{}{
-				"message":       "New player joined!",
-				"user_id":       presence.GetUserId(),
-				"username":      presence.GetUsername(),
-				"total_players": len(matchState.Players),
-				"opponent":      getOpponentName(presence.GetUserId(), matchState),
-				"current_turn":  matchState.CurrentTurn,
-				"board_state":   matchState.TicTacToe,
-				"symbol":        matchState.PlayerSymbols[presence.GetUserId()],
-				"game_mode":     matchState.GameMode,
+			announce := &PlayerJoinedMessage{
+				Message:      "New player joined!",
+				UserId:       presence.GetUserId(),
+				Username:     presence.GetUsername(),
+				TotalPlayers: len(matchState.Players),
+				Opponent:     getOpponentName(presence.GetUserId(), matchState),
+				CurrentTurn:  matchState.CurrentTurn,
+				BoardState:   matchState.TicTacToe,
+				BoardVersion: matchState.BoardVersion,
+				Symbol:       matchState.PlayerSymbols[presence.GetUserId()],
+				GameMode:     matchState.GameMode,
+				StateVersion: stateVersion,
 			}
 
 			// Add timed mode specific data
 			if matchState.GameMode == GameModeTimed {
-				announceData["turn_time_limit"] = matchState.TurnTimeLimit
-				announceData["time_remaining"] = matchState.TimeRemaining
+				announce.TurnTimeLimit = matchState.TurnTimeLimit
+				announce.TimeRemaining = matchState.TimeRemaining
 			}
 
-			announceBytes, _ := json.Marshal(announceData)
-			dispatcher.BroadcastMessage(2, announceBytes, []runtime.Presence{presence}, nil, true)
+			broadcast(dispatcher, matchState, OpCodePlayerJoined, announce, []runtime.Presence{presence})
+		}
+
+		// Both seats are filled, play starts on the next tick
+		if matchState.Phase == PhaseWaiting {
+			setPhase(logger, dispatcher, matchState, PhaseReady)
 		}
 	}
 
+	updateLabel(logger, dispatcher, matchState)
 	return matchState
 }
 
@@ -235,6 +386,22 @@ func (m *Match) MatchLeave(ctx context.Context, logger runtime.Logger, db *sql.D
 	matchState := getMatchState(state)
 
 	for _, presence := range presences {
+		delete(matchState.RateBuckets, presence.GetSessionId())
+		delete(matchState.Encodings, presence.GetSessionId())
+		delete(matchState.PendingSpectators, presence.GetSessionId())
+		delete(matchState.PendingPlayers, presence.GetSessionId())
+
+		if removeSpectator(logger, dispatcher, matchState, presence) {
+			continue
+		}
+		matchState.LastActivityTick = tick
+
+		// Keep the seat of a player who drops out of a game in progress
+		if (matchState.Phase == PhaseReady || matchState.Phase == PhasePlaying) && isPlayer(presence.GetUserId(), matchState) {
+			m.holdSeat(logger, dispatcher, tick, matchState, presence)
+			continue
+		}
+
 		// Remove the player from our list
 		for i, p := range matchState.Players {
 			if p.GetUserId() == presence.GetUserId() {
@@ -243,18 +410,17 @@ func (m *Match) MatchLeave(ctx context.Context, logger runtime.Logger, db *sql.D
 			}
 		}
 
-		// Announce player departure
-		announceData := map[string]interface{}{
-			"message": "Player left the match",
-			"user_id": presence.GetUserId(),
-		}
-		announceBytes, _ := json.Marshal(announceData)
-
-		// Send a message to all remaining players
-		dispatcher.BroadcastMessage(3, announceBytes, nil, nil, true)
+		// Announce player departure to all remaining players
+		broadcast(dispatcher, matchState, OpCodePlayerLeft, &PlayerLeftMessage{
+			Message:      "Player left the match",
+			UserId:       presence.GetUserId(),
+			StateVersion: nextStateVersion(matchState),
+		}, nil)
 
 		logger.Info("Player %s left match", presence.GetUserId())
 	}
+
+	updateLabel(logger, dispatcher, matchState)
 	return matchState
 }
 
@@ -262,13 +428,63 @@ func (m *Match) MatchLeave(ctx context.Context, logger runtime.Logger, db *sql.D
 func (m *Match) MatchLoop(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, messages []runtime.MatchData) interface{} {
 	matchState := getMatchState(state)
 
+	// Catch spectators up on whatever is now far enough behind
+	m.releaseSpectatorFeed(dispatcher, tick, matchState)
+
+	// Close finished, abandoned and idle matches
+	if m.shouldTerminate(ctx, logger, nk, dispatcher, tick, matchState) {
+		sendFinalResults(dispatcher, matchState)
+		logger.Info("=== MATCH CLOSING === reason: %s", matchState.EndReason)
+		return nil
+	}
+
+	// Cancel the match if invited players never showed up
+	if matchState.Phase == PhaseWaiting && matchState.ReservationDeadline > 0 && tick >= matchState.ReservationDeadline && !allInvitedJoined(matchState) {
+		logger.Info("Reservation expired with %d of %d invited players present, cancelling match", len(matchState.Players), len(matchState.Invited))
+		broadcast(dispatcher, matchState, OpCodeMatchCancelled, &MatchCancelledMessage{
+			Message: "Opponent did not join, match cancelled",
+			Reason:  "reservation_expired",
+		}, nil)
+
+		m.endGame(ctx, logger, nk, dispatcher, tick, matchState, "", rules.EndReasonCancelled)
+		return nil
+	}
+
+	// Start play once both players have been told their symbols
+	if matchState.Phase == PhaseReady {
+		if err := setPhase(logger, dispatcher, matchState, PhasePlaying); err == nil {
+			matchState.StartedAt = m.clock.Now().Unix()
+			if matchState.MaxGameSec > 0 {
+				matchState.GameDeadlineTick = tick + int64(matchState.MaxGameSec*m.tickRate)
+			}
+			if matchState.GameMode == GameModeTimed {
+				// A restored game resumes with the time its turn holder had left
+				matchState.TurnDeadlineTick = tick + matchState.TimeRemaining*int64(m.tickRate)
+				logger.Info("Started timer for timed mode: %d seconds", matchState.TurnTimeLimit)
+			}
+		}
+	}
+
+	// Forfeit on behalf of players who did not come back in time
+	if matchState.Phase == PhasePlaying && m.checkReconnectDeadlines(ctx, logger, nk, dispatcher, tick, matchState) {
+		return matchState
+	}
+
+	// Settle a game that has run out of time by perfect play
+	if matchState.Phase == PhasePlaying && m.checkGameDeadline(ctx, logger, nk, dispatcher, tick, matchState) {
+		return matchState
+	}
+
+	// A paused clock pushes the deadline back by one tick per tick
+	if matchState.GameMode == GameModeTimed && matchState.TurnDeadlineTick > 0 && matchState.Phase == PhasePlaying && m.clockPaused(matchState) {
+		matchState.TurnDeadlineTick++
+	}
+
 	// Handle timer for timed mode
-	if matchState.GameMode == GameModeTimed && matchState.CurrentTurnStart > 0 && !matchState.GameEnded {
-		currentTime := time.Now().Unix()
-		elapsed := currentTime - matchState.CurrentTurnStart
-		matchState.TimeRemaining = matchState.TurnTimeLimit - elapsed
+	if matchState.GameMode == GameModeTimed && matchState.TurnDeadlineTick > 0 && matchState.Phase == PhasePlaying && !m.clockPaused(matchState) {
+		matchState.TimeRemaining = m.secondsUntil(tick, matchState.TurnDeadlineTick)
 		// Check if time is up
-		if matchState.TimeRemaining <= 0 {
+		if tick >= matchState.TurnDeadlineTick {
 			logger.Info("Time's up for player %s", matchState.CurrentTurn)
 
 			// Current player loses due to timeout
@@ -283,162 +499,202 @@ func (m *Match) MatchLoop(ctx context.Context, logger runtime.Logger, db *sql.DB
 			}
 
 			if winner != "" {
-				timeoutData := map[string]interface{}{
-					"message":     fmt.Sprintf("Time's up! %s wins by timeout!", winnerSymbol),
-					"winner_id":   winner,
-					"board_state": matchState.TicTacToe,
-					"game_mode":   matchState.GameMode,
-					"timeout":     true,
-				}
-				timeoutBytes, _ := json.Marshal(timeoutData)
-				dispatcher.BroadcastMessage(8, timeoutBytes, nil, nil, true)
-
-				matchState.GameEnded = true
-				matchState.Winner = winner
-
-				// Write to leaderboard
-				m.writeToLeaderboard(ctx, nk, logger, winner, winnerSymbol, matchState)
+				broadcast(dispatcher, matchState, OpCodeTimeout, &GameOverMessage{
+					Message:      fmt.Sprintf("Time's up! %s wins by timeout!", winnerSymbol),
+					WinnerId:     winner,
+					EndReason:    rules.EndReasonTimeout,
+					BoardState:   matchState.TicTacToe,
+					GameMode:     matchState.GameMode,
+					StateVersion: nextStateVersion(matchState),
+				}, nil)
+
+				m.endGame(ctx, logger, nk, dispatcher, tick, matchState, winner, rules.EndReasonTimeout)
 				return matchState
 			}
 		}
 
-		// Broadcast time update every few seconds
-		if tick%10 == 0 { // Every 10 ticks (assuming 10 ticks per second)
-			timeData := map[string]interface{}{
-				"time_remaining": matchState.TimeRemaining,
-				"current_turn":   matchState.CurrentTurn,
-			}
-			timeBytes, _ := json.Marshal(timeData)
-			dispatcher.BroadcastMessage(9, timeBytes, nil, nil, true)
+		// Broadcast time update once a second
+		if (matchState.TurnDeadlineTick-tick)%int64(m.tickRate) == 0 {
+			broadcast(dispatcher, matchState, OpCodeTimerUpdate, &TimerUpdateMessage{
+				TimeRemaining: matchState.TimeRemaining,
+				CurrentTurn:   matchState.CurrentTurn,
+			}, nil)
 		}
 	}
 
 	// Process any messages from players
 	for _, message := range messages {
-		// Get player's presence from state
-		var presence runtime.Presence
-		for _, p := range matchState.Players {
-			if p.GetUserId() == message.GetUserId() {
-				presence = p
-				break
-			}
-		}
-
-		logger.Info("Received message from user %s: %v", message.GetUserId(), string(message.GetData()))
-		matchState.PlayerActions[message.GetUserId()] = message.GetData()
-
-		// Parse the action
-		var action struct {
-			Row int `json:"row"`
-			Col int `json:"col"`
-		}
-		if err := json.Unmarshal(message.GetData(), &action); err != nil {
-			logger.Error("Invalid action data from user %s: %v", message.GetUserId(), err)
-			playerError(dispatcher, presence, "Invalid action data")
+		if !m.allowMessage(logger, nk, dispatcher, tick, matchState, message) {
 			continue
 		}
-
-		// Validate move
-		if action.Row < 0 || action.Row > 2 || action.Col < 0 || action.Col > 2 {
-			logger.Error("Out of bounds move from user %s: %v", message.GetUserId(), action)
-			playerError(dispatcher, presence, "Out of bounds move")
-			continue
-		}
-		if matchState.TicTacToe[action.Row*3+action.Col] != "" {
-			logger.Error("Cell already occupied by user %s: %v", message.GetUserId(), action)
-			playerError(dispatcher, presence, "Cell already occupied")
-			continue
-		}
-		if matchState.CurrentTurn != "" && matchState.CurrentTurn != message.GetUserId() {
-			logger.Error("Not user %s's turn", message.GetUserId())
-			playerError(dispatcher, presence, "Not your turn")
+		logger.Debug("Received message from user %s: %v", message.GetUserId(), string(message.GetData()))
+
+		// Spectators may only ask for the state, everything else they send is ignored
+		if isSpectator(message.GetSessionId(), matchState) {
+			if message.GetOpCode() == OpCodeRequestState {
+				broadcast(dispatcher, matchState, OpCodeStateSync, spectatorStateSync(message.GetUserId(), matchState), []runtime.Presence{message})
+			} else {
+				logger.Debug("Ignoring opcode %d from spectator %s", message.GetOpCode(), message.GetUserId())
+			}
 			continue
 		}
 
-		// Make the move
-		symbol := matchState.PlayerSymbols[message.GetUserId()]
-		matchState.TicTacToe[action.Row*3+action.Col] = symbol
-		logger.Info("Board state: %s, symbol: %s", matchState.TicTacToe, symbol)
-
-		// Check for win
-		for _, win := range gameWin {
-			if matchState.TicTacToe[win[0]] == symbol && matchState.TicTacToe[win[1]] == symbol && matchState.TicTacToe[win[2]] == symbol {
-				// We have a winner
-				winData := map[string]interface{}{
-					"message":        fmt.Sprintf("We have a winner! %s wins in %s mode!", symbol, matchState.GameMode),
-					"winner_id":      message.GetUserId(),
-					"board_state":    matchState.TicTacToe,
-					"game_mode":      matchState.GameMode,
-					"winning_strike": []int{win[0], win[1], win[2]},
-				}
-				winBytes, _ := json.Marshal(winData)
-				dispatcher.BroadcastMessage(5, winBytes, nil, nil, true)
-
-				matchState.GameEnded = true
-				matchState.Winner = message.GetUserId()
-
-				// Write to leaderboard
-				m.writeToLeaderboard(ctx, nk, logger, message.GetUserId(), symbol, matchState)
+		switch message.GetOpCode() {
+		case OpCodeMove:
+			if m.handleMove(ctx, logger, nk, dispatcher, tick, matchState, message) {
 				return matchState
 			}
+		case OpCodeRequestState:
+			logger.Info("User %s requested a state sync", message.GetUserId())
+			broadcast(dispatcher, matchState, OpCodeStateSync, newStateSyncMessage(message.GetUserId(), matchState), []runtime.Presence{message})
+		default:
+			logger.Warn("Unknown opcode %d from user %s", message.GetOpCode(), message.GetUserId())
+			sendError(dispatcher, matchState, message, ErrCodeUnknownOpCode, "Unknown message type")
 		}
+	}
 
-		// Check for draw
-		isDraw := true
-		for _, cell := range matchState.TicTacToe {
-			if cell == "" {
-				isDraw = false
-				break
-			}
-		}
-		if isDraw {
-			drawData := map[string]interface{}{
-				"message":     fmt.Sprintf("It's a draw in %s mode!", matchState.GameMode),
-				"board_state": matchState.TicTacToe,
-				"game_mode":   matchState.GameMode,
-			}
-			drawBytes, _ := json.Marshal(drawData)
-			dispatcher.BroadcastMessage(7, drawBytes, nil, nil, true)
+	return matchState
+}
 
-			matchState.GameEnded = true
-			logger.Info("Game ended in a draw")
-			return matchState
-		}
+// handleMove validates and applies a move, returning true if it ended the game
+func (m *Match) handleMove(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, matchState *MatchState, message runtime.MatchData) bool {
+	// Parse the action
+	var action MoveAction
+	if err := decodeMoveAction(encodingOf(matchState, message.GetSessionId()), message.GetData(), &action); err != nil || action.Seq <= 0 {
+		logger.Error("Invalid action data from user %s: %v", message.GetUserId(), err)
+		sendError(dispatcher, matchState, message, ErrCodeInvalidAction, "Invalid action data")
+		return false
+	}
 
-		// Switch turn to the other player
-		if len(matchState.Players) == 2 {
-			for _, p := range matchState.Players {
-				if p.GetUserId() != message.GetUserId() {
-					matchState.CurrentTurn = p.GetUserId()
-					break
-				}
-			}
+	if !isPlayer(message.GetUserId(), matchState) {
+		logger.Error("Move from non-player %s", message.GetUserId())
+		sendError(dispatcher, matchState, message, ErrCodeNotPlayer, "You are not a player in this match")
+		return false
+	}
+	if matchState.Phase != PhasePlaying {
+		logger.Error("Move from user %s while match is %s", message.GetUserId(), matchState.Phase)
+		sendError(dispatcher, matchState, message, ErrCodeNotInProgress, "Game is not in progress")
+		return false
+	}
 
-			// Reset timer for timed mode
-			if matchState.GameMode == GameModeTimed {
-				matchState.CurrentTurnStart = time.Now().Unix()
-				matchState.TimeRemaining = matchState.TurnTimeLimit
-			}
-		}
+	// Drop resends and moves made against an outdated board
+	if action.Seq <= matchState.LastSeq[message.GetUserId()] {
+		logger.Warn("Duplicate action %d from user %s", action.Seq, message.GetUserId())
+		actionRejected(dispatcher, message, ErrCodeDuplicateAction, "Action already received", action.Seq, matchState)
+		return false
+	}
+	if action.Version != matchState.BoardVersion {
+		logger.Warn("Stale action from user %s: version %d, board is at %d", message.GetUserId(), action.Version, matchState.BoardVersion)
+		actionRejected(dispatcher, message, ErrCodeStaleAction, "Board has changed since this move was made", action.Seq, matchState)
+		return false
+	}
+
+	// Validate move
+	switch err := rules.CheckMove(matchState.TicTacToe, action.Row, action.Col); err {
+	case nil:
+	case rules.ErrOutOfBounds:
+		logger.Error("Out of bounds move from user %s: %v", message.GetUserId(), action)
+		sendError(dispatcher, matchState, message, ErrCodeOutOfBounds, "Out of bounds move")
+		return false
+	case rules.ErrOccupied:
+		logger.Error("Cell already occupied by user %s: %v", message.GetUserId(), action)
+		sendError(dispatcher, matchState, message, ErrCodeCellOccupied, "Cell already occupied")
+		return false
+	default:
+		logger.Error("Move from user %s on a decided board: %v", message.GetUserId(), action)
+		sendError(dispatcher, matchState, message, ErrCodeNotInProgress, "Game is not in progress")
+		return false
+	}
+	if matchState.CurrentTurn != message.GetUserId() {
+		logger.Error("Not user %s's turn", message.GetUserId())
+		sendError(dispatcher, matchState, message, ErrCodeNotYourTurn, "Not your turn")
+		return false
+	}
+
+	// Make the move
+	symbol := matchState.PlayerSymbols[message.GetUserId()]
+	matchState.TicTacToe[action.Row*3+action.Col] = symbol
+	matchState.Moves = append(matchState.Moves, MatchMove{
+		UserId: message.GetUserId(),
+		Symbol: symbol,
+		Row:    action.Row,
+		Col:    action.Col,
+		Tick:   tick,
+		Time:   m.clock.Now().UnixMilli(),
+	})
+	matchState.BoardVersion++
+	matchState.LastSeq[message.GetUserId()] = action.Seq
+	matchState.LastActivityTick = tick
+	logger.Info("Board state: %s, symbol: %s", matchState.TicTacToe, symbol)
+
+	broadcast(dispatcher, matchState, OpCodeMoveAck, &MoveAckMessage{
+		Seq:     action.Seq,
+		Version: matchState.BoardVersion,
+	}, []runtime.Presence{message})
+
+	// Check for win
+	if win, ok := rules.WinningLine(matchState.TicTacToe, symbol); ok {
+		// We have a winner
+		broadcast(dispatcher, matchState, OpCodeGameOver, &GameOverMessage{
+			Message:       fmt.Sprintf("We have a winner! %s wins in %s mode!", symbol, matchState.GameMode),
+			WinnerId:      message.GetUserId(),
+			EndReason:     rules.EndReasonWin,
+			BoardState:    matchState.TicTacToe,
+			GameMode:      matchState.GameMode,
+			WinningStrike: []int{win[0], win[1], win[2]},
+			StateVersion:  nextStateVersion(matchState),
+		}, nil)
+
+		m.endGame(ctx, logger, nk, dispatcher, tick, matchState, message.GetUserId(), rules.EndReasonWin)
+		return true
+	}
 
-		// Broadcast game update
-		echoData := map[string]interface{}{
-			"board_state":  matchState.TicTacToe,
-			"current_turn": matchState.CurrentTurn,
-			"game_mode":    matchState.GameMode,
+	// Check for draw
+	if rules.IsBoardFull(matchState.TicTacToe) {
+		broadcast(dispatcher, matchState, OpCodeDraw, &GameOverMessage{
+			Message:      fmt.Sprintf("It's a draw in %s mode!", matchState.GameMode),
+			EndReason:    rules.EndReasonDraw,
+			BoardState:   matchState.TicTacToe,
+			GameMode:     matchState.GameMode,
+			StateVersion: nextStateVersion(matchState),
+		}, nil)
+
+		m.endGame(ctx, logger, nk, dispatcher, tick, matchState, "", rules.EndReasonDraw)
+		logger.Info("Game ended in a draw")
+		return true
+	}
+
+	// Switch turn to the other player
+	if len(matchState.Players) == 2 {
+		for _, p := range matchState.Players {
+			if p.GetUserId() != message.GetUserId() {
+				matchState.CurrentTurn = p.GetUserId()
+				break
+			}
 		}
 
+		// Reset timer for timed mode
 		if matchState.GameMode == GameModeTimed {
-			echoData["time_remaining"] = matchState.TimeRemaining
+			matchState.TurnDeadlineTick = tick + matchState.TurnTimeLimit*int64(m.tickRate)
+			matchState.TimeRemaining = matchState.TurnTimeLimit
 		}
+	}
 
-		echoBytes, _ := json.Marshal(echoData)
-		dispatcher.BroadcastMessage(4, echoBytes, nil, nil, true)
+	// Broadcast game update
+	update := &GameUpdateMessage{
+		BoardState:   matchState.TicTacToe,
+		BoardVersion: matchState.BoardVersion,
+		CurrentTurn:  matchState.CurrentTurn,
+		GameMode:     matchState.GameMode,
+		StateVersion: nextStateVersion(matchState),
 	}
 
-	// Clear actions after processing
-	matchState.PlayerActions = make(map[string][]byte)
-	return matchState
+	if matchState.GameMode == GameModeTimed {
+		update.TimeRemaining = matchState.TimeRemaining
+	}
+
+	broadcast(dispatcher, matchState, OpCodeGameUpdate, update, nil)
+	return false
 }
 
 // getOpponentName returns the username of the opponent for a given userId in the match state
@@ -451,57 +707,159 @@ func getOpponentName(userId string, matchState *MatchState) string {
 	return ""
 }
 
-// writeToLeaderboard writes the winner to the leaderboard with mode-specific scoring
-func (m *Match) writeToLeaderboard(ctx context.Context, nk runtime.NakamaModule, logger runtime.Logger, winnerId, symbol string, matchState *MatchState) {
-	score := int64(1) // Default score for classic mode
-
-	// Timed mode gets bonus points
-	if matchState.GameMode == GameModeTimed {
-		score = 2 // Timed mode is worth more points
+// secondsUntil returns the whole seconds left before deadline, rounded up
+func (m *Match) secondsUntil(tick, deadline int64) int64 {
+	if tick >= deadline {
+		return 0
 	}
+	rate := int64(m.tickRate)
+	return (deadline - tick + rate - 1) / rate
+}
 
-	// Get username
-	username := ""
+// isPlayer reports whether userId holds a seat in the match
+func isPlayer(userId string, matchState *MatchState) bool {
 	for _, p := range matchState.Players {
-		if p.GetUserId() == winnerId {
-			username = p.GetUsername()
-			break
+		if p.GetUserId() == userId {
+			return true
+		}
+	}
+	return false
+}
+
+// pendingSeatSec is how long a seat stays held for a player whose join attempt passed but who never joined
+const pendingSeatSec = 10
+
+// PendingSeat is a seat held between a player's join attempt and their join
+type PendingSeat struct {
+	UserId string `json:"user_id"`
+	Tick   int64  `json:"tick"` // tick of the join attempt
+}
+
+// pendingSeats counts the seats held for other users, dropping holds that have expired
+func pendingSeats(matchState *MatchState, tick int64, tickRate int, userId string) int {
+	users := map[string]bool{}
+	for sessionId, seat := range matchState.PendingPlayers {
+		if tick-seat.Tick > int64(pendingSeatSec*tickRate) {
+			delete(matchState.PendingPlayers, sessionId)
+			continue
+		}
+		if seat.UserId != userId {
+			users[seat.UserId] = true
 		}
 	}
+	return len(users)
+}
 
-	metadata := map[string]interface{}{
-		"Symbol": symbol,
-		"Mode":   matchState.GameMode,
+// allInvitedJoined reports whether every invited user has taken their seat
+func allInvitedJoined(matchState *MatchState) bool {
+	for _, userId := range matchState.Invited {
+		if !isPlayer(userId, matchState) {
+			return false
+		}
 	}
+	return true
+}
 
-	if matchState.GameMode == GameModeTimed {
-		metadata["TimeRemaining"] = matchState.TimeRemaining
+// invitedUserIds extracts the invited user IDs from the match creation params
+func invitedUserIds(params map[string]interface{}) []string {
+	var userIds []string
+	paramInto(params, "invited", &userIds)
+	return userIds
+}
+
+// matchParams converts match creation params to plain JSON values, strings, float64 numbers, bools, slices and
+// maps, as they would arrive from a client. Every MatchCreate passes its params through it, so MatchInit never
+// depends on which Go types a caller used.
+func matchParams(params map[string]interface{}) map[string]interface{} {
+	// Every param is built from strings, numbers and our own JSON-tagged types, which always marshal
+	paramsBytes, _ := json.Marshal(params)
+	values := map[string]interface{}{}
+	if err := json.Unmarshal(paramsBytes, &values); err != nil {
+		return map[string]interface{}{}
 	}
+	return values
+}
 
-	_, err := nk.LeaderboardRecordWrite(ctx, "TicTacToeLeaderboard", winnerId, username, score, 0, metadata, nil)
+// paramInto decodes a structured match parameter into dst, reporting whether it was present and well formed
+func paramInto(params map[string]interface{}, key string, dst interface{}) bool {
+	value, ok := params[key]
+	if !ok {
+		return false
+	}
+	valueBytes, err := json.Marshal(value)
 	if err != nil {
-		logger.Error("Failed to write leaderboard record: %v", err)
-	} else {
-		logger.Info("Wrote leaderboard record for %s: %d points (%s mode)", username, score, matchState.GameMode)
+		return false
 	}
+	return json.Unmarshal(valueBytes, dst) == nil
 }
 
-func playerError(dispatcher runtime.MatchDispatcher, presence runtime.Presence, message string) {
-	errorData := map[string]interface{}{
-		"error": message,
+// intParam reads a non-negative integer match parameter
+func intParam(params map[string]interface{}, key string, fallback int) int {
+	var value int
+	switch v := params[key].(type) {
+	case int:
+		value = v
+	case int64:
+		value = int(v)
+	case float64:
+		value = int(v)
+	default:
+		return fallback
+	}
+	if value < 0 {
+		return fallback
 	}
-	errorBytes, _ := json.Marshal(errorData)
-	dispatcher.BroadcastMessage(6, errorBytes, []runtime.Presence{presence}, nil, true)
+	return value
+}
+
+// actionRejected tells a player their action was not applied, with the board version to retry against
+func actionRejected(dispatcher runtime.MatchDispatcher, presence runtime.Presence, code ErrorCode, message string, seq int64, matchState *MatchState) {
+	broadcast(dispatcher, matchState, OpCodeError, &ErrorMessage{
+		Error:        message,
+		Code:         code,
+		Seq:          seq,
+		LastSeq:      matchState.LastSeq[presence.GetUserId()],
+		BoardVersion: matchState.BoardVersion,
+	}, []runtime.Presence{presence})
 }
 
 // MatchTerminate is called when the match is terminated
 func (m *Match) MatchTerminate(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, graceSeconds int) interface{} {
-	logger.Info("Match terminated")
-	return state
+	logger.Info("Match terminated with %d seconds grace", graceSeconds)
+	matchState := getMatchState(state)
+
+	// Settle whatever state the game was in
+	if !matchState.GameEnded {
+		m.shutdownMatch(ctx, logger, nk, dispatcher, tick, matchState)
+	} else {
+		m.persistMatchRecord(ctx, nk, logger, matchState)
+	}
+
+	broadcast(dispatcher, matchState, OpCodeMatchTerminating, &MatchTerminatingMessage{
+		Message:      "Match is closing",
+		EndReason:    matchState.EndReason,
+		GraceSeconds: graceSeconds,
+	}, nil)
+
+	return matchState
 }
 
 // MatchSignal is called when the match receives a signal
 func (m *Match) MatchSignal(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, data string) (interface{}, string) {
 	logger.Info("Match signal received: %v", data)
-	return state, data
+	matchState := getMatchState(state)
+
+	var signal MatchSignalData
+	if err := json.Unmarshal([]byte(data), &signal); err != nil {
+		logger.Error("Invalid match signal: %v", err)
+		return matchState, "invalid signal"
+	}
+
+	switch signal.Type {
+	case "shutdown":
+		m.shutdownMatch(ctx, logger, nk, dispatcher, tick, matchState)
+		return matchState, "ok"
+	}
+
+	return matchState, "unknown signal"
 }
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"tictac/rules"
+)
+
+// fakeClock is a Clock tests move forward by hand
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// testLogger discards everything
+type testLogger struct{}
+
+func (testLogger) Debug(format string, v ...interface{})                     {}
+func (testLogger) Info(format string, v ...interface{})                      {}
+func (testLogger) Warn(format string, v ...interface{})                      {}
+func (testLogger) Error(format string, v ...interface{})                     {}
+func (l testLogger) WithField(key string, v interface{}) runtime.Logger      { return l }
+func (l testLogger) WithFields(fields map[string]interface{}) runtime.Logger { return l }
+func (testLogger) Fields() map[string]interface{}                            { return nil }
+
+// testNakama accepts the storage and leaderboard writes a finished game makes, anything else panics
+type testNakama struct {
+	runtime.NakamaModule
+	storageWrites int
+	scoreWrites   int
+}
+
+func (nk *testNakama) StorageRead(ctx context.Context, reads []*runtime.StorageRead) ([]*api.StorageObject, error) {
+	return nil, nil
+}
+
+func (nk *testNakama) StorageWrite(ctx context.Context, writes []*runtime.StorageWrite) ([]*api.StorageObjectAck, error) {
+	nk.storageWrites++
+	acks := make([]*api.StorageObjectAck, len(writes))
+	for i, w := range writes {
+		acks[i] = &api.StorageObjectAck{Collection: w.Collection, Key: w.Key, UserId: w.UserID, Version: "1"}
+	}
+	return acks, nil
+}
+
+func (nk *testNakama) LeaderboardRecordWrite(ctx context.Context, id, ownerID, username string, score, subscore int64, metadata map[string]interface{}, overrideOperator *int) (*api.LeaderboardRecord, error) {
+	nk.scoreWrites++
+	return &api.LeaderboardRecord{LeaderboardId: id, OwnerId: ownerID}, nil
+}
+
+func (nk *testNakama) LeaderboardRecordsList(ctx context.Context, id string, ownerIDs []string, limit int, cursor string, expiry int64) ([]*api.LeaderboardRecord, []*api.LeaderboardRecord, string, string, error) {
+	return nil, nil, "", "", nil
+}
+
+func (nk *testNakama) MetricsCounterAdd(name string, tags map[string]string, delta int64) {}
+
+// sentMessage is one message a testDispatcher was asked to send
+type sentMessage struct {
+	opCode    int64
+	data      []byte
+	presences []runtime.Presence
+}
+
+// testDispatcher records broadcasts
+type testDispatcher struct {
+	sent  []sentMessage
+	label string
+}
+
+func (d *testDispatcher) BroadcastMessage(opCode int64, data []byte, presences []runtime.Presence, sender runtime.Presence, reliable bool) error {
+	d.sent = append(d.sent, sentMessage{opCode: opCode, data: data, presences: presences})
+	return nil
+}
+
+func (d *testDispatcher) BroadcastMessageDeferred(opCode int64, data []byte, presences []runtime.Presence, sender runtime.Presence, reliable bool) error {
+	return d.BroadcastMessage(opCode, data, presences, sender, reliable)
+}
+
+func (d *testDispatcher) MatchKick(presences []runtime.Presence) error {
+	return nil
+}
+
+func (d *testDispatcher) MatchLabelUpdate(label string) error {
+	d.label = label
+	return nil
+}
+
+// count returns how many messages with the opcode were sent
+func (d *testDispatcher) count(opCode int64) int {
+	n := 0
+	for _, msg := range d.sent {
+		if msg.opCode == opCode {
+			n++
+		}
+	}
+	return n
+}
+
+// testPresence is a connected user
+type testPresence struct {
+	userId    string
+	sessionId string
+}
+
+func (p testPresence) GetHidden() bool                   { return false }
+func (p testPresence) GetPersistence() bool              { return false }
+func (p testPresence) GetUsername() string               { return p.userId }
+func (p testPresence) GetStatus() string                 { return "" }
+func (p testPresence) GetReason() runtime.PresenceReason { return runtime.PresenceReasonUnknown }
+func (p testPresence) GetUserId() string                 { return p.userId }
+func (p testPresence) GetSessionId() string              { return p.sessionId }
+func (p testPresence) GetNodeId() string                 { return "node" }
+
+// testMatchData is a message from a player
+type testMatchData struct {
+	testPresence
+	opCode int64
+	data   []byte
+}
+
+func (d testMatchData) GetOpCode() int64      { return d.opCode }
+func (d testMatchData) GetData() []byte       { return d.data }
+func (d testMatchData) GetReliable() bool     { return true }
+func (d testMatchData) GetReceiveTime() int64 { return 0 }
+
+// matchHarness runs one match tick by tick on a fake clock
+type matchHarness struct {
+	t          *testing.T
+	ctx        context.Context
+	match      *Match
+	clock      *fakeClock
+	nk         *testNakama
+	dispatcher *testDispatcher
+	state      *MatchState
+	tick       int64
+	closed     bool
+	inbox      []runtime.MatchData // messages delivered on the next tick
+}
+
+// newTimedHarness seats alice as X and bob as O in a timed match, ready to start on the next tick
+func newTimedHarness(t *testing.T) *matchHarness {
+	config := defaultMatchConfig()
+	config.ReconnectGraceSec = 600
+	config.IdleLimitSec = 3600
+	return newHarness(t, GameModeTimed, config)
+}
+
+// newHarness seats alice as X and bob as O in a match of the mode, ready to start on the next tick
+func newHarness(t *testing.T, mode GameMode, config *MatchConfig) *matchHarness {
+	h := &matchHarness{
+		t:          t,
+		ctx:        context.WithValue(context.Background(), runtime.RUNTIME_CTX_MATCH_ID, "match.node"),
+		match:      NewMatchWithMode(mode, config),
+		clock:      &fakeClock{now: time.Unix(1700000000, 0)},
+		nk:         &testNakama{},
+		dispatcher: &testDispatcher{},
+	}
+	h.match.clock = h.clock
+
+	state, _, _ := h.match.MatchInit(h.ctx, testLogger{}, nil, h.nk, map[string]interface{}{"game_mode": string(mode)})
+	h.state = state.(*MatchState)
+	h.join(testPresence{userId: "alice", sessionId: "s-alice"})
+	h.join(testPresence{userId: "bob", sessionId: "s-bob"})
+	if h.state.Phase != PhaseReady {
+		t.Fatalf("phase after both joined = %s, want %s", h.state.Phase, PhaseReady)
+	}
+	return h
+}
+
+// join runs a player through the join attempt and the join
+func (h *matchHarness) join(p testPresence) {
+	state, ok, reason := h.match.MatchJoinAttempt(h.ctx, testLogger{}, nil, h.nk, h.dispatcher, h.tick, h.state, p, map[string]string{
+		protocolVersionMetadata: strconv.Itoa(ProtocolVersion),
+	})
+	if !ok {
+		h.t.Fatalf("join attempt of %s refused: %s", p.userId, reason)
+	}
+	h.state = h.match.MatchJoin(h.ctx, testLogger{}, nil, h.nk, h.dispatcher, h.tick, state, []runtime.Presence{p}).(*MatchState)
+}
+
+// leave drops a player's connection
+func (h *matchHarness) leave(p testPresence) {
+	h.state = h.match.MatchLeave(h.ctx, testLogger{}, nil, h.nk, h.dispatcher, h.tick, h.state, []runtime.Presence{p}).(*MatchState)
+}
+
+// step runs n ticks, moving the clock forward by one tick each time
+func (h *matchHarness) step(n int) {
+	for i := 0; i < n && !h.closed; i++ {
+		h.tick++
+		h.clock.Advance(time.Second / time.Duration(h.match.tickRate))
+		messages := h.inbox
+		h.inbox = nil
+		state := h.match.MatchLoop(h.ctx, testLogger{}, nil, h.nk, h.dispatcher, h.tick, h.state, messages)
+		if state == nil {
+			h.closed = true
+			return
+		}
+		h.state = state.(*MatchState)
+	}
+}
+
+// send queues a message from a player for the next tick
+func (h *matchHarness) send(p testPresence, opCode int64, message interface{}) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	h.inbox = append(h.inbox, testMatchData{testPresence: p, opCode: opCode, data: data})
+}
+
+// stepUntil runs ticks until the tick is reached
+func (h *matchHarness) stepUntil(tick int64) {
+	h.step(int(tick - h.tick))
+}
+
+func TestTurnTimeoutFiresOnDeadlineTick(t *testing.T) {
+	h := newTimedHarness(t)
+	h.step(1)
+	if h.state.Phase != PhasePlaying {
+		t.Fatalf("phase = %s, want %s", h.state.Phase, PhasePlaying)
+	}
+	deadline := h.state.TurnDeadlineTick
+	if want := h.tick + h.state.TurnTimeLimit*int64(h.match.tickRate); deadline != want {
+		t.Fatalf("deadline tick = %d, want %d", deadline, want)
+	}
+
+	h.stepUntil(deadline - 1)
+	if h.state.GameEnded {
+		t.Fatalf("game ended on tick %d, before the deadline %d", h.tick, deadline)
+	}
+	if h.state.TimeRemaining != 1 {
+		t.Errorf("time remaining one tick before the deadline = %d, want 1", h.state.TimeRemaining)
+	}
+
+	h.step(1)
+	if !h.state.GameEnded || h.state.EndedTick != deadline {
+		t.Fatalf("game ended = %v on tick %d, want ended on tick %d", h.state.GameEnded, h.state.EndedTick, deadline)
+	}
+	if h.dispatcher.count(OpCodeTimeout) != 1 {
+		t.Errorf("sent %d timeout messages, want 1", h.dispatcher.count(OpCodeTimeout))
+	}
+}
+
+func TestTurnDeadlineHeldWhileDisconnected(t *testing.T) {
+	h := newTimedHarness(t)
+	h.step(1)
+	remaining := h.state.TurnDeadlineTick - h.tick
+
+	h.step(50)
+	remaining -= 50
+	h.leave(testPresence{userId: "alice", sessionId: "s-alice"})
+
+	// Far longer than the turn limit, the clock must not run while alice is away
+	h.step(int(h.state.TurnTimeLimit*int64(h.match.tickRate)) * 3)
+	if h.state.GameEnded {
+		t.Fatalf("game ended with reason %s while the clock was paused", h.state.EndReason)
+	}
+	if got := h.state.TurnDeadlineTick - h.tick; got != remaining {
+		t.Fatalf("ticks left on the turn clock = %d after the pause, want %d", got, remaining)
+	}
+
+	h.join(testPresence{userId: "alice", sessionId: "s-alice-2"})
+	deadline := h.state.TurnDeadlineTick
+	h.stepUntil(deadline - 1)
+	if h.state.GameEnded {
+		t.Fatalf("game ended on tick %d, before the deadline %d", h.tick, deadline)
+	}
+	h.step(1)
+	if !h.state.GameEnded || h.state.EndReason != rules.EndReasonTimeout {
+		t.Fatalf("game ended = %v (%s), want a timeout once the clock runs again", h.state.GameEnded, h.state.EndReason)
+	}
+}
+
+func TestTimeoutWinnerIsOpponent(t *testing.T) {
+	h := newTimedHarness(t)
+	h.step(1)
+	startedAt := h.clock.Now().Unix()
+	if h.state.CurrentTurn != "alice" {
+		t.Fatalf("first turn is %q, want alice playing X", h.state.CurrentTurn)
+	}
+
+	h.stepUntil(h.state.TurnDeadlineTick)
+	if h.state.EndReason != rules.EndReasonTimeout {
+		t.Fatalf("end reason = %q, want %q", h.state.EndReason, rules.EndReasonTimeout)
+	}
+	if h.state.Winner != "bob" {
+		t.Errorf("winner = %q, want bob", h.state.Winner)
+	}
+	if h.state.StartedAt != startedAt {
+		t.Errorf("started at %d, want %d", h.state.StartedAt, startedAt)
+	}
+	if want := startedAt + h.state.TurnTimeLimit; h.state.EndedAt != want {
+		t.Errorf("ended at %d, want %d from the fake clock", h.state.EndedAt, want)
+	}
+	if !h.state.Persisted || h.nk.scoreWrites == 0 {
+		t.Errorf("persisted = %v with %d score writes, want the result recorded", h.state.Persisted, h.nk.scoreWrites)
+	}
+}
+
+func TestOnlyAcceptedMovesKeepAMatchAlive(t *testing.T) {
+	config := defaultMatchConfig()
+	config.IdleLimitSec = 60
+	config.ReconnectGraceSec = 600
+	h := newHarness(t, GameModeClassic, config)
+	alice := testPresence{userId: "alice", sessionId: "s-alice"}
+	bob := testPresence{userId: "bob", sessionId: "s-bob"}
+	h.step(1)
+	idleTicks := int64(config.IdleLimitSec * h.match.tickRate)
+
+	// An accepted move counts as activity
+	h.stepUntil(idleTicks / 2)
+	h.send(alice, OpCodeMove, &MoveAction{Seq: 1, Version: h.state.BoardVersion, Row: 1, Col: 1})
+	h.step(1)
+	moved := h.tick
+	if h.state.LastActivityTick != moved {
+		t.Fatalf("last activity on tick %d after a move on tick %d", h.state.LastActivityTick, moved)
+	}
+
+	// State requests and moves that are refused do not
+	for h.tick < moved+idleTicks-1 && !h.closed {
+		h.send(bob, OpCodeRequestState, struct{}{})
+		h.send(alice, OpCodeMove, &MoveAction{Seq: 2, Version: h.state.BoardVersion, Row: 0, Col: 0})
+		h.step(config.RateLimitBurst)
+	}
+	if h.state.LastActivityTick != moved {
+		t.Fatalf("last activity moved to tick %d without an accepted move", h.state.LastActivityTick)
+	}
+	h.stepUntil(moved + idleTicks)
+	if !h.state.GameEnded || h.state.EndReason != rules.EndReasonIdle {
+		t.Errorf("game ended = %v (%s) an idle limit after the last move, want idle", h.state.GameEnded, h.state.EndReason)
+	}
+}
+
+func TestGameIsAdjudicatedAtItsTimeLimit(t *testing.T) {
+	config := defaultMatchConfig()
+	config.IdleLimitSec = 3600
+	h := newHarness(t, GameModeClassic, config)
+	h.state.MaxGameSec = 60
+	alice := testPresence{userId: "alice", sessionId: "s-alice"}
+	bob := testPresence{userId: "bob", sessionId: "s-bob"}
+	h.step(1)
+	deadline := h.state.GameDeadlineTick
+	if want := h.tick + int64(60*h.match.tickRate); deadline != want {
+		t.Fatalf("game deadline tick = %d, want %d", deadline, want)
+	}
+
+	// X in the centre and O on an edge, X wins with perfect play
+	h.send(alice, OpCodeMove, &MoveAction{Seq: 1, Version: h.state.BoardVersion, Row: 1, Col: 1})
+	h.step(1)
+	h.send(bob, OpCodeMove, &MoveAction{Seq: 1, Version: h.state.BoardVersion, Row: 0, Col: 1})
+	h.step(1)
+
+	h.stepUntil(deadline - 1)
+	if h.state.GameEnded {
+		t.Fatalf("game ended on tick %d (%s), before the limit on tick %d", h.tick, h.state.EndReason, deadline)
+	}
+	h.step(1)
+	if !h.state.GameEnded || h.state.EndReason != rules.EndReasonAdjudicated {
+		t.Fatalf("game ended = %v (%s) at the limit, want adjudicated", h.state.GameEnded, h.state.EndReason)
+	}
+	if h.state.Winner != "alice" {
+		t.Errorf("winner = %q, want alice", h.state.Winner)
+	}
+}
+
+func TestMatchInitReadsParamsAsJSONValues(t *testing.T) {
+	ref := &TournamentRef{Id: "cup", Kind: FormatBracket, Round: 1, Game: 2}
+	board := [9]string{"X", "", "", "", "O", "", "", "", ""}
+	params := matchParams(map[string]interface{}{
+		"mode":                GameModeClassic,
+		"invited":             []string{"alice", "bob"},
+		"private":             true,
+		"tournament":          ref,
+		"symbols":             map[string]string{"alice": "O", "bob": "X"},
+		"reservation_seconds": int64(90),
+		"start_board":         board,
+		"max_game_seconds":    300,
+	})
+	// A param of a Go type would not survive being sent to another node
+	if _, ok := params["tournament"].(map[string]interface{}); !ok {
+		t.Fatalf("tournament param is %T, want a JSON object", params["tournament"])
+	}
+
+	m := NewMatchWithMode(GameModeClassic, defaultMatchConfig())
+	state, _, _ := m.MatchInit(context.Background(), testLogger{}, nil, &testNakama{}, params)
+	matchState := state.(*MatchState)
+	if len(matchState.Invited) != 2 || matchState.Invited[0] != "alice" || matchState.Invited[1] != "bob" {
+		t.Errorf("invited = %v, want alice and bob", matchState.Invited)
+	}
+	if !matchState.Private {
+		t.Error("match is not private")
+	}
+	if matchState.Tournament == nil || *matchState.Tournament != *ref {
+		t.Errorf("tournament = %+v, want %+v", matchState.Tournament, ref)
+	}
+	if matchState.AssignedSymbols["alice"] != "O" || matchState.AssignedSymbols["bob"] != "X" {
+		t.Errorf("symbols = %v, want alice O and bob X", matchState.AssignedSymbols)
+	}
+	if want := int64(90 * m.tickRate); matchState.ReservationDeadline != want {
+		t.Errorf("reservation deadline = %d, want %d", matchState.ReservationDeadline, want)
+	}
+	if matchState.TicTacToe != board || matchState.StartBoard != board {
+		t.Errorf("board = %v from %v, want %v", matchState.TicTacToe, matchState.StartBoard, board)
+	}
+	if matchState.MaxGameSec != 300 {
+		t.Errorf("max game seconds = %d, want 300", matchState.MaxGameSec)
+	}
+}
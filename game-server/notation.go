@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"tictac/rules"
+)
+
+// Game notation is a PGN-like text form of a game. A header of [Tag "value"] lines is followed
+// by the moves, numbered in pairs and ending with the result:
+//
+//	[Mode "timed"]
+//	[X "alice"]
+//	[O "bob"]
+//	[TimeControl "30"]
+//	[Result "1-0"]
+//
+//	1. b2 a1 2. c3 c1 3. b1 a3 4. b3 1-0
+//
+// Squares are a column letter a-c and a row number 1-3, a1 being the top left cell.
+// A game that starts from a position carries it in a Position tag, rows top to bottom
+// separated by "/" with "." for an empty cell, e.g. [Position "X../.O./..."].
+
+// Notation results, from X's point of view
+const (
+	NotationResultXWins = "1-0"
+	NotationResultOWins = "0-1"
+	NotationResultDraw  = "1/2-1/2"
+	NotationResultNone  = "*" // unfinished or void
+)
+
+// notationTagOrder is the order tags are written in
+var notationTagOrder = []string{"Match", "Mode", "Date", "X", "O", "TimeControl", "Position", "EndReason", "Result"}
+
+// NotationTag is one header line
+type NotationTag struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// NotationMove is one move of a parsed game
+type NotationMove struct {
+	Symbol string `json:"symbol"`
+	Row    int    `json:"row"`
+	Col    int    `json:"col"`
+}
+
+// GameNotation is a parsed and replayed game
+type GameNotation struct {
+	Tags       []NotationTag  `json:"tags"`
+	StartBoard [9]string      `json:"start_board"`
+	Moves      []NotationMove `json:"moves"`
+	Board      [9]string      `json:"board"`  // position after the last move
+	Result     string         `json:"result"` // from the tags, or from the board if the game is decided there
+}
+
+// tag returns the value of the named tag, or "" if it is missing
+func (g *GameNotation) tag(name string) string {
+	for _, t := range g.Tags {
+		if t.Name == name {
+			return t.Value
+		}
+	}
+	return ""
+}
+
+// squareName returns the notation of a cell
+func squareName(row, col int) string {
+	return fmt.Sprintf("%c%d", 'a'+col, row+1)
+}
+
+// parseSquare reads a square like "b2", reporting false if it is not on the board
+func parseSquare(s string) (int, int, bool) {
+	if len(s) != 2 || s[0] < 'a' || s[0] > 'c' || s[1] < '1' || s[1] > '3' {
+		return 0, 0, false
+	}
+	return int(s[1] - '1'), int(s[0] - 'a'), true
+}
+
+// formatPosition writes a board as used by the Position tag
+func formatPosition(board [9]string) string {
+	var sb strings.Builder
+	for i, cell := range board {
+		if i > 0 && i%3 == 0 {
+			sb.WriteByte('/')
+		}
+		if cell == "" {
+			sb.WriteByte('.')
+		} else {
+			sb.WriteString(cell)
+		}
+	}
+	return sb.String()
+}
+
+// parsePosition reads the value of a Position tag
+func parsePosition(s string) ([9]string, error) {
+	var board [9]string
+	rows := strings.Split(s, "/")
+	if len(rows) != 3 {
+		return board, fmt.Errorf("position %q must have 3 rows", s)
+	}
+	for r, row := range rows {
+		if len(row) != 3 {
+			return board, fmt.Errorf("position row %q must have 3 cells", row)
+		}
+		for c, cell := range row {
+			switch cell {
+			case '.':
+			case 'X', 'O':
+				board[r*3+c] = string(cell)
+			default:
+				return board, fmt.Errorf("position cell %q is not X, O or .", cell)
+			}
+		}
+	}
+	if !rules.IsReachable(board) {
+		return board, fmt.Errorf("position %q cannot arise in play", s)
+	}
+	return board, nil
+}
+
+// boardResult returns the notation result decided on the board, or NotationResultNone if play can go on
+func boardResult(board [9]string) string {
+	switch {
+	case rules.Winner(board) == "X":
+		return NotationResultXWins
+	case rules.Winner(board) == "O":
+		return NotationResultOWins
+	case rules.IsBoardFull(board):
+		return NotationResultDraw
+	}
+	return NotationResultNone
+}
+
+// recordResult returns the notation result of a stored match
+func recordResult(record *MatchRecord) string {
+	if record.Winner == "" {
+		if record.EndReason == rules.EndReasonDraw || record.EndReason == rules.EndReasonAdjudicated {
+			return NotationResultDraw
+		}
+		return NotationResultNone
+	}
+	for _, p := range record.Players {
+		if p.UserId == record.Winner && p.Symbol == "O" {
+			return NotationResultOWins
+		}
+	}
+	return NotationResultXWins
+}
+
+// formatNotation writes a stored match in game notation
+func formatNotation(record *MatchRecord) string {
+	tags := map[string]string{
+		"Match":     record.MatchId,
+		"Mode":      string(record.GameMode),
+		"EndReason": string(record.EndReason),
+		"Result":    recordResult(record),
+	}
+	if record.StartedAt > 0 {
+		tags["Date"] = time.Unix(record.StartedAt, 0).UTC().Format("2006.01.02")
+	}
+	for _, p := range record.Players {
+		tags[p.Symbol] = p.Username
+	}
+	if record.Config.TurnTimeLimit > 0 {
+		tags["TimeControl"] = fmt.Sprint(record.Config.TurnTimeLimit)
+	} else {
+		tags["TimeControl"] = "-"
+	}
+	if record.StartBoard != [9]string{} {
+		tags["Position"] = formatPosition(record.StartBoard)
+	}
+
+	var sb strings.Builder
+	for _, name := range notationTagOrder {
+		if value, ok := tags[name]; ok {
+			fmt.Fprintf(&sb, "[%s %q]\n", name, value)
+		}
+	}
+	sb.WriteByte('\n')
+
+	number := 1
+	for i, move := range record.Moves {
+		switch {
+		case move.Symbol == "X":
+			fmt.Fprintf(&sb, "%d. ", number)
+		case i == 0:
+			fmt.Fprintf(&sb, "%d... ", number)
+		}
+		sb.WriteString(squareName(move.Row, move.Col))
+		sb.WriteByte(' ')
+		if move.Symbol == "O" {
+			number++
+		}
+	}
+	sb.WriteString(recordResult(record))
+	sb.WriteByte('\n')
+	return sb.String()
+}
+
+// parseNotation reads a game in notation and replays its moves under the match rules
+func parseNotation(text string) (*GameNotation, error) {
+	game := &GameNotation{Moves: []NotationMove{}}
+	var movetext []string
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "[") {
+			movetext = append(movetext, line)
+			continue
+		}
+		if !strings.HasSuffix(line, "]") {
+			return nil, fmt.Errorf("unterminated tag %q", line)
+		}
+		name, quoted, ok := strings.Cut(line[1:len(line)-1], " ")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("malformed tag %q", line)
+		}
+		var value string
+		if _, err := fmt.Sscanf(quoted, "%q", &value); err != nil {
+			return nil, fmt.Errorf("malformed tag value %q", quoted)
+		}
+		game.Tags = append(game.Tags, NotationTag{Name: name, Value: value})
+	}
+
+	if position := game.tag("Position"); position != "" {
+		board, err := parsePosition(position)
+		if err != nil {
+			return nil, err
+		}
+		game.StartBoard = board
+	}
+	game.Board = game.StartBoard
+
+	result, ended := NotationResultNone, false
+	for _, token := range strings.Fields(strings.Join(movetext, " ")) {
+		// Move numbers may stand alone or be glued to the move, "1." "1..." "1.b2"
+		if i := strings.LastIndex(token, "."); i >= 0 {
+			token = token[i+1:]
+			if token == "" {
+				continue
+			}
+		}
+		switch token {
+		case NotationResultXWins, NotationResultOWins, NotationResultDraw, NotationResultNone:
+			result, ended = token, true
+			continue
+		}
+		if ended {
+			return nil, fmt.Errorf("move %q after the result", token)
+		}
+
+		row, col, ok := parseSquare(token)
+		if !ok {
+			return nil, fmt.Errorf("invalid square %q", token)
+		}
+		if boardResult(game.Board) != NotationResultNone {
+			return nil, fmt.Errorf("move %s after the game was decided", token)
+		}
+		if game.Board[row*3+col] != "" {
+			return nil, fmt.Errorf("square %s is already taken", token)
+		}
+		symbol := rules.SideToMove(game.Board)
+		game.Board[row*3+col] = symbol
+		game.Moves = append(game.Moves, NotationMove{Symbol: symbol, Row: row, Col: col})
+	}
+
+	// The result tag and the movetext must agree, and a result decided on the board must match
+	// both. An undecided board may carry any result, the game ended by timeout or forfeit.
+	if tagResult := game.tag("Result"); tagResult != "" && tagResult != NotationResultNone {
+		if result != NotationResultNone && result != tagResult {
+			return nil, fmt.Errorf("result tag %s does not match movetext result %s", tagResult, result)
+		}
+		result = tagResult
+	}
+	if onBoard := boardResult(game.Board); onBoard != NotationResultNone {
+		if result != NotationResultNone && result != onBoard {
+			return nil, fmt.Errorf("result %s does not match the board, which is %s", result, onBoard)
+		}
+		result = onBoard
+	}
+	game.Result = result
+	return game, nil
+}
+
+// rpcExportMatch returns a stored match in game notation, to those who may see its replay
+func rpcExportMatch(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userId, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+
+	var req struct {
+		MatchId string `json:"match_id"`
+	}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil || req.MatchId == "" {
+		return "", errBadInput
+	}
+
+	record, err := readMatchRecord(ctx, nk, req.MatchId)
+	if err != nil {
+		logger.Error("StorageRead error: %v", err)
+		return "", errInternal
+	}
+	if record == nil || !canReadReplay(userId, record) {
+		return "", errNotFound
+	}
+
+	respBytes, _ := json.Marshal(map[string]string{"notation": formatNotation(record)})
+	return string(respBytes), nil
+}
+
+// rpcImportNotation checks a game in notation and returns its analysis. With create_match set,
+// the final position becomes the start of a new private match the caller can share.
+func rpcImportNotation(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userId, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userId == "" {
+		return "", errNoUserId
+	}
+
+	var req struct {
+		Notation    string   `json:"notation"`
+		CreateMatch bool     `json:"create_match"`
+		Mode        GameMode `json:"mode"`
+	}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil || req.Notation == "" {
+		return "", errBadInput
+	}
+
+	game, err := parseNotation(req.Notation)
+	if err != nil {
+		logger.Info("Rejected notation from %s: %v", userId, err)
+		return "", runtime.NewError(fmt.Sprintf("invalid notation: %v", err), 3)
+	}
+
+	resp := struct {
+		*GameNotation
+		SideToMove  string `json:"side_to_move,omitempty"`
+		PerfectPlay string `json:"perfect_play,omitempty"` // expected result with perfect play from here
+		MatchId     string `json:"match_id,omitempty"`
+	}{GameNotation: game}
+
+	if boardResult(game.Board) == NotationResultNone {
+		resp.SideToMove = rules.SideToMove(game.Board)
+		switch rules.Adjudicate(game.Board) {
+		case "X":
+			resp.PerfectPlay = NotationResultXWins
+		case "O":
+			resp.PerfectPlay = NotationResultOWins
+		default:
+			resp.PerfectPlay = NotationResultDraw
+		}
+	}
+
+	if req.CreateMatch {
+		if resp.SideToMove == "" {
+			return "", runtime.NewError("the game is already decided", 3)
+		}
+		mode := req.Mode
+		if mode == "" {
+			mode = GameMode(game.tag("Mode"))
+		}
+		switch mode {
+		case "":
+			mode = GameModeClassic
+		case GameModeClassic, GameModeTimed:
+		default:
+			return "", errBadInput
+		}
+
+		resp.MatchId, err = nk.MatchCreate(ctx, "lobby_"+string(mode), matchParams(map[string]interface{}{
+			"mode":        mode,
+			"private":     true,
+			"start_board": game.Board,
+		}))
+		if err != nil {
+			logger.Error("MatchCreate error: %v", err)
+			return "", errInternal
+		}
+		logger.Info("User %s started match %s from an imported position", userId, resp.MatchId)
+	}
+
+	respBytes, _ := json.Marshal(resp)
+	return string(respBytes), nil
+}
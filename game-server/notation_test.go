@@ -0,0 +1,153 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"tictac/rules"
+)
+
+// notationRecord builds a finished match record from squares played alternately by the side to move
+func notationRecord(t *testing.T, mode GameMode, start [9]string, squares string, winnerSymbol string, reason EndReason) *MatchRecord {
+	t.Helper()
+	record := &MatchRecord{
+		MatchId:  "match.node",
+		GameMode: mode,
+		Players: []MatchRecordPlayer{
+			{UserId: "user-x", Username: "alice", Symbol: "X"},
+			{UserId: "user-o", Username: "bob", Symbol: "O"},
+		},
+		StartBoard: start,
+		Board:      start,
+		EndReason:  reason,
+		StartedAt:  1700000000,
+	}
+	if mode == GameModeTimed {
+		record.Config.TurnTimeLimit = 30
+	}
+	for _, square := range strings.Fields(squares) {
+		row, col, ok := parseSquare(square)
+		if !ok {
+			t.Fatalf("bad square %q in test case", square)
+		}
+		if err := rules.CheckMove(record.Board, row, col); err != nil {
+			t.Fatalf("illegal move %s in test case: %v", square, err)
+		}
+		symbol := rules.SideToMove(record.Board)
+		record.Board[row*3+col] = symbol
+		record.Moves = append(record.Moves, MatchMove{UserId: "user-" + strings.ToLower(symbol), Symbol: symbol, Row: row, Col: col})
+	}
+	if winnerSymbol != "" {
+		record.Winner = "user-" + strings.ToLower(winnerSymbol)
+	}
+	return record
+}
+
+func TestNotationRoundTrip(t *testing.T) {
+	position := [9]string{"X", "", "", "", "O", "", "", "", ""}
+
+	tests := []struct {
+		name    string
+		mode    GameMode
+		start   [9]string
+		squares string
+		winner  string
+		reason  EndReason
+		result  string
+	}{
+		{"x wins", GameModeClassic, [9]string{}, "b2 a1 c3 c1 b1 a3 b3", "X", rules.EndReasonWin, NotationResultXWins},
+		{"o wins", GameModeClassic, [9]string{}, "a1 b2 a2 b1 c3 b3", "O", rules.EndReasonWin, NotationResultOWins},
+		{"draw", GameModeClassic, [9]string{}, "b2 a1 c1 a3 a2 c2 b1 b3 c3", "", rules.EndReasonDraw, NotationResultDraw},
+		{"x times out", GameModeTimed, [9]string{}, "b2 a1 c3", "O", rules.EndReasonTimeout, NotationResultOWins},
+		{"o times out on move one", GameModeTimed, [9]string{}, "b2", "X", rules.EndReasonTimeout, NotationResultXWins},
+		{"forfeit", GameModeClassic, [9]string{}, "a1 b2", "O", rules.EndReasonForfeit, NotationResultOWins},
+		{"adjudicated", GameModeClassic, [9]string{}, "b2 a1", "", rules.EndReasonAdjudicated, NotationResultDraw},
+		{"void", GameModeClassic, [9]string{}, "b2", "", rules.EndReasonVoid, NotationResultNone},
+		{"no moves", GameModeClassic, [9]string{}, "", "", rules.EndReasonCancelled, NotationResultNone},
+		{"from a position", GameModeClassic, position, "c3 a3 c1 b1 c2", "X", rules.EndReasonWin, NotationResultXWins},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := notationRecord(t, tt.mode, tt.start, tt.squares, tt.winner, tt.reason)
+			text := formatNotation(record)
+
+			game, err := parseNotation(text)
+			if err != nil {
+				t.Fatalf("parsing our own notation: %v\n%s", err, text)
+			}
+			if game.Result != tt.result {
+				t.Errorf("result = %s, want %s\n%s", game.Result, tt.result, text)
+			}
+			if game.StartBoard != record.StartBoard {
+				t.Errorf("start board = %v, want %v", game.StartBoard, record.StartBoard)
+			}
+
+			// Replay the parsed moves under the rules and compare with the stored game
+			board := game.StartBoard
+			if len(game.Moves) != len(record.Moves) {
+				t.Fatalf("parsed %d moves, want %d\n%s", len(game.Moves), len(record.Moves), text)
+			}
+			for i, move := range game.Moves {
+				want := record.Moves[i]
+				if move.Symbol != want.Symbol || move.Row != want.Row || move.Col != want.Col {
+					t.Fatalf("move %d = %+v, want %s at %s", i+1, move, want.Symbol, squareName(want.Row, want.Col))
+				}
+				if err := rules.CheckMove(board, move.Row, move.Col); err != nil {
+					t.Fatalf("move %d replays illegally: %v", i+1, err)
+				}
+				board[move.Row*3+move.Col] = move.Symbol
+			}
+			if board != record.Board || game.Board != record.Board {
+				t.Errorf("board after replay = %v, parsed %v, want %v", board, game.Board, record.Board)
+			}
+
+			// The winner is whoever played the winning side
+			var winner string
+			for _, p := range record.Players {
+				if (game.Result == NotationResultXWins && p.Symbol == "X") || (game.Result == NotationResultOWins && p.Symbol == "O") {
+					winner = p.UserId
+				}
+			}
+			if winner != record.Winner {
+				t.Errorf("winner after the round trip = %q, want %q", winner, record.Winner)
+			}
+			if got := game.tag("EndReason"); got != string(record.EndReason) {
+				t.Errorf("EndReason tag = %q, want %q", got, record.EndReason)
+			}
+		})
+	}
+}
+
+func TestParseNotationRejectsMalformedGames(t *testing.T) {
+	tests := []struct {
+		name     string
+		notation string
+		err      string
+	}{
+		{"square off the board", "1. d4 *", "invalid square"},
+		{"square taken", "1. b2 b2 *", "already taken"},
+		{"move after a win", "1. a1 b1 2. a2 b2 3. a3 c3 *", "after the game was decided"},
+		{"move after the result", "1. b2 a1 1-0 c3", "after the result"},
+		{"result against the board", "1. a1 b1 2. a2 b2 3. a3 0-1", "does not match the board"},
+		{"result tag against movetext", "[Result \"1-0\"]\n\n1. b2 0-1", "does not match movetext"},
+		{"unterminated tag", "[Mode \"classic\"\n\n1. b2 *", "unterminated tag"},
+		{"unquoted tag value", "[Mode classic]\n\n1. b2 *", "malformed tag value"},
+		{"tag without a value", "[Mode]\n\n1. b2 *", "malformed tag"},
+		{"short position", "[Position \"X../...\"]\n\n*", "3 rows"},
+		{"bad position cell", "[Position \"X../.Q./...\"]\n\n*", "is not X, O or ."},
+		{"unreachable position", "[Position \"XXX/.../...\"]\n\n*", "cannot arise in play"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game, err := parseNotation(tt.notation)
+			if err == nil {
+				t.Fatalf("parsed %q without error, board %v", tt.notation, game.Board)
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error = %q, want it to mention %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,1806 @@
+// Binary encoding of the match protocol, chosen by clients that join with
+// "encoding" = "protobuf" in their join metadata. Field names and meanings
+// match the JSON messages in protocol.go; opcodes are unchanged.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.8
+// 	protoc        (unknown)
+// source: match.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Client opcode 1
+type MoveAction struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Seq           int64                  `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	Version       int64                  `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"`
+	Row           int32                  `protobuf:"varint,3,opt,name=row,proto3" json:"row,omitempty"`
+	Col           int32                  `protobuf:"varint,4,opt,name=col,proto3" json:"col,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MoveAction) Reset() {
+	*x = MoveAction{}
+	mi := &file_match_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MoveAction) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MoveAction) ProtoMessage() {}
+
+func (x *MoveAction) ProtoReflect() protoreflect.Message {
+	mi := &file_match_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MoveAction.ProtoReflect.Descriptor instead.
+func (*MoveAction) Descriptor() ([]byte, []int) {
+	return file_match_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *MoveAction) GetSeq() int64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *MoveAction) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *MoveAction) GetRow() int32 {
+	if x != nil {
+		return x.Row
+	}
+	return 0
+}
+
+func (x *MoveAction) GetCol() int32 {
+	if x != nil {
+		return x.Col
+	}
+	return 0
+}
+
+// Opcode 1
+type WelcomeMessage struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Message         string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	PlayerCount     int32                  `protobuf:"varint,2,opt,name=player_count,json=playerCount,proto3" json:"player_count,omitempty"`
+	GameMode        string                 `protobuf:"bytes,3,opt,name=game_mode,json=gameMode,proto3" json:"game_mode,omitempty"`
+	TurnTimeLimit   int64                  `protobuf:"varint,4,opt,name=turn_time_limit,json=turnTimeLimit,proto3" json:"turn_time_limit,omitempty"`
+	ProtocolVersion int32                  `protobuf:"varint,5,opt,name=protocol_version,json=protocolVersion,proto3" json:"protocol_version,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *WelcomeMessage) Reset() {
+	*x = WelcomeMessage{}
+	mi := &file_match_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WelcomeMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WelcomeMessage) ProtoMessage() {}
+
+func (x *WelcomeMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_match_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WelcomeMessage.ProtoReflect.Descriptor instead.
+func (*WelcomeMessage) Descriptor() ([]byte, []int) {
+	return file_match_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *WelcomeMessage) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *WelcomeMessage) GetPlayerCount() int32 {
+	if x != nil {
+		return x.PlayerCount
+	}
+	return 0
+}
+
+func (x *WelcomeMessage) GetGameMode() string {
+	if x != nil {
+		return x.GameMode
+	}
+	return ""
+}
+
+func (x *WelcomeMessage) GetTurnTimeLimit() int64 {
+	if x != nil {
+		return x.TurnTimeLimit
+	}
+	return 0
+}
+
+func (x *WelcomeMessage) GetProtocolVersion() int32 {
+	if x != nil {
+		return x.ProtocolVersion
+	}
+	return 0
+}
+
+// Opcode 2
+type PlayerJoinedMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Message       string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	UserId        string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Username      string                 `protobuf:"bytes,3,opt,name=username,proto3" json:"username,omitempty"`
+	TotalPlayers  int32                  `protobuf:"varint,4,opt,name=total_players,json=totalPlayers,proto3" json:"total_players,omitempty"`
+	Opponent      string                 `protobuf:"bytes,5,opt,name=opponent,proto3" json:"opponent,omitempty"`
+	CurrentTurn   string                 `protobuf:"bytes,6,opt,name=current_turn,json=currentTurn,proto3" json:"current_turn,omitempty"`
+	BoardState    []string               `protobuf:"bytes,7,rep,name=board_state,json=boardState,proto3" json:"board_state,omitempty"`
+	BoardVersion  int64                  `protobuf:"varint,8,opt,name=board_version,json=boardVersion,proto3" json:"board_version,omitempty"`
+	Symbol        string                 `protobuf:"bytes,9,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	GameMode      string                 `protobuf:"bytes,10,opt,name=game_mode,json=gameMode,proto3" json:"game_mode,omitempty"`
+	TurnTimeLimit int64                  `protobuf:"varint,11,opt,name=turn_time_limit,json=turnTimeLimit,proto3" json:"turn_time_limit,omitempty"`
+	TimeRemaining int64                  `protobuf:"varint,12,opt,name=time_remaining,json=timeRemaining,proto3" json:"time_remaining,omitempty"`
+	StateVersion  int64                  `protobuf:"varint,13,opt,name=state_version,json=stateVersion,proto3" json:"state_version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PlayerJoinedMessage) Reset() {
+	*x = PlayerJoinedMessage{}
+	mi := &file_match_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PlayerJoinedMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PlayerJoinedMessage) ProtoMessage() {}
+
+func (x *PlayerJoinedMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_match_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PlayerJoinedMessage.ProtoReflect.Descriptor instead.
+func (*PlayerJoinedMessage) Descriptor() ([]byte, []int) {
+	return file_match_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *PlayerJoinedMessage) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *PlayerJoinedMessage) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *PlayerJoinedMessage) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *PlayerJoinedMessage) GetTotalPlayers() int32 {
+	if x != nil {
+		return x.TotalPlayers
+	}
+	return 0
+}
+
+func (x *PlayerJoinedMessage) GetOpponent() string {
+	if x != nil {
+		return x.Opponent
+	}
+	return ""
+}
+
+func (x *PlayerJoinedMessage) GetCurrentTurn() string {
+	if x != nil {
+		return x.CurrentTurn
+	}
+	return ""
+}
+
+func (x *PlayerJoinedMessage) GetBoardState() []string {
+	if x != nil {
+		return x.BoardState
+	}
+	return nil
+}
+
+func (x *PlayerJoinedMessage) GetBoardVersion() int64 {
+	if x != nil {
+		return x.BoardVersion
+	}
+	return 0
+}
+
+func (x *PlayerJoinedMessage) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *PlayerJoinedMessage) GetGameMode() string {
+	if x != nil {
+		return x.GameMode
+	}
+	return ""
+}
+
+func (x *PlayerJoinedMessage) GetTurnTimeLimit() int64 {
+	if x != nil {
+		return x.TurnTimeLimit
+	}
+	return 0
+}
+
+func (x *PlayerJoinedMessage) GetTimeRemaining() int64 {
+	if x != nil {
+		return x.TimeRemaining
+	}
+	return 0
+}
+
+func (x *PlayerJoinedMessage) GetStateVersion() int64 {
+	if x != nil {
+		return x.StateVersion
+	}
+	return 0
+}
+
+// Opcode 3
+type PlayerLeftMessage struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Message          string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	UserId           string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	ReconnectSeconds int32                  `protobuf:"varint,3,opt,name=reconnect_seconds,json=reconnectSeconds,proto3" json:"reconnect_seconds,omitempty"`
+	ClockPaused      bool                   `protobuf:"varint,4,opt,name=clock_paused,json=clockPaused,proto3" json:"clock_paused,omitempty"`
+	StateVersion     int64                  `protobuf:"varint,5,opt,name=state_version,json=stateVersion,proto3" json:"state_version,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *PlayerLeftMessage) Reset() {
+	*x = PlayerLeftMessage{}
+	mi := &file_match_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PlayerLeftMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PlayerLeftMessage) ProtoMessage() {}
+
+func (x *PlayerLeftMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_match_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PlayerLeftMessage.ProtoReflect.Descriptor instead.
+func (*PlayerLeftMessage) Descriptor() ([]byte, []int) {
+	return file_match_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *PlayerLeftMessage) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *PlayerLeftMessage) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *PlayerLeftMessage) GetReconnectSeconds() int32 {
+	if x != nil {
+		return x.ReconnectSeconds
+	}
+	return 0
+}
+
+func (x *PlayerLeftMessage) GetClockPaused() bool {
+	if x != nil {
+		return x.ClockPaused
+	}
+	return false
+}
+
+func (x *PlayerLeftMessage) GetStateVersion() int64 {
+	if x != nil {
+		return x.StateVersion
+	}
+	return 0
+}
+
+// Opcode 4
+type GameUpdateMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	BoardState    []string               `protobuf:"bytes,1,rep,name=board_state,json=boardState,proto3" json:"board_state,omitempty"`
+	BoardVersion  int64                  `protobuf:"varint,2,opt,name=board_version,json=boardVersion,proto3" json:"board_version,omitempty"`
+	CurrentTurn   string                 `protobuf:"bytes,3,opt,name=current_turn,json=currentTurn,proto3" json:"current_turn,omitempty"`
+	GameMode      string                 `protobuf:"bytes,4,opt,name=game_mode,json=gameMode,proto3" json:"game_mode,omitempty"`
+	TimeRemaining int64                  `protobuf:"varint,5,opt,name=time_remaining,json=timeRemaining,proto3" json:"time_remaining,omitempty"`
+	StateVersion  int64                  `protobuf:"varint,6,opt,name=state_version,json=stateVersion,proto3" json:"state_version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GameUpdateMessage) Reset() {
+	*x = GameUpdateMessage{}
+	mi := &file_match_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GameUpdateMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GameUpdateMessage) ProtoMessage() {}
+
+func (x *GameUpdateMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_match_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GameUpdateMessage.ProtoReflect.Descriptor instead.
+func (*GameUpdateMessage) Descriptor() ([]byte, []int) {
+	return file_match_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GameUpdateMessage) GetBoardState() []string {
+	if x != nil {
+		return x.BoardState
+	}
+	return nil
+}
+
+func (x *GameUpdateMessage) GetBoardVersion() int64 {
+	if x != nil {
+		return x.BoardVersion
+	}
+	return 0
+}
+
+func (x *GameUpdateMessage) GetCurrentTurn() string {
+	if x != nil {
+		return x.CurrentTurn
+	}
+	return ""
+}
+
+func (x *GameUpdateMessage) GetGameMode() string {
+	if x != nil {
+		return x.GameMode
+	}
+	return ""
+}
+
+func (x *GameUpdateMessage) GetTimeRemaining() int64 {
+	if x != nil {
+		return x.TimeRemaining
+	}
+	return 0
+}
+
+func (x *GameUpdateMessage) GetStateVersion() int64 {
+	if x != nil {
+		return x.StateVersion
+	}
+	return 0
+}
+
+// Opcodes 5, 7 and 8
+type GameOverMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Message       string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	WinnerId      string                 `protobuf:"bytes,2,opt,name=winner_id,json=winnerId,proto3" json:"winner_id,omitempty"`
+	EndReason     string                 `protobuf:"bytes,3,opt,name=end_reason,json=endReason,proto3" json:"end_reason,omitempty"`
+	BoardState    []string               `protobuf:"bytes,4,rep,name=board_state,json=boardState,proto3" json:"board_state,omitempty"`
+	GameMode      string                 `protobuf:"bytes,5,opt,name=game_mode,json=gameMode,proto3" json:"game_mode,omitempty"`
+	WinningStrike []int32                `protobuf:"varint,6,rep,packed,name=winning_strike,json=winningStrike,proto3" json:"winning_strike,omitempty"`
+	StateVersion  int64                  `protobuf:"varint,7,opt,name=state_version,json=stateVersion,proto3" json:"state_version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GameOverMessage) Reset() {
+	*x = GameOverMessage{}
+	mi := &file_match_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GameOverMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GameOverMessage) ProtoMessage() {}
+
+func (x *GameOverMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_match_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GameOverMessage.ProtoReflect.Descriptor instead.
+func (*GameOverMessage) Descriptor() ([]byte, []int) {
+	return file_match_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GameOverMessage) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *GameOverMessage) GetWinnerId() string {
+	if x != nil {
+		return x.WinnerId
+	}
+	return ""
+}
+
+func (x *GameOverMessage) GetEndReason() string {
+	if x != nil {
+		return x.EndReason
+	}
+	return ""
+}
+
+func (x *GameOverMessage) GetBoardState() []string {
+	if x != nil {
+		return x.BoardState
+	}
+	return nil
+}
+
+func (x *GameOverMessage) GetGameMode() string {
+	if x != nil {
+		return x.GameMode
+	}
+	return ""
+}
+
+func (x *GameOverMessage) GetWinningStrike() []int32 {
+	if x != nil {
+		return x.WinningStrike
+	}
+	return nil
+}
+
+func (x *GameOverMessage) GetStateVersion() int64 {
+	if x != nil {
+		return x.StateVersion
+	}
+	return 0
+}
+
+// Opcode 6
+type ErrorMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Error         string                 `protobuf:"bytes,1,opt,name=error,proto3" json:"error,omitempty"`
+	Code          string                 `protobuf:"bytes,2,opt,name=code,proto3" json:"code,omitempty"`
+	Seq           int64                  `protobuf:"varint,3,opt,name=seq,proto3" json:"seq,omitempty"`
+	LastSeq       int64                  `protobuf:"varint,4,opt,name=last_seq,json=lastSeq,proto3" json:"last_seq,omitempty"`
+	BoardVersion  int64                  `protobuf:"varint,5,opt,name=board_version,json=boardVersion,proto3" json:"board_version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ErrorMessage) Reset() {
+	*x = ErrorMessage{}
+	mi := &file_match_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ErrorMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ErrorMessage) ProtoMessage() {}
+
+func (x *ErrorMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_match_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ErrorMessage.ProtoReflect.Descriptor instead.
+func (*ErrorMessage) Descriptor() ([]byte, []int) {
+	return file_match_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ErrorMessage) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *ErrorMessage) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *ErrorMessage) GetSeq() int64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *ErrorMessage) GetLastSeq() int64 {
+	if x != nil {
+		return x.LastSeq
+	}
+	return 0
+}
+
+func (x *ErrorMessage) GetBoardVersion() int64 {
+	if x != nil {
+		return x.BoardVersion
+	}
+	return 0
+}
+
+// Opcode 9
+type TimerUpdateMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TimeRemaining int64                  `protobuf:"varint,1,opt,name=time_remaining,json=timeRemaining,proto3" json:"time_remaining,omitempty"`
+	CurrentTurn   string                 `protobuf:"bytes,2,opt,name=current_turn,json=currentTurn,proto3" json:"current_turn,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TimerUpdateMessage) Reset() {
+	*x = TimerUpdateMessage{}
+	mi := &file_match_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TimerUpdateMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TimerUpdateMessage) ProtoMessage() {}
+
+func (x *TimerUpdateMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_match_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TimerUpdateMessage.ProtoReflect.Descriptor instead.
+func (*TimerUpdateMessage) Descriptor() ([]byte, []int) {
+	return file_match_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *TimerUpdateMessage) GetTimeRemaining() int64 {
+	if x != nil {
+		return x.TimeRemaining
+	}
+	return 0
+}
+
+func (x *TimerUpdateMessage) GetCurrentTurn() string {
+	if x != nil {
+		return x.CurrentTurn
+	}
+	return ""
+}
+
+// Opcode 10
+type MatchCancelledMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Message       string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	Reason        string                 `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MatchCancelledMessage) Reset() {
+	*x = MatchCancelledMessage{}
+	mi := &file_match_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MatchCancelledMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MatchCancelledMessage) ProtoMessage() {}
+
+func (x *MatchCancelledMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_match_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MatchCancelledMessage.ProtoReflect.Descriptor instead.
+func (*MatchCancelledMessage) Descriptor() ([]byte, []int) {
+	return file_match_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *MatchCancelledMessage) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *MatchCancelledMessage) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+// Opcode 11
+type PhaseChangeMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Phase         string                 `protobuf:"bytes,1,opt,name=phase,proto3" json:"phase,omitempty"`
+	PreviousPhase string                 `protobuf:"bytes,2,opt,name=previous_phase,json=previousPhase,proto3" json:"previous_phase,omitempty"`
+	CurrentTurn   string                 `protobuf:"bytes,3,opt,name=current_turn,json=currentTurn,proto3" json:"current_turn,omitempty"`
+	BoardState    []string               `protobuf:"bytes,4,rep,name=board_state,json=boardState,proto3" json:"board_state,omitempty"`
+	StateVersion  int64                  `protobuf:"varint,5,opt,name=state_version,json=stateVersion,proto3" json:"state_version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PhaseChangeMessage) Reset() {
+	*x = PhaseChangeMessage{}
+	mi := &file_match_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PhaseChangeMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PhaseChangeMessage) ProtoMessage() {}
+
+func (x *PhaseChangeMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_match_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PhaseChangeMessage.ProtoReflect.Descriptor instead.
+func (*PhaseChangeMessage) Descriptor() ([]byte, []int) {
+	return file_match_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *PhaseChangeMessage) GetPhase() string {
+	if x != nil {
+		return x.Phase
+	}
+	return ""
+}
+
+func (x *PhaseChangeMessage) GetPreviousPhase() string {
+	if x != nil {
+		return x.PreviousPhase
+	}
+	return ""
+}
+
+func (x *PhaseChangeMessage) GetCurrentTurn() string {
+	if x != nil {
+		return x.CurrentTurn
+	}
+	return ""
+}
+
+func (x *PhaseChangeMessage) GetBoardState() []string {
+	if x != nil {
+		return x.BoardState
+	}
+	return nil
+}
+
+func (x *PhaseChangeMessage) GetStateVersion() int64 {
+	if x != nil {
+		return x.StateVersion
+	}
+	return 0
+}
+
+// Opcode 12
+type StateSyncMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Phase         string                 `protobuf:"bytes,2,opt,name=phase,proto3" json:"phase,omitempty"`
+	BoardState    []string               `protobuf:"bytes,3,rep,name=board_state,json=boardState,proto3" json:"board_state,omitempty"`
+	BoardVersion  int64                  `protobuf:"varint,4,opt,name=board_version,json=boardVersion,proto3" json:"board_version,omitempty"`
+	LastSeq       int64                  `protobuf:"varint,5,opt,name=last_seq,json=lastSeq,proto3" json:"last_seq,omitempty"`
+	CurrentTurn   string                 `protobuf:"bytes,6,opt,name=current_turn,json=currentTurn,proto3" json:"current_turn,omitempty"`
+	Symbol        string                 `protobuf:"bytes,7,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	PlayerSymbols map[string]string      `protobuf:"bytes,8,rep,name=player_symbols,json=playerSymbols,proto3" json:"player_symbols,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Opponent      string                 `protobuf:"bytes,9,opt,name=opponent,proto3" json:"opponent,omitempty"`
+	TotalPlayers  int32                  `protobuf:"varint,10,opt,name=total_players,json=totalPlayers,proto3" json:"total_players,omitempty"`
+	Disconnected  []string               `protobuf:"bytes,11,rep,name=disconnected,proto3" json:"disconnected,omitempty"`
+	GameMode      string                 `protobuf:"bytes,12,opt,name=game_mode,json=gameMode,proto3" json:"game_mode,omitempty"`
+	GameEnded     bool                   `protobuf:"varint,13,opt,name=game_ended,json=gameEnded,proto3" json:"game_ended,omitempty"`
+	WinnerId      string                 `protobuf:"bytes,14,opt,name=winner_id,json=winnerId,proto3" json:"winner_id,omitempty"`
+	EndReason     string                 `protobuf:"bytes,15,opt,name=end_reason,json=endReason,proto3" json:"end_reason,omitempty"`
+	TurnTimeLimit int64                  `protobuf:"varint,16,opt,name=turn_time_limit,json=turnTimeLimit,proto3" json:"turn_time_limit,omitempty"`
+	TimeRemaining int64                  `protobuf:"varint,17,opt,name=time_remaining,json=timeRemaining,proto3" json:"time_remaining,omitempty"`
+	StateVersion  int64                  `protobuf:"varint,18,opt,name=state_version,json=stateVersion,proto3" json:"state_version,omitempty"`
+	Spectating    bool                   `protobuf:"varint,19,opt,name=spectating,proto3" json:"spectating,omitempty"`
+	Spectators    int32                  `protobuf:"varint,20,opt,name=spectators,proto3" json:"spectators,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StateSyncMessage) Reset() {
+	*x = StateSyncMessage{}
+	mi := &file_match_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StateSyncMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StateSyncMessage) ProtoMessage() {}
+
+func (x *StateSyncMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_match_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StateSyncMessage.ProtoReflect.Descriptor instead.
+func (*StateSyncMessage) Descriptor() ([]byte, []int) {
+	return file_match_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *StateSyncMessage) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *StateSyncMessage) GetPhase() string {
+	if x != nil {
+		return x.Phase
+	}
+	return ""
+}
+
+func (x *StateSyncMessage) GetBoardState() []string {
+	if x != nil {
+		return x.BoardState
+	}
+	return nil
+}
+
+func (x *StateSyncMessage) GetBoardVersion() int64 {
+	if x != nil {
+		return x.BoardVersion
+	}
+	return 0
+}
+
+func (x *StateSyncMessage) GetLastSeq() int64 {
+	if x != nil {
+		return x.LastSeq
+	}
+	return 0
+}
+
+func (x *StateSyncMessage) GetCurrentTurn() string {
+	if x != nil {
+		return x.CurrentTurn
+	}
+	return ""
+}
+
+func (x *StateSyncMessage) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *StateSyncMessage) GetPlayerSymbols() map[string]string {
+	if x != nil {
+		return x.PlayerSymbols
+	}
+	return nil
+}
+
+func (x *StateSyncMessage) GetOpponent() string {
+	if x != nil {
+		return x.Opponent
+	}
+	return ""
+}
+
+func (x *StateSyncMessage) GetTotalPlayers() int32 {
+	if x != nil {
+		return x.TotalPlayers
+	}
+	return 0
+}
+
+func (x *StateSyncMessage) GetDisconnected() []string {
+	if x != nil {
+		return x.Disconnected
+	}
+	return nil
+}
+
+func (x *StateSyncMessage) GetGameMode() string {
+	if x != nil {
+		return x.GameMode
+	}
+	return ""
+}
+
+func (x *StateSyncMessage) GetGameEnded() bool {
+	if x != nil {
+		return x.GameEnded
+	}
+	return false
+}
+
+func (x *StateSyncMessage) GetWinnerId() string {
+	if x != nil {
+		return x.WinnerId
+	}
+	return ""
+}
+
+func (x *StateSyncMessage) GetEndReason() string {
+	if x != nil {
+		return x.EndReason
+	}
+	return ""
+}
+
+func (x *StateSyncMessage) GetTurnTimeLimit() int64 {
+	if x != nil {
+		return x.TurnTimeLimit
+	}
+	return 0
+}
+
+func (x *StateSyncMessage) GetTimeRemaining() int64 {
+	if x != nil {
+		return x.TimeRemaining
+	}
+	return 0
+}
+
+func (x *StateSyncMessage) GetStateVersion() int64 {
+	if x != nil {
+		return x.StateVersion
+	}
+	return 0
+}
+
+func (x *StateSyncMessage) GetSpectating() bool {
+	if x != nil {
+		return x.Spectating
+	}
+	return false
+}
+
+func (x *StateSyncMessage) GetSpectators() int32 {
+	if x != nil {
+		return x.Spectators
+	}
+	return 0
+}
+
+// Opcode 13
+type PlayerReconnectedMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Message       string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	UserId        string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Username      string                 `protobuf:"bytes,3,opt,name=username,proto3" json:"username,omitempty"`
+	StateVersion  int64                  `protobuf:"varint,4,opt,name=state_version,json=stateVersion,proto3" json:"state_version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PlayerReconnectedMessage) Reset() {
+	*x = PlayerReconnectedMessage{}
+	mi := &file_match_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PlayerReconnectedMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PlayerReconnectedMessage) ProtoMessage() {}
+
+func (x *PlayerReconnectedMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_match_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PlayerReconnectedMessage.ProtoReflect.Descriptor instead.
+func (*PlayerReconnectedMessage) Descriptor() ([]byte, []int) {
+	return file_match_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *PlayerReconnectedMessage) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *PlayerReconnectedMessage) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *PlayerReconnectedMessage) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *PlayerReconnectedMessage) GetStateVersion() int64 {
+	if x != nil {
+		return x.StateVersion
+	}
+	return 0
+}
+
+// Opcode 14
+type MatchClosedMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Message       string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	WinnerId      string                 `protobuf:"bytes,2,opt,name=winner_id,json=winnerId,proto3" json:"winner_id,omitempty"`
+	EndReason     string                 `protobuf:"bytes,3,opt,name=end_reason,json=endReason,proto3" json:"end_reason,omitempty"`
+	BoardState    []string               `protobuf:"bytes,4,rep,name=board_state,json=boardState,proto3" json:"board_state,omitempty"`
+	PlayerSymbols map[string]string      `protobuf:"bytes,5,rep,name=player_symbols,json=playerSymbols,proto3" json:"player_symbols,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	GameMode      string                 `protobuf:"bytes,6,opt,name=game_mode,json=gameMode,proto3" json:"game_mode,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MatchClosedMessage) Reset() {
+	*x = MatchClosedMessage{}
+	mi := &file_match_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MatchClosedMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MatchClosedMessage) ProtoMessage() {}
+
+func (x *MatchClosedMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_match_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MatchClosedMessage.ProtoReflect.Descriptor instead.
+func (*MatchClosedMessage) Descriptor() ([]byte, []int) {
+	return file_match_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *MatchClosedMessage) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *MatchClosedMessage) GetWinnerId() string {
+	if x != nil {
+		return x.WinnerId
+	}
+	return ""
+}
+
+func (x *MatchClosedMessage) GetEndReason() string {
+	if x != nil {
+		return x.EndReason
+	}
+	return ""
+}
+
+func (x *MatchClosedMessage) GetBoardState() []string {
+	if x != nil {
+		return x.BoardState
+	}
+	return nil
+}
+
+func (x *MatchClosedMessage) GetPlayerSymbols() map[string]string {
+	if x != nil {
+		return x.PlayerSymbols
+	}
+	return nil
+}
+
+func (x *MatchClosedMessage) GetGameMode() string {
+	if x != nil {
+		return x.GameMode
+	}
+	return ""
+}
+
+// Opcode 15
+type MatchTerminatingMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Message       string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	EndReason     string                 `protobuf:"bytes,2,opt,name=end_reason,json=endReason,proto3" json:"end_reason,omitempty"`
+	GraceSeconds  int32                  `protobuf:"varint,3,opt,name=grace_seconds,json=graceSeconds,proto3" json:"grace_seconds,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MatchTerminatingMessage) Reset() {
+	*x = MatchTerminatingMessage{}
+	mi := &file_match_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MatchTerminatingMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MatchTerminatingMessage) ProtoMessage() {}
+
+func (x *MatchTerminatingMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_match_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MatchTerminatingMessage.ProtoReflect.Descriptor instead.
+func (*MatchTerminatingMessage) Descriptor() ([]byte, []int) {
+	return file_match_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *MatchTerminatingMessage) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *MatchTerminatingMessage) GetEndReason() string {
+	if x != nil {
+		return x.EndReason
+	}
+	return ""
+}
+
+func (x *MatchTerminatingMessage) GetGraceSeconds() int32 {
+	if x != nil {
+		return x.GraceSeconds
+	}
+	return 0
+}
+
+// Opcode 16
+type ServerRestartingMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Message       string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	Policy        string                 `protobuf:"bytes,2,opt,name=policy,proto3" json:"policy,omitempty"`
+	BoardState    []string               `protobuf:"bytes,3,rep,name=board_state,json=boardState,proto3" json:"board_state,omitempty"`
+	Restorable    bool                   `protobuf:"varint,4,opt,name=restorable,proto3" json:"restorable,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ServerRestartingMessage) Reset() {
+	*x = ServerRestartingMessage{}
+	mi := &file_match_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ServerRestartingMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServerRestartingMessage) ProtoMessage() {}
+
+func (x *ServerRestartingMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_match_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServerRestartingMessage.ProtoReflect.Descriptor instead.
+func (*ServerRestartingMessage) Descriptor() ([]byte, []int) {
+	return file_match_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *ServerRestartingMessage) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *ServerRestartingMessage) GetPolicy() string {
+	if x != nil {
+		return x.Policy
+	}
+	return ""
+}
+
+func (x *ServerRestartingMessage) GetBoardState() []string {
+	if x != nil {
+		return x.BoardState
+	}
+	return nil
+}
+
+func (x *ServerRestartingMessage) GetRestorable() bool {
+	if x != nil {
+		return x.Restorable
+	}
+	return false
+}
+
+// Opcode 17
+type MoveAckMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Seq           int64                  `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	Version       int64                  `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MoveAckMessage) Reset() {
+	*x = MoveAckMessage{}
+	mi := &file_match_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MoveAckMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MoveAckMessage) ProtoMessage() {}
+
+func (x *MoveAckMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_match_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MoveAckMessage.ProtoReflect.Descriptor instead.
+func (*MoveAckMessage) Descriptor() ([]byte, []int) {
+	return file_match_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *MoveAckMessage) GetSeq() int64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *MoveAckMessage) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+// Opcode 18
+type SpectatorCountMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Count         int32                  `protobuf:"varint,1,opt,name=count,proto3" json:"count,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SpectatorCountMessage) Reset() {
+	*x = SpectatorCountMessage{}
+	mi := &file_match_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SpectatorCountMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SpectatorCountMessage) ProtoMessage() {}
+
+func (x *SpectatorCountMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_match_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SpectatorCountMessage.ProtoReflect.Descriptor instead.
+func (*SpectatorCountMessage) Descriptor() ([]byte, []int) {
+	return file_match_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *SpectatorCountMessage) GetCount() int32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+// Opcode 19, sent by arena tournament directors to everyone watching
+type ArenaStandingsMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TournamentId  string                 `protobuf:"bytes,1,opt,name=tournament_id,json=tournamentId,proto3" json:"tournament_id,omitempty"`
+	Status        string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	ClosesAt      int64                  `protobuf:"varint,3,opt,name=closes_at,json=closesAt,proto3" json:"closes_at,omitempty"`
+	Games         int32                  `protobuf:"varint,4,opt,name=games,proto3" json:"games,omitempty"`
+	Standings     []*TournamentStanding  `protobuf:"bytes,5,rep,name=standings,proto3" json:"standings,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ArenaStandingsMessage) Reset() {
+	*x = ArenaStandingsMessage{}
+	mi := &file_match_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ArenaStandingsMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ArenaStandingsMessage) ProtoMessage() {}
+
+func (x *ArenaStandingsMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_match_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ArenaStandingsMessage.ProtoReflect.Descriptor instead.
+func (*ArenaStandingsMessage) Descriptor() ([]byte, []int) {
+	return file_match_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *ArenaStandingsMessage) GetTournamentId() string {
+	if x != nil {
+		return x.TournamentId
+	}
+	return ""
+}
+
+func (x *ArenaStandingsMessage) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *ArenaStandingsMessage) GetClosesAt() int64 {
+	if x != nil {
+		return x.ClosesAt
+	}
+	return 0
+}
+
+func (x *ArenaStandingsMessage) GetGames() int32 {
+	if x != nil {
+		return x.Games
+	}
+	return 0
+}
+
+func (x *ArenaStandingsMessage) GetStandings() []*TournamentStanding {
+	if x != nil {
+		return x.Standings
+	}
+	return nil
+}
+
+// One player's line in an ArenaStandingsMessage
+type TournamentStanding struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Place           int32                  `protobuf:"varint,1,opt,name=place,proto3" json:"place,omitempty"`
+	UserId          string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Username        string                 `protobuf:"bytes,3,opt,name=username,proto3" json:"username,omitempty"`
+	Points          float64                `protobuf:"fixed64,4,opt,name=points,proto3" json:"points,omitempty"`
+	Buchholz        float64                `protobuf:"fixed64,5,opt,name=buchholz,proto3" json:"buchholz,omitempty"`
+	SonnebornBerger float64                `protobuf:"fixed64,6,opt,name=sonneborn_berger,json=sonnebornBerger,proto3" json:"sonneborn_berger,omitempty"`
+	Streak          int32                  `protobuf:"varint,7,opt,name=streak,proto3" json:"streak,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *TournamentStanding) Reset() {
+	*x = TournamentStanding{}
+	mi := &file_match_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TournamentStanding) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TournamentStanding) ProtoMessage() {}
+
+func (x *TournamentStanding) ProtoReflect() protoreflect.Message {
+	mi := &file_match_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TournamentStanding.ProtoReflect.Descriptor instead.
+func (*TournamentStanding) Descriptor() ([]byte, []int) {
+	return file_match_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *TournamentStanding) GetPlace() int32 {
+	if x != nil {
+		return x.Place
+	}
+	return 0
+}
+
+func (x *TournamentStanding) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *TournamentStanding) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *TournamentStanding) GetPoints() float64 {
+	if x != nil {
+		return x.Points
+	}
+	return 0
+}
+
+func (x *TournamentStanding) GetBuchholz() float64 {
+	if x != nil {
+		return x.Buchholz
+	}
+	return 0
+}
+
+func (x *TournamentStanding) GetSonnebornBerger() float64 {
+	if x != nil {
+		return x.SonnebornBerger
+	}
+	return 0
+}
+
+func (x *TournamentStanding) GetStreak() int32 {
+	if x != nil {
+		return x.Streak
+	}
+	return 0
+}
+
+var File_match_proto protoreflect.FileDescriptor
+
+const file_match_proto_rawDesc = "" +
+	"\n" +
+	"\vmatch.proto\x12\ttictactoe\"\\\n" +
+	"\n" +
+	"MoveAction\x12\x10\n" +
+	"\x03seq\x18\x01 \x01(\x03R\x03seq\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\x03R\aversion\x12\x10\n" +
+	"\x03row\x18\x03 \x01(\x05R\x03row\x12\x10\n" +
+	"\x03col\x18\x04 \x01(\x05R\x03col\"\xbd\x01\n" +
+	"\x0eWelcomeMessage\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\x12!\n" +
+	"\fplayer_count\x18\x02 \x01(\x05R\vplayerCount\x12\x1b\n" +
+	"\tgame_mode\x18\x03 \x01(\tR\bgameMode\x12&\n" +
+	"\x0fturn_time_limit\x18\x04 \x01(\x03R\rturnTimeLimit\x12)\n" +
+	"\x10protocol_version\x18\x05 \x01(\x05R\x0fprotocolVersion\"\xb7\x03\n" +
+	"\x13PlayerJoinedMessage\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\x12\x1a\n" +
+	"\busername\x18\x03 \x01(\tR\busername\x12#\n" +
+	"\rtotal_players\x18\x04 \x01(\x05R\ftotalPlayers\x12\x1a\n" +
+	"\bopponent\x18\x05 \x01(\tR\bopponent\x12!\n" +
+	"\fcurrent_turn\x18\x06 \x01(\tR\vcurrentTurn\x12\x1f\n" +
+	"\vboard_state\x18\a \x03(\tR\n" +
+	"boardState\x12#\n" +
+	"\rboard_version\x18\b \x01(\x03R\fboardVersion\x12\x16\n" +
+	"\x06symbol\x18\t \x01(\tR\x06symbol\x12\x1b\n" +
+	"\tgame_mode\x18\n" +
+	" \x01(\tR\bgameMode\x12&\n" +
+	"\x0fturn_time_limit\x18\v \x01(\x03R\rturnTimeLimit\x12%\n" +
+	"\x0etime_remaining\x18\f \x01(\x03R\rtimeRemaining\x12#\n" +
+	"\rstate_version\x18\r \x01(\x03R\fstateVersion\"\xbb\x01\n" +
+	"\x11PlayerLeftMessage\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\x12+\n" +
+	"\x11reconnect_seconds\x18\x03 \x01(\x05R\x10reconnectSeconds\x12!\n" +
+	"\fclock_paused\x18\x04 \x01(\bR\vclockPaused\x12#\n" +
+	"\rstate_version\x18\x05 \x01(\x03R\fstateVersion\"\xe5\x01\n" +
+	"\x11GameUpdateMessage\x12\x1f\n" +
+	"\vboard_state\x18\x01 \x03(\tR\n" +
+	"boardState\x12#\n" +
+	"\rboard_version\x18\x02 \x01(\x03R\fboardVersion\x12!\n" +
+	"\fcurrent_turn\x18\x03 \x01(\tR\vcurrentTurn\x12\x1b\n" +
+	"\tgame_mode\x18\x04 \x01(\tR\bgameMode\x12%\n" +
+	"\x0etime_remaining\x18\x05 \x01(\x03R\rtimeRemaining\x12#\n" +
+	"\rstate_version\x18\x06 \x01(\x03R\fstateVersion\"\xf1\x01\n" +
+	"\x0fGameOverMessage\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\x12\x1b\n" +
+	"\twinner_id\x18\x02 \x01(\tR\bwinnerId\x12\x1d\n" +
+	"\n" +
+	"end_reason\x18\x03 \x01(\tR\tendReason\x12\x1f\n" +
+	"\vboard_state\x18\x04 \x03(\tR\n" +
+	"boardState\x12\x1b\n" +
+	"\tgame_mode\x18\x05 \x01(\tR\bgameMode\x12%\n" +
+	"\x0ewinning_strike\x18\x06 \x03(\x05R\rwinningStrike\x12#\n" +
+	"\rstate_version\x18\a \x01(\x03R\fstateVersion\"\x8a\x01\n" +
+	"\fErrorMessage\x12\x14\n" +
+	"\x05error\x18\x01 \x01(\tR\x05error\x12\x12\n" +
+	"\x04code\x18\x02 \x01(\tR\x04code\x12\x10\n" +
+	"\x03seq\x18\x03 \x01(\x03R\x03seq\x12\x19\n" +
+	"\blast_seq\x18\x04 \x01(\x03R\alastSeq\x12#\n" +
+	"\rboard_version\x18\x05 \x01(\x03R\fboardVersion\"^\n" +
+	"\x12TimerUpdateMessage\x12%\n" +
+	"\x0etime_remaining\x18\x01 \x01(\x03R\rtimeRemaining\x12!\n" +
+	"\fcurrent_turn\x18\x02 \x01(\tR\vcurrentTurn\"I\n" +
+	"\x15MatchCancelledMessage\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\x12\x16\n" +
+	"\x06reason\x18\x02 \x01(\tR\x06reason\"\xba\x01\n" +
+	"\x12PhaseChangeMessage\x12\x14\n" +
+	"\x05phase\x18\x01 \x01(\tR\x05phase\x12%\n" +
+	"\x0eprevious_phase\x18\x02 \x01(\tR\rpreviousPhase\x12!\n" +
+	"\fcurrent_turn\x18\x03 \x01(\tR\vcurrentTurn\x12\x1f\n" +
+	"\vboard_state\x18\x04 \x03(\tR\n" +
+	"boardState\x12#\n" +
+	"\rstate_version\x18\x05 \x01(\x03R\fstateVersion\"\x87\x06\n" +
+	"\x10StateSyncMessage\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x14\n" +
+	"\x05phase\x18\x02 \x01(\tR\x05phase\x12\x1f\n" +
+	"\vboard_state\x18\x03 \x03(\tR\n" +
+	"boardState\x12#\n" +
+	"\rboard_version\x18\x04 \x01(\x03R\fboardVersion\x12\x19\n" +
+	"\blast_seq\x18\x05 \x01(\x03R\alastSeq\x12!\n" +
+	"\fcurrent_turn\x18\x06 \x01(\tR\vcurrentTurn\x12\x16\n" +
+	"\x06symbol\x18\a \x01(\tR\x06symbol\x12U\n" +
+	"\x0eplayer_symbols\x18\b \x03(\v2..tictactoe.StateSyncMessage.PlayerSymbolsEntryR\rplayerSymbols\x12\x1a\n" +
+	"\bopponent\x18\t \x01(\tR\bopponent\x12#\n" +
+	"\rtotal_players\x18\n" +
+	" \x01(\x05R\ftotalPlayers\x12\"\n" +
+	"\fdisconnected\x18\v \x03(\tR\fdisconnected\x12\x1b\n" +
+	"\tgame_mode\x18\f \x01(\tR\bgameMode\x12\x1d\n" +
+	"\n" +
+	"game_ended\x18\r \x01(\bR\tgameEnded\x12\x1b\n" +
+	"\twinner_id\x18\x0e \x01(\tR\bwinnerId\x12\x1d\n" +
+	"\n" +
+	"end_reason\x18\x0f \x01(\tR\tendReason\x12&\n" +
+	"\x0fturn_time_limit\x18\x10 \x01(\x03R\rturnTimeLimit\x12%\n" +
+	"\x0etime_remaining\x18\x11 \x01(\x03R\rtimeRemaining\x12#\n" +
+	"\rstate_version\x18\x12 \x01(\x03R\fstateVersion\x12\x1e\n" +
+	"\n" +
+	"spectating\x18\x13 \x01(\bR\n" +
+	"spectating\x12\x1e\n" +
+	"\n" +
+	"spectators\x18\x14 \x01(\x05R\n" +
+	"spectators\x1a@\n" +
+	"\x12PlayerSymbolsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x8e\x01\n" +
+	"\x18PlayerReconnectedMessage\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\x12\x1a\n" +
+	"\busername\x18\x03 \x01(\tR\busername\x12#\n" +
+	"\rstate_version\x18\x04 \x01(\x03R\fstateVersion\"\xc3\x02\n" +
+	"\x12MatchClosedMessage\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\x12\x1b\n" +
+	"\twinner_id\x18\x02 \x01(\tR\bwinnerId\x12\x1d\n" +
+	"\n" +
+	"end_reason\x18\x03 \x01(\tR\tendReason\x12\x1f\n" +
+	"\vboard_state\x18\x04 \x03(\tR\n" +
+	"boardState\x12W\n" +
+	"\x0eplayer_symbols\x18\x05 \x03(\v20.tictactoe.MatchClosedMessage.PlayerSymbolsEntryR\rplayerSymbols\x12\x1b\n" +
+	"\tgame_mode\x18\x06 \x01(\tR\bgameMode\x1a@\n" +
+	"\x12PlayerSymbolsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"w\n" +
+	"\x17MatchTerminatingMessage\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\x12\x1d\n" +
+	"\n" +
+	"end_reason\x18\x02 \x01(\tR\tendReason\x12#\n" +
+	"\rgrace_seconds\x18\x03 \x01(\x05R\fgraceSeconds\"\x8c\x01\n" +
+	"\x17ServerRestartingMessage\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\x12\x16\n" +
+	"\x06policy\x18\x02 \x01(\tR\x06policy\x12\x1f\n" +
+	"\vboard_state\x18\x03 \x03(\tR\n" +
+	"boardState\x12\x1e\n" +
+	"\n" +
+	"restorable\x18\x04 \x01(\bR\n" +
+	"restorable\"<\n" +
+	"\x0eMoveAckMessage\x12\x10\n" +
+	"\x03seq\x18\x01 \x01(\x03R\x03seq\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\x03R\aversion\"-\n" +
+	"\x15SpectatorCountMessage\x12\x14\n" +
+	"\x05count\x18\x01 \x01(\x05R\x05count\"\xc4\x01\n" +
+	"\x15ArenaStandingsMessage\x12#\n" +
+	"\rtournament_id\x18\x01 \x01(\tR\ftournamentId\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12\x1b\n" +
+	"\tcloses_at\x18\x03 \x01(\x03R\bclosesAt\x12\x14\n" +
+	"\x05games\x18\x04 \x01(\x05R\x05games\x12;\n" +
+	"\tstandings\x18\x05 \x03(\v2\x1d.tictactoe.TournamentStandingR\tstandings\"\xd6\x01\n" +
+	"\x12TournamentStanding\x12\x14\n" +
+	"\x05place\x18\x01 \x01(\x05R\x05place\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\x12\x1a\n" +
+	"\busername\x18\x03 \x01(\tR\busername\x12\x16\n" +
+	"\x06points\x18\x04 \x01(\x01R\x06points\x12\x1a\n" +
+	"\bbuchholz\x18\x05 \x01(\x01R\bbuchholz\x12)\n" +
+	"\x10sonneborn_berger\x18\x06 \x01(\x01R\x0fsonnebornBerger\x12\x16\n" +
+	"\x06streak\x18\a \x01(\x05R\x06streakB\vZ\ttictac/pbb\x06proto3"
+
+var (
+	file_match_proto_rawDescOnce sync.Once
+	file_match_proto_rawDescData []byte
+)
+
+func file_match_proto_rawDescGZIP() []byte {
+	file_match_proto_rawDescOnce.Do(func() {
+		file_match_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_match_proto_rawDesc), len(file_match_proto_rawDesc)))
+	})
+	return file_match_proto_rawDescData
+}
+
+var file_match_proto_msgTypes = make([]protoimpl.MessageInfo, 21)
+var file_match_proto_goTypes = []any{
+	(*MoveAction)(nil),               // 0: tictactoe.MoveAction
+	(*WelcomeMessage)(nil),           // 1: tictactoe.WelcomeMessage
+	(*PlayerJoinedMessage)(nil),      // 2: tictactoe.PlayerJoinedMessage
+	(*PlayerLeftMessage)(nil),        // 3: tictactoe.PlayerLeftMessage
+	(*GameUpdateMessage)(nil),        // 4: tictactoe.GameUpdateMessage
+	(*GameOverMessage)(nil),          // 5: tictactoe.GameOverMessage
+	(*ErrorMessage)(nil),             // 6: tictactoe.ErrorMessage
+	(*TimerUpdateMessage)(nil),       // 7: tictactoe.TimerUpdateMessage
+	(*MatchCancelledMessage)(nil),    // 8: tictactoe.MatchCancelledMessage
+	(*PhaseChangeMessage)(nil),       // 9: tictactoe.PhaseChangeMessage
+	(*StateSyncMessage)(nil),         // 10: tictactoe.StateSyncMessage
+	(*PlayerReconnectedMessage)(nil), // 11: tictactoe.PlayerReconnectedMessage
+	(*MatchClosedMessage)(nil),       // 12: tictactoe.MatchClosedMessage
+	(*MatchTerminatingMessage)(nil),  // 13: tictactoe.MatchTerminatingMessage
+	(*ServerRestartingMessage)(nil),  // 14: tictactoe.ServerRestartingMessage
+	(*MoveAckMessage)(nil),           // 15: tictactoe.MoveAckMessage
+	(*SpectatorCountMessage)(nil),    // 16: tictactoe.SpectatorCountMessage
+	(*ArenaStandingsMessage)(nil),    // 17: tictactoe.ArenaStandingsMessage
+	(*TournamentStanding)(nil),       // 18: tictactoe.TournamentStanding
+	nil,                              // 19: tictactoe.StateSyncMessage.PlayerSymbolsEntry
+	nil,                              // 20: tictactoe.MatchClosedMessage.PlayerSymbolsEntry
+}
+var file_match_proto_depIdxs = []int32{
+	19, // 0: tictactoe.StateSyncMessage.player_symbols:type_name -> tictactoe.StateSyncMessage.PlayerSymbolsEntry
+	20, // 1: tictactoe.MatchClosedMessage.player_symbols:type_name -> tictactoe.MatchClosedMessage.PlayerSymbolsEntry
+	18, // 2: tictactoe.ArenaStandingsMessage.standings:type_name -> tictactoe.TournamentStanding
+	3,  // [3:3] is the sub-list for method output_type
+	3,  // [3:3] is the sub-list for method input_type
+	3,  // [3:3] is the sub-list for extension type_name
+	3,  // [3:3] is the sub-list for extension extendee
+	0,  // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_match_proto_init() }
+func file_match_proto_init() {
+	if File_match_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_match_proto_rawDesc), len(file_match_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   21,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_match_proto_goTypes,
+		DependencyIndexes: file_match_proto_depIdxs,
+		MessageInfos:      file_match_proto_msgTypes,
+	}.Build()
+	File_match_proto = out.File
+	file_match_proto_goTypes = nil
+	file_match_proto_depIdxs = nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// MatchPhase represents the lifecycle phase of a match
+type MatchPhase string
+
+const (
+	PhaseWaiting  MatchPhase = "waiting"  // waiting for both players to join
+	PhaseReady    MatchPhase = "ready"    // both players seated with symbols, play starts next tick
+	PhasePlaying  MatchPhase = "playing"  // moves are accepted
+	PhaseFinished MatchPhase = "finished" // game over, no more moves
+)
+
+// phaseTransitions lists the phases reachable from each phase
+var phaseTransitions = map[MatchPhase][]MatchPhase{
+	PhaseWaiting: {PhaseReady, PhaseFinished},
+	PhaseReady:   {PhasePlaying, PhaseFinished},
+	PhasePlaying: {PhaseFinished},
+}
+
+// setPhase moves the match to the next phase, checks the invariants of the new phase
+// and broadcasts the transition. The state is left untouched if the transition is invalid.
+func setPhase(logger runtime.Logger, dispatcher runtime.MatchDispatcher, matchState *MatchState, next MatchPhase) error {
+	previous := matchState.Phase
+	allowed := false
+	for _, p := range phaseTransitions[previous] {
+		if p == next {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		logger.Error("Invalid phase transition %s -> %s", previous, next)
+		return fmt.Errorf("invalid phase transition %s -> %s", previous, next)
+	}
+
+	matchState.Phase = next
+	if err := checkPhaseInvariants(matchState); err != nil {
+		matchState.Phase = previous
+		logger.Error("Phase %s invariant violated: %v", next, err)
+		return err
+	}
+	matchState.GameStarted = next == PhasePlaying || next == PhaseFinished
+
+	logger.Info("=== PHASE CHANGE === %s -> %s", previous, next)
+
+	broadcast(dispatcher, matchState, OpCodePhaseChange, &PhaseChangeMessage{
+		Phase:         next,
+		PreviousPhase: previous,
+		CurrentTurn:   matchState.CurrentTurn,
+		BoardState:    matchState.TicTacToe,
+		StateVersion:  nextStateVersion(matchState),
+	}, nil)
+	updateLabel(logger, dispatcher, matchState)
+
+	return nil
+}
+
+// checkPhaseInvariants verifies that the match state is consistent with its current phase
+func checkPhaseInvariants(matchState *MatchState) error {
+	switch matchState.Phase {
+	case PhaseReady, PhasePlaying:
+		if len(matchState.Players) != 2 {
+			return fmt.Errorf("expected 2 players, have %d", len(matchState.Players))
+		}
+		seen := make(map[string]bool)
+		for _, p := range matchState.Players {
+			symbol := matchState.PlayerSymbols[p.GetUserId()]
+			if symbol != "X" && symbol != "O" {
+				return fmt.Errorf("player %s has no symbol", p.GetUserId())
+			}
+			if seen[symbol] {
+				return fmt.Errorf("symbol %s assigned twice", symbol)
+			}
+			seen[symbol] = true
+		}
+		if !isPlayer(matchState.CurrentTurn, matchState) {
+			return fmt.Errorf("turn holder %q is not in the match", matchState.CurrentTurn)
+		}
+	case PhaseFinished:
+		if !matchState.GameEnded {
+			return fmt.Errorf("finished match is not marked as ended")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// ProtocolVersion is the match protocol spoken by this server. Clients send theirs in the
+// "protocol_version" join metadata and are rejected if it falls outside the supported range.
+const (
+	ProtocolVersion         = 1
+	MinimumProtocolVersion  = 1
+	protocolVersionMetadata = "protocol_version"
+)
+
+// Opcodes sent by clients
+const (
+	OpCodeMove         int64 = 1 // MoveAction
+	OpCodeRequestState int64 = 2 // no payload, answered with a StateSyncMessage
+)
+
+// Opcodes sent by the server
+const (
+	OpCodeWelcome           int64 = 1  // WelcomeMessage
+	OpCodePlayerJoined      int64 = 2  // PlayerJoinedMessage
+	OpCodePlayerLeft        int64 = 3  // PlayerLeftMessage
+	OpCodeGameUpdate        int64 = 4  // GameUpdateMessage
+	OpCodeGameOver          int64 = 5  // GameOverMessage, win or forfeit
+	OpCodeError             int64 = 6  // ErrorMessage
+	OpCodeDraw              int64 = 7  // GameOverMessage
+	OpCodeTimeout           int64 = 8  // GameOverMessage
+	OpCodeTimerUpdate       int64 = 9  // TimerUpdateMessage
+	OpCodeMatchCancelled    int64 = 10 // MatchCancelledMessage
+	OpCodePhaseChange       int64 = 11 // PhaseChangeMessage
+	OpCodeStateSync         int64 = 12 // StateSyncMessage
+	OpCodePlayerReconnected int64 = 13 // PlayerReconnectedMessage
+	OpCodeMatchClosed       int64 = 14 // MatchClosedMessage
+	OpCodeMatchTerminating  int64 = 15 // MatchTerminatingMessage
+	OpCodeServerRestarting  int64 = 16 // ServerRestartingMessage
+	OpCodeMoveAck           int64 = 17 // MoveAckMessage
+	OpCodeSpectatorCount    int64 = 18 // SpectatorCountMessage
+	OpCodeArenaStandings    int64 = 19 // ArenaStandingsMessage, sent by arena tournament directors
+)
+
+// ErrorCode is the machine-readable reason carried by an ErrorMessage
+type ErrorCode string
+
+const (
+	ErrCodeInvalidAction   ErrorCode = "invalid_action"
+	ErrCodeUnknownOpCode   ErrorCode = "unknown_opcode"
+	ErrCodeNotPlayer       ErrorCode = "not_player"
+	ErrCodeNotInProgress   ErrorCode = "not_in_progress"
+	ErrCodeOutOfBounds     ErrorCode = "out_of_bounds"
+	ErrCodeCellOccupied    ErrorCode = "cell_occupied"
+	ErrCodeNotYourTurn     ErrorCode = "not_your_turn"
+	ErrCodeDuplicateAction ErrorCode = "duplicate_action"
+	ErrCodeStaleAction     ErrorCode = "stale_action"
+	ErrCodeRateLimited     ErrorCode = "rate_limited"
+	ErrCodePayloadTooLarge ErrorCode = "payload_too_large"
+)
+
+// MoveAction places the sender's symbol on the board
+type MoveAction struct {
+	Seq     int64 `json:"seq"`     // client sequence number, increasing per player
+	Version int64 `json:"version"` // board version the move was made against
+	Row     int   `json:"row"`
+	Col     int   `json:"col"`
+}
+
+// WelcomeMessage greets a player once both seats are filled
+type WelcomeMessage struct {
+	Message         string   `json:"message"`
+	PlayerCount     int      `json:"player_count"`
+	GameMode        GameMode `json:"game_mode"`
+	TurnTimeLimit   int64    `json:"turn_time_limit,omitempty"`
+	ProtocolVersion int      `json:"protocol_version"`
+}
+
+// PlayerJoinedMessage tells a player their symbol and the starting position
+type PlayerJoinedMessage struct {
+	Message       string    `json:"message"`
+	UserId        string    `json:"user_id"`
+	Username      string    `json:"username"`
+	TotalPlayers  int       `json:"total_players"`
+	Opponent      string    `json:"opponent"`
+	CurrentTurn   string    `json:"current_turn"`
+	BoardState    [9]string `json:"board_state"`
+	BoardVersion  int64     `json:"board_version"`
+	Symbol        string    `json:"symbol"`
+	GameMode      GameMode  `json:"game_mode"`
+	TurnTimeLimit int64     `json:"turn_time_limit,omitempty"`
+	TimeRemaining int64     `json:"time_remaining,omitempty"`
+	StateVersion  int64     `json:"state_version"`
+}
+
+// PlayerLeftMessage announces a departure, with a reconnect window if the seat is held
+type PlayerLeftMessage struct {
+	Message          string `json:"message"`
+	UserId           string `json:"user_id"`
+	ReconnectSeconds int    `json:"reconnect_seconds,omitempty"`
+	ClockPaused      bool   `json:"clock_paused,omitempty"`
+	StateVersion     int64  `json:"state_version"`
+}
+
+// GameUpdateMessage is broadcast after every accepted move
+type GameUpdateMessage struct {
+	BoardState    [9]string `json:"board_state"`
+	BoardVersion  int64     `json:"board_version"`
+	CurrentTurn   string    `json:"current_turn"`
+	GameMode      GameMode  `json:"game_mode"`
+	TimeRemaining int64     `json:"time_remaining,omitempty"`
+	StateVersion  int64     `json:"state_version"`
+}
+
+// GameOverMessage is broadcast when a game ends, WinnerId is empty for a draw
+type GameOverMessage struct {
+	Message       string    `json:"message"`
+	WinnerId      string    `json:"winner_id"`
+	EndReason     EndReason `json:"end_reason"`
+	BoardState    [9]string `json:"board_state"`
+	GameMode      GameMode  `json:"game_mode"`
+	WinningStrike []int     `json:"winning_strike,omitempty"`
+	StateVersion  int64     `json:"state_version"`
+}
+
+// ErrorMessage tells a single player their message was rejected
+type ErrorMessage struct {
+	Error        string    `json:"error"`
+	Code         ErrorCode `json:"code"`
+	Seq          int64     `json:"seq,omitempty"`
+	LastSeq      int64     `json:"last_seq,omitempty"`
+	BoardVersion int64     `json:"board_version,omitempty"`
+}
+
+// TimerUpdateMessage is broadcast once a second in timed mode
+type TimerUpdateMessage struct {
+	TimeRemaining int64  `json:"time_remaining"`
+	CurrentTurn   string `json:"current_turn"`
+}
+
+// MatchCancelledMessage is broadcast when invited players never showed up
+type MatchCancelledMessage struct {
+	Message string `json:"message"`
+	Reason  string `json:"reason"`
+}
+
+// PhaseChangeMessage is broadcast on every phase transition
+type PhaseChangeMessage struct {
+	Phase         MatchPhase `json:"phase"`
+	PreviousPhase MatchPhase `json:"previous_phase"`
+	CurrentTurn   string     `json:"current_turn"`
+	BoardState    [9]string  `json:"board_state"`
+	StateVersion  int64      `json:"state_version"`
+}
+
+// StateSyncMessage is a full snapshot of the match as seen by one user
+type StateSyncMessage struct {
+	UserId        string            `json:"user_id"`
+	Phase         MatchPhase        `json:"phase"`
+	BoardState    [9]string         `json:"board_state"`
+	BoardVersion  int64             `json:"board_version"`
+	LastSeq       int64             `json:"last_seq"`
+	CurrentTurn   string            `json:"current_turn"`
+	Symbol        string            `json:"symbol"`
+	PlayerSymbols map[string]string `json:"player_symbols"`
+	Opponent      string            `json:"opponent"`
+	TotalPlayers  int               `json:"total_players"`
+	Disconnected  []string          `json:"disconnected"`
+	GameMode      GameMode          `json:"game_mode"`
+	GameEnded     bool              `json:"game_ended"`
+	WinnerId      string            `json:"winner_id"`
+	EndReason     EndReason         `json:"end_reason,omitempty"`
+	TurnTimeLimit int64             `json:"turn_time_limit,omitempty"`
+	TimeRemaining int64             `json:"time_remaining,omitempty"`
+	StateVersion  int64             `json:"state_version"`
+	Spectating    bool              `json:"spectating,omitempty"`
+	Spectators    int               `json:"spectators"`
+}
+
+// PlayerReconnectedMessage tells the other players someone is back
+type PlayerReconnectedMessage struct {
+	Message      string `json:"message"`
+	UserId       string `json:"user_id"`
+	Username     string `json:"username"`
+	StateVersion int64  `json:"state_version"`
+}
+
+// MatchClosedMessage is the final result sent just before the match closes
+type MatchClosedMessage struct {
+	Message       string            `json:"message"`
+	WinnerId      string            `json:"winner_id"`
+	EndReason     EndReason         `json:"end_reason"`
+	BoardState    [9]string         `json:"board_state"`
+	PlayerSymbols map[string]string `json:"player_symbols"`
+	GameMode      GameMode          `json:"game_mode"`
+}
+
+// MatchTerminatingMessage warns players the server is stopping the match
+type MatchTerminatingMessage struct {
+	Message      string    `json:"message"`
+	EndReason    EndReason `json:"end_reason"`
+	GraceSeconds int       `json:"grace_seconds"`
+}
+
+// ServerRestartingMessage warns players the server is shutting down
+type ServerRestartingMessage struct {
+	Message    string         `json:"message"`
+	Policy     ShutdownPolicy `json:"policy"`
+	BoardState [9]string      `json:"board_state"`
+	Restorable bool           `json:"restorable"`
+}
+
+// MoveAckMessage confirms a move was applied
+type MoveAckMessage struct {
+	Seq     int64 `json:"seq"`
+	Version int64 `json:"version"`
+}
+
+// SpectatorCountMessage is broadcast whenever a spectator joins or leaves
+type SpectatorCountMessage struct {
+	Count int `json:"count"`
+}
+
+// ArenaStandingsMessage is sent to everyone watching an arena whenever its standings change
+type ArenaStandingsMessage struct {
+	TournamentId string                `json:"tournament_id"`
+	Status       TournamentStatus      `json:"status"`
+	ClosesAt     int64                 `json:"closes_at"`
+	Games        int                   `json:"games"` // games in progress
+	Standings    []*TournamentStanding `json:"standings"`
+}
+
+// nextStateVersion bumps the state version for a change that is about to be broadcast.
+// Clients that see a version more than one ahead of theirs missed a message and ask for a StateSyncMessage.
+func nextStateVersion(matchState *MatchState) int64 {
+	matchState.StateVersion++
+	return matchState.StateVersion
+}
+
+// broadcast encodes message and sends it to presences, or to everyone in the match if presences is nil.
+// The message is encoded once for each encoding in use among the recipients.
+// While the spectator feed is delayed, spectators get messages for everyone later.
+func broadcast(dispatcher runtime.MatchDispatcher, matchState *MatchState, opCode int64, message interface{}, presences []runtime.Presence) {
+	if presences == nil && spectatorFeedDelayed(matchState) {
+		// Clock ticks go stale within a second, spectators are not sent them while they lag behind
+		if opCode != OpCodeTimerUpdate {
+			queueSpectatorFeed(matchState, opCode, message)
+		}
+		if presences = playerPresences(matchState); len(presences) == 0 {
+			return
+		}
+	}
+
+	if !usesProtobuf(matchState) {
+		dispatcher.BroadcastMessage(opCode, encodeMessage(EncodingJSON, message), presences, nil, true)
+		return
+	}
+
+	if presences == nil {
+		presences = connectedPresences(matchState)
+	}
+	sendEncoded(dispatcher, matchState.Encodings, opCode, message, presences)
+}
+
+// sendEncoded sends message to presences, encoded once for each encoding in use among them.
+// Sessions missing from encodings get JSON.
+func sendEncoded(dispatcher runtime.MatchDispatcher, encodings map[string]Encoding, opCode int64, message interface{}, presences []runtime.Presence) error {
+	byEncoding := make(map[Encoding][]runtime.Presence)
+	for _, p := range presences {
+		encoding, ok := encodings[p.GetSessionId()]
+		if !ok {
+			encoding = EncodingJSON
+		}
+		byEncoding[encoding] = append(byEncoding[encoding], p)
+	}
+	for encoding, recipients := range byEncoding {
+		if err := dispatcher.BroadcastMessage(opCode, encodeMessage(encoding, message), recipients, nil, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendError tells a single player their message was rejected
+func sendError(dispatcher runtime.MatchDispatcher, matchState *MatchState, presence runtime.Presence, code ErrorCode, message string) {
+	broadcast(dispatcher, matchState, OpCodeError, &ErrorMessage{Error: message, Code: code}, []runtime.Presence{presence})
+}
+
+// checkProtocolVersion reports whether the version in the join metadata is one this server speaks
+func checkProtocolVersion(metadata map[string]string) bool {
+	version, err := strconv.Atoi(metadata[protocolVersionMetadata])
+	if err != nil {
+		return false
+	}
+	return version >= MinimumProtocolVersion && version <= ProtocolVersion
+}
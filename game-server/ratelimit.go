@@ -0,0 +1,65 @@
+package main
+
+import (
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// RateBucket is the token bucket of a single presence
+type RateBucket struct {
+	Tokens     float64 `json:"tokens"`
+	LastTick   int64   `json:"last_tick"`
+	Violations int     `json:"violations"`
+	Throttled  bool    `json:"throttled"` // the presence has been told it is sending too fast
+}
+
+// allowMessage charges a message against its sender's token bucket and payload limit.
+// Senders who keep breaking the limits are kicked from the match.
+func (m *Match) allowMessage(logger runtime.Logger, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, matchState *MatchState, message runtime.MatchData) bool {
+	bucket, ok := matchState.RateBuckets[message.GetSessionId()]
+	if !ok {
+		bucket = &RateBucket{Tokens: float64(m.config.RateLimitBurst), LastTick: tick}
+		matchState.RateBuckets[message.GetSessionId()] = bucket
+	}
+
+	// Refill for the ticks since the last message
+	bucket.Tokens += float64(tick-bucket.LastTick) * float64(m.config.RateLimitPerSec) / float64(m.tickRate)
+	if bucket.Tokens > float64(m.config.RateLimitBurst) {
+		bucket.Tokens = float64(m.config.RateLimitBurst)
+	}
+	bucket.LastTick = tick
+
+	var reason ErrorCode
+	switch {
+	case len(message.GetData()) > m.config.MaxPayloadBytes:
+		reason = ErrCodePayloadTooLarge
+	case bucket.Tokens < 1:
+		reason = ErrCodeRateLimited
+	default:
+		bucket.Tokens--
+		bucket.Throttled = false
+		return true
+	}
+
+	bucket.Violations++
+	nk.MetricsCounterAdd("tictactoe_match_message_rejected", map[string]string{"reason": string(reason)}, 1)
+
+	if bucket.Violations >= m.config.KickAfterViolations {
+		logger.Warn("Kicking user %s after %d rate limit violations", message.GetUserId(), bucket.Violations)
+		nk.MetricsCounterAdd("tictactoe_match_kicked", map[string]string{"reason": string(reason)}, 1)
+		dispatcher.MatchKick([]runtime.Presence{message})
+		delete(matchState.RateBuckets, message.GetSessionId())
+		return false
+	}
+
+	// Only tell the sender once per burst so the limiter does not amplify spam
+	if !bucket.Throttled || reason == ErrCodePayloadTooLarge {
+		bucket.Throttled = true
+		logger.Warn("Rejected message from user %s: %s", message.GetUserId(), reason)
+		if reason == ErrCodePayloadTooLarge {
+			sendError(dispatcher, matchState, message, reason, "Message too large")
+		} else {
+			sendError(dispatcher, matchState, message, reason, "Too many messages, slow down")
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"tictac/rules"
+)
+
+// holdSeat marks a player as disconnected while keeping their seat and symbol
+func (m *Match) holdSeat(logger runtime.Logger, dispatcher runtime.MatchDispatcher, tick int64, matchState *MatchState, presence runtime.Presence) {
+	matchState.Disconnected[presence.GetUserId()] = tick
+	logger.Info("Holding seat for player %s for %d seconds", presence.GetUserId(), m.config.ReconnectGraceSec)
+
+	broadcast(dispatcher, matchState, OpCodePlayerLeft, &PlayerLeftMessage{
+		Message:          "Player disconnected, waiting for them to return",
+		UserId:           presence.GetUserId(),
+		ReconnectSeconds: m.config.ReconnectGraceSec,
+		ClockPaused:      m.clockPaused(matchState),
+		StateVersion:     nextStateVersion(matchState),
+	}, nil)
+}
+
+// reconnectPlayer gives a returning player back their seat and resyncs them
+func (m *Match) reconnectPlayer(logger runtime.Logger, dispatcher runtime.MatchDispatcher, matchState *MatchState, presence runtime.Presence) {
+	delete(matchState.Disconnected, presence.GetUserId())
+	logger.Info("=== PLAYER RECONNECTED === Player %s is back in the match", presence.GetUserId())
+	stateVersion := nextStateVersion(matchState)
+
+	broadcast(dispatcher, matchState, OpCodeStateSync, newStateSyncMessage(presence.GetUserId(), matchState), []runtime.Presence{presence})
+
+	var others []runtime.Presence
+	for _, p := range matchState.Players {
+		if p.GetUserId() != presence.GetUserId() {
+			others = append(others, p)
+		}
+	}
+	if len(others) > 0 {
+		broadcast(dispatcher, matchState, OpCodePlayerReconnected, &PlayerReconnectedMessage{
+			Message:      "Player reconnected",
+			UserId:       presence.GetUserId(),
+			Username:     presence.GetUsername(),
+			StateVersion: stateVersion,
+		}, others)
+	}
+}
+
+// checkReconnectDeadlines forfeits the game for the player who has been away longest once their grace period
+// has run out. If nobody is left connected to win, the game is abandoned instead. It returns true if the game ended.
+func (m *Match) checkReconnectDeadlines(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, matchState *MatchState) bool {
+	// Earliest disconnect first, user ID breaking ties, so the outcome does not depend on map order
+	var userId string
+	var since int64
+	for id, t := range matchState.Disconnected {
+		if userId == "" || t < since || (t == since && id < userId) {
+			userId, since = id, t
+		}
+	}
+	if userId == "" || tick-since < int64(m.config.ReconnectGraceSec*m.tickRate) {
+		return false
+	}
+
+	if countConnected(matchState) == 0 {
+		logger.Info("No player reconnected in time, abandoning the game")
+		broadcast(dispatcher, matchState, OpCodeGameOver, &GameOverMessage{
+			Message:      "Both players left, the game is abandoned",
+			EndReason:    rules.EndReasonAbandoned,
+			BoardState:   matchState.TicTacToe,
+			GameMode:     matchState.GameMode,
+			StateVersion: nextStateVersion(matchState),
+		}, nil)
+		m.endGame(ctx, logger, nk, dispatcher, tick, matchState, "", rules.EndReasonAbandoned)
+		return true
+	}
+
+	logger.Info("Player %s did not reconnect in time, forfeiting", userId)
+	var winner string
+	for _, p := range matchState.Players {
+		if _, away := matchState.Disconnected[p.GetUserId()]; !away {
+			winner = p.GetUserId()
+			break
+		}
+	}
+	winnerSymbol := matchState.PlayerSymbols[winner]
+
+	broadcast(dispatcher, matchState, OpCodeGameOver, &GameOverMessage{
+		Message:      fmt.Sprintf("Opponent did not return! %s wins by forfeit!", winnerSymbol),
+		WinnerId:     winner,
+		EndReason:    rules.EndReasonForfeit,
+		BoardState:   matchState.TicTacToe,
+		GameMode:     matchState.GameMode,
+		StateVersion: nextStateVersion(matchState),
+	}, nil)
+
+	m.endGame(ctx, logger, nk, dispatcher, tick, matchState, winner, rules.EndReasonForfeit)
+	return true
+}
+
+// clockPaused reports whether the turn clock is stopped because a player is away
+func (m *Match) clockPaused(matchState *MatchState) bool {
+	return m.config.PauseClockModes[matchState.GameMode] && len(matchState.Disconnected) > 0
+}
+
+// replacePresence swaps in the new presence of a seated player, returning false if userId has no seat
+func replacePresence(matchState *MatchState, presence runtime.Presence) bool {
+	for i, p := range matchState.Players {
+		if p.GetUserId() == presence.GetUserId() {
+			matchState.Players[i] = presence
+			return true
+		}
+	}
+	return false
+}
+
+// newStateSyncMessage builds a full snapshot of the match as seen by userId
+func newStateSyncMessage(userId string, matchState *MatchState) *StateSyncMessage {
+	disconnected := make([]string, 0, len(matchState.Disconnected))
+	for id := range matchState.Disconnected {
+		disconnected = append(disconnected, id)
+	}
+
+	sync := &StateSyncMessage{
+		UserId:        userId,
+		Phase:         matchState.Phase,
+		BoardState:    matchState.TicTacToe,
+		BoardVersion:  matchState.BoardVersion,
+		LastSeq:       matchState.LastSeq[userId],
+		CurrentTurn:   matchState.CurrentTurn,
+		Symbol:        matchState.PlayerSymbols[userId],
+		PlayerSymbols: matchState.PlayerSymbols,
+		Opponent:      getOpponentName(userId, matchState),
+		TotalPlayers:  len(matchState.Players),
+		Disconnected:  disconnected,
+		GameMode:      matchState.GameMode,
+		GameEnded:     matchState.GameEnded,
+		WinnerId:      matchState.Winner,
+		EndReason:     matchState.EndReason,
+		StateVersion:  matchState.StateVersion,
+		Spectating:    !isPlayer(userId, matchState),
+		Spectators:    len(matchState.Spectators),
+	}
+
+	if matchState.GameMode == GameModeTimed {
+		sync.TurnTimeLimit = matchState.TurnTimeLimit
+		sync.TimeRemaining = matchState.TimeRemaining
+	}
+
+	return sync
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const matchRecordCollection = "matches"
+
+// MatchRecordPlayer is a seated player as stored in a match record
+type MatchRecordPlayer struct {
+	UserId   string `json:"user_id"`
+	Username string `json:"username"`
+	Symbol   string `json:"symbol"`
+}
+
+// MatchRecordConfig is the configuration a match was played with
+type MatchRecordConfig struct {
+	TickRate            int   `json:"tick_rate"`
+	TurnTimeLimit       int64 `json:"turn_time_limit,omitempty"`
+	SpectatorDelayMoves int   `json:"spectator_delay_moves"`
+	SpectatorDelaySec   int   `json:"spectator_delay_seconds"`
+	Private             bool  `json:"private"`
+	Restored            bool  `json:"restored"` // the game continued from a shutdown snapshot, see StartBoard
+}
+
+// MatchMove is one accepted move as stored in a match record
+type MatchMove struct {
+	UserId string `json:"user_id"`
+	Symbol string `json:"symbol"`
+	Row    int    `json:"row"`
+	Col    int    `json:"col"`
+	Tick   int64  `json:"tick"`
+	Time   int64  `json:"time"` // server unix time in milliseconds
+}
+
+// MatchRecord is the persisted outcome of a match, with enough detail to replay it
+type MatchRecord struct {
+	MatchId    string              `json:"match_id"`
+	GameMode   GameMode            `json:"game_mode"`
+	Config     MatchRecordConfig   `json:"config"`
+	Players    []MatchRecordPlayer `json:"players"`
+	StartBoard [9]string           `json:"start_board"`
+	Moves      []MatchMove         `json:"moves"`
+	Board      [9]string           `json:"board"`
+	Winner     string              `json:"winner_id,omitempty"`
+	EndReason  EndReason           `json:"end_reason"`
+	Public     bool                `json:"public"` // anyone may fetch the replay, not just the players
+	Tournament *TournamentRef      `json:"tournament,omitempty"`
+	StartedAt  int64               `json:"started_at,omitempty"`
+	EndedAt    int64               `json:"ended_at"`
+}
+
+// newMatchRecord builds the record of a finished match from its state
+func (m *Match) newMatchRecord(matchId string, matchState *MatchState) *MatchRecord {
+	record := &MatchRecord{
+		MatchId:  matchId,
+		GameMode: matchState.GameMode,
+		Config: MatchRecordConfig{
+			TickRate:            m.tickRate,
+			TurnTimeLimit:       matchState.TurnTimeLimit,
+			SpectatorDelayMoves: matchState.SpectatorDelayMoves,
+			SpectatorDelaySec:   matchState.SpectatorDelaySec,
+			Private:             matchState.Private,
+			Restored:            matchState.Restored,
+		},
+		StartBoard: matchState.StartBoard,
+		Moves:      matchState.Moves,
+		Board:      matchState.TicTacToe,
+		Winner:     matchState.Winner,
+		EndReason:  matchState.EndReason,
+		Public:     !matchState.Private,
+		Tournament: matchState.Tournament,
+		StartedAt:  matchState.StartedAt,
+		EndedAt:    matchState.EndedAt,
+	}
+	if record.Moves == nil {
+		record.Moves = []MatchMove{}
+	}
+	for _, p := range matchState.Players {
+		record.Players = append(record.Players, MatchRecordPlayer{
+			UserId:   p.GetUserId(),
+			Username: p.GetUsername(),
+			Symbol:   matchState.PlayerSymbols[p.GetUserId()],
+		})
+	}
+	return record
+}
+
+// persistMatchRecord writes the outcome of the match to storage, once
+func (m *Match) persistMatchRecord(ctx context.Context, nk runtime.NakamaModule, logger runtime.Logger, matchState *MatchState) {
+	if matchState.Persisted {
+		return
+	}
+
+	matchId, _ := ctx.Value(runtime.RUNTIME_CTX_MATCH_ID).(string)
+	record := m.newMatchRecord(matchId, matchState)
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		logger.Error("Failed to encode match record: %v", err)
+		return
+	}
+
+	writes := []*runtime.StorageWrite{{
+		Collection:      matchRecordCollection,
+		Key:             matchId,
+		Value:           string(recordBytes),
+		PermissionRead:  0,
+		PermissionWrite: 0,
+	}}
+	writes = append(writes, matchHistoryWrites(record)...)
+	if _, err := nk.StorageWrite(ctx, writes); err != nil {
+		logger.Error("Failed to write match record: %v", err)
+		return
+	}
+
+	matchState.Persisted = true
+	logger.Info("Wrote match record for %s (%s)", matchId, record.EndReason)
+
+	updatePlayerStats(ctx, nk, logger, record)
+}
+
+// rpcGetReplay returns the record of a finished match to its players, or to anyone if the replay is public
+func rpcGetReplay(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	// Server to server calls carry no user and may read any replay
+	userId, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+
+	var req struct {
+		MatchId string `json:"match_id"`
+	}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil || req.MatchId == "" {
+		return "", errBadInput
+	}
+
+	record, err := readMatchRecord(ctx, nk, req.MatchId)
+	if err != nil {
+		logger.Error("StorageRead error: %v", err)
+		return "", errInternal
+	}
+	if record == nil || !canReadReplay(userId, record) {
+		// Private replays look the same as missing ones to outsiders
+		return "", errNotFound
+	}
+
+	respBytes, _ := json.Marshal(record)
+	return string(respBytes), nil
+}
+
+// readMatchRecord loads a stored match record, returning nil if there is none
+func readMatchRecord(ctx context.Context, nk runtime.NakamaModule, matchId string) (*MatchRecord, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{
+		Collection: matchRecordCollection,
+		Key:        matchId,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, nil
+	}
+
+	var record MatchRecord
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// canReadReplay reports whether userId may see the record, an empty userId is the server itself
+func canReadReplay(userId string, record *MatchRecord) bool {
+	if userId == "" || record.Public {
+		return true
+	}
+	for _, p := range record.Players {
+		if p.UserId == userId {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package rules
+
+// EndReason is why a game ended, stored in match records and sent to clients
+type EndReason string
+
+const (
+	EndReasonWin         EndReason = "win"
+	EndReasonDraw        EndReason = "draw"
+	EndReasonTimeout     EndReason = "timeout"
+	EndReasonForfeit     EndReason = "forfeit"
+	EndReasonCancelled   EndReason = "cancelled"   // invited players never showed up
+	EndReasonAbandoned   EndReason = "abandoned"   // everyone left before the game finished
+	EndReasonIdle        EndReason = "idle"        // nothing happened for too long
+	EndReasonVoid        EndReason = "void"        // the server stopped before the game finished
+	EndReasonAdjudicated EndReason = "adjudicated" // stopped unfinished and decided by perfect play
+)
+
+// Result is how a finished game went for one player
+type Result string
+
+const (
+	ResultWin  Result = "win"
+	ResultLoss Result = "loss"
+	ResultDraw Result = "draw"
+	ResultVoid Result = "void" // no result, e.g. the game was idle or the server stopped
+)
+
+// ResultFor works out how a game that ended for reason, won by winnerId or nobody, went for userId
+func ResultFor(userId, winnerId string, reason EndReason) Result {
+	switch {
+	case winnerId == userId:
+		return ResultWin
+	case winnerId != "":
+		return ResultLoss
+	case reason == EndReasonDraw || reason == EndReasonAdjudicated:
+		return ResultDraw
+	}
+	return ResultVoid
+}
+
+// Winner returns the symbol with a line on the board, or "" if neither side has one
+func Winner(board Board) string {
+	switch {
+	case HasWinningLine(board, "X"):
+		return "X"
+	case HasWinningLine(board, "O"):
+		return "O"
+	}
+	return ""
+}
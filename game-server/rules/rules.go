@@ -0,0 +1,109 @@
+// Package rules holds the tic-tac-toe rules shared by the match handler and the offline tools,
+// so that a replayed game is judged exactly as it was when it was played.
+package rules
+
+import "errors"
+
+// Board is the nine cells row by row, each "X", "O" or "" for an empty cell
+type Board = [9]string
+
+// WinLines are the cell indexes of every three in a row
+var WinLines = [8][3]int{
+	{0, 1, 2}, // Rows
+	{3, 4, 5},
+	{6, 7, 8},
+	{0, 3, 6}, // Columns
+	{1, 4, 7},
+	{2, 5, 8},
+	{0, 4, 8}, // Diagonals
+	{2, 4, 6},
+}
+
+// Reasons a move is not allowed
+var (
+	ErrOutOfBounds = errors.New("out of bounds move")
+	ErrOccupied    = errors.New("cell already occupied")
+	ErrDecided     = errors.New("game is already decided")
+)
+
+// CheckMove reports why a move on row and col may not be played on board, or nil if it may
+func CheckMove(board Board, row, col int) error {
+	switch {
+	case row < 0 || row > 2 || col < 0 || col > 2:
+		return ErrOutOfBounds
+	case board[row*3+col] != "":
+		return ErrOccupied
+	case HasWinningLine(board, "X") || HasWinningLine(board, "O"):
+		return ErrDecided
+	}
+	return nil
+}
+
+// WinningLine returns the line symbol has three in a row on, reporting false if there is none
+func WinningLine(board Board, symbol string) ([3]int, bool) {
+	for _, win := range WinLines {
+		if board[win[0]] == symbol && board[win[1]] == symbol && board[win[2]] == symbol {
+			return win, true
+		}
+	}
+	return [3]int{}, false
+}
+
+// HasWinningLine reports whether symbol has three in a row on board
+func HasWinningLine(board Board, symbol string) bool {
+	_, ok := WinningLine(board, symbol)
+	return ok
+}
+
+// IsBoardFull reports whether every cell on board is taken
+func IsBoardFull(board Board) bool {
+	for _, cell := range board {
+		if cell == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// CountSymbol returns how many cells on board hold symbol
+func CountSymbol(board Board, symbol string) int {
+	count := 0
+	for _, cell := range board {
+		if cell == symbol {
+			count++
+		}
+	}
+	return count
+}
+
+// SideToMove returns the symbol whose turn it is on board, X moves first
+func SideToMove(board Board) string {
+	if CountSymbol(board, "X") > CountSymbol(board, "O") {
+		return "O"
+	}
+	return "X"
+}
+
+// IsReachable reports whether board can arise in play: X moves first, turns alternate
+// and nobody moved after the game was won
+func IsReachable(board Board) bool {
+	for _, cell := range board {
+		if cell != "" && cell != "X" && cell != "O" {
+			return false
+		}
+	}
+	x, o := CountSymbol(board, "X"), CountSymbol(board, "O")
+	if x != o && x != o+1 {
+		return false
+	}
+	xWins, oWins := HasWinningLine(board, "X"), HasWinningLine(board, "O")
+	switch {
+	case xWins && oWins:
+		return false
+	case xWins:
+		return x == o+1
+	case oWins:
+		return x == o
+	}
+	return true
+}
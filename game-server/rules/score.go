@@ -0,0 +1,38 @@
+package rules
+
+// Leaderboard periods, every game mode has one leaderboard per period
+const (
+	PeriodWeekly  = "weekly"  // reset every Monday at 00:00 UTC
+	PeriodAllTime = "alltime" // never reset
+)
+
+// Periods lists every leaderboard period
+var Periods = []string{PeriodWeekly, PeriodAllTime}
+
+// DrawPoints is what each player scores for a draw
+const DrawPoints = 1
+
+// LeaderboardId returns the leaderboard of a game mode and period
+func LeaderboardId(mode, period string) string {
+	return "tictactoe_" + mode + "_" + period
+}
+
+// WinPoints returns the leaderboard points a win is worth in the given game mode,
+// timed games are worth more than classic ones
+func WinPoints(mode string) int64 {
+	if mode == "timed" {
+		return 3
+	}
+	return 2
+}
+
+// ResultPoints returns the points added to a player's score for a game ending in result
+func ResultPoints(mode string, result Result) int64 {
+	switch result {
+	case ResultWin:
+		return WinPoints(mode)
+	case ResultDraw:
+		return DrawPoints
+	}
+	return 0
+}
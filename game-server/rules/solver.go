@@ -0,0 +1,70 @@
+package rules
+
+import "sync"
+
+var (
+	perfectPlayOnce  sync.Once
+	perfectPlayTable map[Board]int
+)
+
+// PerfectPlayValue returns the outcome of the position under perfect play by both sides:
+// 1 if X wins, -1 if O wins and 0 for a draw. X always moves first.
+func PerfectPlayValue(board Board) int {
+	perfectPlayOnce.Do(func() {
+		perfectPlayTable = make(map[Board]int)
+		solvePosition(Board{}, perfectPlayTable)
+	})
+	if value, ok := perfectPlayTable[board]; ok {
+		return value
+	}
+	// Positions that cannot arise in play are solved on demand
+	return solvePosition(board, make(map[Board]int))
+}
+
+// Adjudicate returns the symbol that wins the position with perfect play, or "" if it is a draw
+func Adjudicate(board Board) string {
+	switch PerfectPlayValue(board) {
+	case 1:
+		return "X"
+	case -1:
+		return "O"
+	}
+	return ""
+}
+
+// solvePosition fills table with the minimax value of board and every position reachable from it
+func solvePosition(board Board, table map[Board]int) int {
+	if value, ok := table[board]; ok {
+		return value
+	}
+
+	value := 0
+	switch {
+	case HasWinningLine(board, "X"):
+		value = 1
+	case HasWinningLine(board, "O"):
+		value = -1
+	case IsBoardFull(board):
+		value = 0
+	default:
+		symbol, best := SideToMove(board), -2
+		if symbol == "O" {
+			best = 2
+		}
+		for i, cell := range board {
+			if cell != "" {
+				continue
+			}
+			next := board
+			next[i] = symbol
+			v := solvePosition(next, table)
+			if (symbol == "X" && v > best) || (symbol == "O" && v < best) {
+				best = v
+			}
+		}
+		value = best
+	}
+
+	table[board] = value
+	return value
+}
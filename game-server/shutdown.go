@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"tictac/rules"
+)
+
+const (
+	snapshotCollection = "match_snapshots"
+
+	// Notification code telling a player a snapshotted game can be restored
+	notificationRestoreAvailable = 101
+	// Notification code telling a player their opponent restored a game
+	notificationRestoreStarted = 102
+)
+
+// ShutdownPolicy decides what happens to games still in progress when the server stops
+type ShutdownPolicy string
+
+const (
+	ShutdownPolicyVoid       ShutdownPolicy = "void"       // no result, players may restore the game later
+	ShutdownPolicyAdjudicate ShutdownPolicy = "adjudicate" // result decided by the perfect-play table
+)
+
+// MatchSignalData is the payload of a signal sent to a running match
+type MatchSignalData struct {
+	Type string `json:"type"`
+}
+
+// MatchSnapshot is the saved position of a game interrupted by a server shutdown
+type MatchSnapshot struct {
+	MatchId       string              `json:"match_id"`
+	GameMode      GameMode            `json:"game_mode"`
+	Players       []MatchRecordPlayer `json:"players"`
+	Board         [9]string           `json:"board"`
+	PlayerSymbols map[string]string   `json:"player_symbols"`
+	CurrentTurn   string              `json:"current_turn"`
+	TimeRemaining int64               `json:"time_remaining,omitempty"`
+	Restorable    bool                `json:"restorable"`
+	CreatedAt     int64               `json:"created_at"`
+}
+
+// shutdownHook asks every running match to save itself before the server goes away
+func shutdownHook(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule) {
+	logger.Info("=== SERVER SHUTDOWN === Snapshotting running matches")
+
+	matches, err := nk.MatchList(ctx, 1000, true, "", nil, nil, "")
+	if err != nil {
+		logger.Error("Failed to list matches on shutdown: %v", err)
+		return
+	}
+
+	signalBytes, _ := json.Marshal(MatchSignalData{Type: "shutdown"})
+	for _, match := range matches {
+		if _, err := nk.MatchSignal(ctx, match.GetMatchId(), string(signalBytes)); err != nil {
+			logger.Error("Failed to signal match %s on shutdown: %v", match.GetMatchId(), err)
+		}
+	}
+}
+
+// shutdownMatch snapshots a game in progress, warns its players and settles it according to the shutdown policy
+func (m *Match) shutdownMatch(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, matchState *MatchState) {
+	if matchState.GameEnded {
+		return
+	}
+
+	policy := m.config.ShutdownPolicy
+	inProgress := matchState.Phase == PhaseReady || matchState.Phase == PhasePlaying
+	// Adjudicated games are settled here and now, only voided ones are kept to be restored
+	if inProgress && policy == ShutdownPolicyVoid {
+		m.writeSnapshot(ctx, logger, nk, matchState)
+	}
+
+	broadcast(dispatcher, matchState, OpCodeServerRestarting, &ServerRestartingMessage{
+		Message:    "Server is restarting",
+		Policy:     policy,
+		BoardState: matchState.TicTacToe,
+		Restorable: inProgress && policy == ShutdownPolicyVoid,
+	}, nil)
+
+	if inProgress && policy == ShutdownPolicyAdjudicate {
+		winner := adjudicatedWinner(matchState)
+		logger.Info("Adjudicated unfinished game, winner: %q", winner)
+		m.endGame(ctx, logger, nk, dispatcher, tick, matchState, winner, rules.EndReasonAdjudicated)
+		return
+	}
+
+	m.endGame(ctx, logger, nk, dispatcher, tick, matchState, "", rules.EndReasonVoid)
+}
+
+// writeSnapshot stores the position for each player and lets them know it can be restored
+func (m *Match) writeSnapshot(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, matchState *MatchState) {
+	matchId, _ := ctx.Value(runtime.RUNTIME_CTX_MATCH_ID).(string)
+	snapshot := &MatchSnapshot{
+		MatchId:       matchId,
+		GameMode:      matchState.GameMode,
+		Board:         matchState.TicTacToe,
+		PlayerSymbols: matchState.PlayerSymbols,
+		CurrentTurn:   matchState.CurrentTurn,
+		TimeRemaining: matchState.TimeRemaining,
+		Restorable:    true,
+		CreatedAt:     m.clock.Now().Unix(),
+	}
+	for _, p := range matchState.Players {
+		snapshot.Players = append(snapshot.Players, MatchRecordPlayer{
+			UserId:   p.GetUserId(),
+			Username: p.GetUsername(),
+			Symbol:   matchState.PlayerSymbols[p.GetUserId()],
+		})
+	}
+
+	snapshotBytes, err := json.Marshal(snapshot)
+	if err != nil {
+		logger.Error("Failed to encode match snapshot: %v", err)
+		return
+	}
+
+	var writes []*runtime.StorageWrite
+	for _, p := range snapshot.Players {
+		writes = append(writes, &runtime.StorageWrite{
+			Collection:      snapshotCollection,
+			Key:             matchId,
+			UserID:          p.UserId,
+			Value:           string(snapshotBytes),
+			PermissionRead:  1,
+			PermissionWrite: 0,
+		})
+	}
+	if _, err := nk.StorageWrite(ctx, writes); err != nil {
+		logger.Error("Failed to write match snapshot: %v", err)
+		return
+	}
+	logger.Info("Wrote snapshot of match %s for %d players", matchId, len(writes))
+
+	for _, p := range snapshot.Players {
+		content := map[string]interface{}{
+			"match_id":  matchId,
+			"game_mode": snapshot.GameMode,
+		}
+		if err := nk.NotificationSend(ctx, p.UserId, "Your game was interrupted and can be restored", content, notificationRestoreAvailable, "", true); err != nil {
+			logger.Error("Failed to notify player %s about restore: %v", p.UserId, err)
+		}
+	}
+}
+
+// snapshotParam decodes the snapshot a restored match is created with
+func snapshotParam(logger runtime.Logger, params map[string]interface{}) (*MatchSnapshot, bool) {
+	if _, ok := params["restore"]; !ok {
+		return nil, false
+	}
+	var snapshot MatchSnapshot
+	if !paramInto(params, "restore", &snapshot) {
+		logger.Error("Malformed snapshot in match params")
+		return nil, false
+	}
+	return &snapshot, true
+}
+
+// restoreSnapshot puts a snapshotted position back on the board of a new match
+func restoreSnapshot(matchState *MatchState, snapshot *MatchSnapshot) {
+	matchState.TicTacToe = snapshot.Board
+	matchState.CurrentTurn = snapshot.CurrentTurn
+	for userId, symbol := range snapshot.PlayerSymbols {
+		matchState.PlayerSymbols[userId] = symbol
+	}
+	if snapshot.TimeRemaining > 0 && matchState.GameMode == GameModeTimed {
+		matchState.TimeRemaining = snapshot.TimeRemaining
+	}
+}
+
+// rpcListRestorableMatches returns the caller's games that were voided by a shutdown
+func rpcListRestorableMatches(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userId, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userId == "" {
+		return "", errNoUserId
+	}
+
+	objects, _, err := nk.StorageList(ctx, "", userId, snapshotCollection, 100, "")
+	if err != nil {
+		logger.Error("StorageList error: %v", err)
+		return "", errInternal
+	}
+
+	snapshots := []*MatchSnapshot{}
+	for _, object := range objects {
+		var snapshot MatchSnapshot
+		if err := json.Unmarshal([]byte(object.GetValue()), &snapshot); err != nil {
+			logger.Error("snapshot unmarshal error: %v", err)
+			continue
+		}
+		if snapshot.Restorable {
+			snapshots = append(snapshots, &snapshot)
+		}
+	}
+
+	respBytes, _ := json.Marshal(snapshots)
+	return string(respBytes), nil
+}
+
+// rpcRestoreMatch starts a new match from one of the caller's snapshots and invites both players
+func rpcRestoreMatch(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userId, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userId == "" {
+		return "", errNoUserId
+	}
+
+	var req struct {
+		MatchId string `json:"match_id"`
+	}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil || req.MatchId == "" {
+		return "", errBadInput
+	}
+
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{
+		Collection: snapshotCollection,
+		Key:        req.MatchId,
+		UserID:     userId,
+	}})
+	if err != nil {
+		logger.Error("StorageRead error: %v", err)
+		return "", errInternal
+	}
+	if len(objects) == 0 {
+		return "", errNotFound
+	}
+
+	var snapshot MatchSnapshot
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), &snapshot); err != nil {
+		logger.Error("snapshot unmarshal error: %v", err)
+		return "", errInternal
+	}
+	if !snapshot.Restorable {
+		return "", errNotFound
+	}
+
+	var invited []string
+	var deletes []*runtime.StorageDelete
+	for _, p := range snapshot.Players {
+		invited = append(invited, p.UserId)
+		deletes = append(deletes, &runtime.StorageDelete{
+			Collection: snapshotCollection,
+			Key:        snapshot.MatchId,
+			UserID:     p.UserId,
+		})
+	}
+
+	matchId, err := nk.MatchCreate(ctx, "lobby_"+string(snapshot.GameMode), matchParams(map[string]interface{}{
+		"mode":    snapshot.GameMode,
+		"invited": invited,
+		"restore": snapshot,
+	}))
+	if err != nil {
+		logger.Error("MatchCreate error: %v", err)
+		return "", errInternal
+	}
+
+	if err := nk.StorageDelete(ctx, deletes); err != nil {
+		logger.Error("Failed to delete restored snapshot: %v", err)
+	}
+
+	for _, p := range snapshot.Players {
+		if p.UserId == userId {
+			continue
+		}
+		content := map[string]interface{}{"match_id": matchId}
+		if err := nk.NotificationSend(ctx, p.UserId, "Your interrupted game has been restored", content, notificationRestoreStarted, userId, true); err != nil {
+			logger.Error("Failed to notify player %s about restored match: %v", p.UserId, err)
+		}
+	}
+
+	logger.Info("Restored match %s as %s", snapshot.MatchId, matchId)
+	respBytes, _ := json.Marshal(map[string]string{"match_id": matchId})
+	return string(respBytes), nil
+}
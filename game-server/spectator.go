@@ -0,0 +1,168 @@
+package main
+
+import (
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Role is what a presence asked to be in its "role" join metadata
+type Role string
+
+const (
+	RolePlayer    Role = "player"    // default, takes a seat
+	RoleSpectator Role = "spectator" // watches without a seat
+
+	roleMetadata = "role"
+)
+
+// parseRole reads the role from the join metadata, reporting false for unknown values
+func parseRole(metadata map[string]string) (Role, bool) {
+	switch Role(metadata[roleMetadata]) {
+	case "", RolePlayer:
+		return RolePlayer, true
+	case RoleSpectator:
+		return RoleSpectator, true
+	}
+	return "", false
+}
+
+// SpectatorDelay is a per match spectator delay, given when a match or tournament is created.
+// A field left out keeps the server default.
+type SpectatorDelay struct {
+	Moves *int `json:"spectator_delay_moves,omitempty"`
+	Sec   *int `json:"spectator_delay_seconds,omitempty"`
+}
+
+// valid reports whether the delays given are usable
+func (s SpectatorDelay) valid() bool {
+	return (s.Moves == nil || *s.Moves >= 0) && (s.Sec == nil || *s.Sec >= 0)
+}
+
+// addParams sets the delays given as match params, read back by MatchInit
+func (s SpectatorDelay) addParams(params map[string]interface{}) {
+	if s.Moves != nil {
+		params["spectator_delay_moves"] = *s.Moves
+	}
+	if s.Sec != nil {
+		params["spectator_delay_seconds"] = *s.Sec
+	}
+}
+
+// isSpectator reports whether sessionId is watching the match
+func isSpectator(sessionId string, matchState *MatchState) bool {
+	for _, p := range matchState.Spectators {
+		if p.GetSessionId() == sessionId {
+			return true
+		}
+	}
+	return false
+}
+
+// addSpectator seats nobody, it syncs the new spectator and tells everyone the audience grew
+func addSpectator(logger runtime.Logger, dispatcher runtime.MatchDispatcher, matchState *MatchState, presence runtime.Presence) {
+	delete(matchState.PendingSpectators, presence.GetSessionId())
+	matchState.Spectators = append(matchState.Spectators, presence)
+	logger.Info("=== SPECTATOR JOINED === User %s is watching (spectators: %d)", presence.GetUserId(), len(matchState.Spectators))
+
+	broadcast(dispatcher, matchState, OpCodeStateSync, spectatorStateSync(presence.GetUserId(), matchState), []runtime.Presence{presence})
+	broadcastSpectatorCount(dispatcher, matchState)
+}
+
+// removeSpectator drops a spectator, returning false if the presence was not spectating
+func removeSpectator(logger runtime.Logger, dispatcher runtime.MatchDispatcher, matchState *MatchState, presence runtime.Presence) bool {
+	for i, p := range matchState.Spectators {
+		if p.GetSessionId() == presence.GetSessionId() {
+			matchState.Spectators = append(matchState.Spectators[:i], matchState.Spectators[i+1:]...)
+			logger.Info("Spectator %s left match (spectators: %d)", presence.GetUserId(), len(matchState.Spectators))
+			broadcastSpectatorCount(dispatcher, matchState)
+			return true
+		}
+	}
+	return false
+}
+
+// broadcastSpectatorCount tells everyone in the match how many people are watching.
+// The count is never delayed, it says nothing about the game.
+func broadcastSpectatorCount(dispatcher runtime.MatchDispatcher, matchState *MatchState) {
+	presences := connectedPresences(matchState)
+	if len(presences) == 0 {
+		return
+	}
+	broadcast(dispatcher, matchState, OpCodeSpectatorCount, &SpectatorCountMessage{
+		Count: len(matchState.Spectators),
+	}, presences)
+}
+
+// SpectatorFeedEntry is a broadcast held back from spectators
+type SpectatorFeedEntry struct {
+	OpCode       int64
+	Message      interface{}
+	BoardVersion int64             // board version when the message was sent to the players
+	Tick         int64             // tick the entry was stamped on, see Stamped
+	Stamped      bool              // the entry has been given the tick it was queued on
+	Sync         *StateSyncMessage // state right after the message, shown to spectators who join once it is released
+}
+
+// spectatorFeedDelayed reports whether spectators currently lag behind the players
+func spectatorFeedDelayed(matchState *MatchState) bool {
+	return !matchState.GameEnded && (matchState.SpectatorDelayMoves > 0 || matchState.SpectatorDelaySec > 0)
+}
+
+// queueSpectatorFeed holds a broadcast back from spectators
+func queueSpectatorFeed(matchState *MatchState, opCode int64, message interface{}) {
+	matchState.SpectatorFeed = append(matchState.SpectatorFeed, &SpectatorFeedEntry{
+		OpCode:       opCode,
+		Message:      message,
+		BoardVersion: matchState.BoardVersion,
+		Sync:         newStateSyncMessage("", matchState),
+	})
+}
+
+// releaseSpectatorFeed sends spectators the held back broadcasts that are far enough behind the players.
+// Entries queued since the last tick are stamped with the current tick first.
+func (m *Match) releaseSpectatorFeed(dispatcher runtime.MatchDispatcher, tick int64, matchState *MatchState) {
+	delayTicks := int64(matchState.SpectatorDelaySec * m.tickRate)
+	released := 0
+	for _, entry := range matchState.SpectatorFeed {
+		if !entry.Stamped {
+			entry.Tick = tick
+			entry.Stamped = true
+		}
+	}
+	for _, entry := range matchState.SpectatorFeed {
+		if tick-entry.Tick < delayTicks || matchState.BoardVersion-entry.BoardVersion < int64(matchState.SpectatorDelayMoves) {
+			break
+		}
+		sendSpectatorFeedEntry(dispatcher, matchState, entry)
+		released++
+	}
+	matchState.SpectatorFeed = matchState.SpectatorFeed[released:]
+}
+
+// flushSpectatorFeed sends spectators everything still held back, once the game can no longer be helped
+func flushSpectatorFeed(dispatcher runtime.MatchDispatcher, matchState *MatchState) {
+	for _, entry := range matchState.SpectatorFeed {
+		sendSpectatorFeedEntry(dispatcher, matchState, entry)
+	}
+	matchState.SpectatorFeed = nil
+}
+
+// sendSpectatorFeedEntry releases one held back broadcast to the spectators
+func sendSpectatorFeedEntry(dispatcher runtime.MatchDispatcher, matchState *MatchState, entry *SpectatorFeedEntry) {
+	matchState.SpectatorView = entry.Sync
+	if len(matchState.Spectators) > 0 {
+		broadcast(dispatcher, matchState, entry.OpCode, entry.Message, matchState.Spectators)
+	}
+}
+
+// spectatorStateSync is the state as a spectator may see it, which lags behind while broadcasts are held back
+func spectatorStateSync(userId string, matchState *MatchState) *StateSyncMessage {
+	sync := newStateSyncMessage(userId, matchState)
+	if len(matchState.SpectatorFeed) > 0 {
+		delayed := *matchState.SpectatorView
+		delayed.UserId = userId
+		delayed.Spectating = true
+		delayed.Spectators = sync.Spectators
+		return &delayed
+	}
+	return sync
+}
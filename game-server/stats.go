@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"tictac/rules"
+)
+
+const (
+	playerStatsCollection = "stats"
+	playerStatsKey        = "player"
+	playerStatsRetries    = 5
+)
+
+// ModeStats are a player's results in one game mode, or across all of them
+type ModeStats struct {
+	Played        int   `json:"played"` // games with a result, void games are counted separately
+	Wins          int   `json:"wins"`
+	Losses        int   `json:"losses"`
+	Draws         int   `json:"draws"`
+	Void          int   `json:"void"`
+	TimeoutLosses int   `json:"timeout_losses"`
+	CurrentStreak int   `json:"current_streak"` // wins in a row, reset by a loss or draw
+	BestStreak    int   `json:"best_streak"`
+	GamesAsX      int   `json:"games_as_x"`
+	GamesAsO      int   `json:"games_as_o"`
+	Moves         int64 `json:"moves"`
+	MoveTimeMs    int64 `json:"move_time_ms"` // total time taken over Moves
+	AvgMoveMs     int64 `json:"avg_move_ms"`
+}
+
+// PlayerStats is the stats object kept in storage for every player who finished a game
+type PlayerStats struct {
+	UserId    string                  `json:"user_id"`
+	Overall   ModeStats               `json:"overall"`
+	Modes     map[GameMode]*ModeStats `json:"modes"`
+	UpdatedAt int64                   `json:"updated_at"`
+}
+
+// addResult counts one finished game
+func (s *ModeStats) addResult(result MatchResult, timedOut bool, symbol string, moves, moveTimeMs int64) {
+	switch result {
+	case rules.ResultVoid:
+		s.Void++
+		return
+	case rules.ResultWin:
+		s.Wins++
+		s.CurrentStreak++
+		if s.CurrentStreak > s.BestStreak {
+			s.BestStreak = s.CurrentStreak
+		}
+	case rules.ResultLoss:
+		s.Losses++
+		s.CurrentStreak = 0
+		if timedOut {
+			s.TimeoutLosses++
+		}
+	case rules.ResultDraw:
+		s.Draws++
+		s.CurrentStreak = 0
+	}
+
+	s.Played++
+	if symbol == "X" {
+		s.GamesAsX++
+	} else {
+		s.GamesAsO++
+	}
+	s.Moves += moves
+	s.MoveTimeMs += moveTimeMs
+	if s.Moves > 0 {
+		s.AvgMoveMs = s.MoveTimeMs / s.Moves
+	}
+}
+
+// moveTimes returns how many moves userId made in the record and how long they took in total,
+// each move timed from the move before it or from the start of play
+func moveTimes(userId string, record *MatchRecord) (int64, int64) {
+	var moves, total int64
+	last := record.StartedAt * 1000
+	for _, move := range record.Moves {
+		if move.UserId == userId {
+			moves++
+			if move.Time > last {
+				total += move.Time - last
+			}
+		}
+		last = move.Time
+	}
+	return moves, total
+}
+
+// updatePlayerStats adds a finished game to the stats of each of its players.
+// Games that never started are not counted.
+func updatePlayerStats(ctx context.Context, nk runtime.NakamaModule, logger runtime.Logger, record *MatchRecord) {
+	if record.StartedAt == 0 {
+		return
+	}
+	for _, p := range record.Players {
+		result := rules.ResultFor(p.UserId, record.Winner, record.EndReason)
+		timedOut := record.EndReason == rules.EndReasonTimeout
+		moves, moveTimeMs := moveTimes(p.UserId, record)
+
+		err := updateStatsObject(ctx, nk, p.UserId, func(stats *PlayerStats) {
+			mode, ok := stats.Modes[record.GameMode]
+			if !ok {
+				mode = &ModeStats{}
+				stats.Modes[record.GameMode] = mode
+			}
+			mode.addResult(result, timedOut, p.Symbol, moves, moveTimeMs)
+			stats.Overall.addResult(result, timedOut, p.Symbol, moves, moveTimeMs)
+			stats.UpdatedAt = record.EndedAt
+		})
+		if err != nil {
+			logger.Error("Failed to update stats of %s: %v", p.UserId, err)
+			continue
+		}
+		logger.Info("Updated stats of %s: %s in %s mode", p.UserId, result, record.GameMode)
+	}
+}
+
+// updateStatsObject applies update to the stored stats of userId. The write is conditional on the
+// version that was read, so concurrent games ending for the same player retry instead of losing a result.
+func updateStatsObject(ctx context.Context, nk runtime.NakamaModule, userId string, update func(*PlayerStats)) error {
+	var err error
+	for attempt := 0; attempt < playerStatsRetries; attempt++ {
+		var stats *PlayerStats
+		var version string
+		stats, version, err = readPlayerStats(ctx, nk, userId)
+		if err != nil {
+			return err
+		}
+		if version == "" {
+			version = "*" // only write if nobody created the object meanwhile
+		}
+		update(stats)
+
+		statsBytes, _ := json.Marshal(stats)
+		_, err = nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+			Collection:      playerStatsCollection,
+			Key:             playerStatsKey,
+			UserID:          userId,
+			Value:           string(statsBytes),
+			Version:         version,
+			PermissionRead:  2,
+			PermissionWrite: 0,
+		}})
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// readPlayerStats loads the stats of userId with the version of the stored object,
+// returning empty stats and no version if the player has none yet
+func readPlayerStats(ctx context.Context, nk runtime.NakamaModule, userId string) (*PlayerStats, string, error) {
+	stats := &PlayerStats{UserId: userId, Modes: map[GameMode]*ModeStats{}}
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{
+		Collection: playerStatsCollection,
+		Key:        playerStatsKey,
+		UserID:     userId,
+	}})
+	if err != nil {
+		return nil, "", err
+	}
+	if len(objects) == 0 {
+		return stats, "", nil
+	}
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), stats); err != nil {
+		return nil, "", err
+	}
+	if stats.Modes == nil {
+		stats.Modes = map[GameMode]*ModeStats{}
+	}
+	return stats, objects[0].GetVersion(), nil
+}
+
+// rpcGetPlayerStats returns the stats of user_id, or of the caller if none is given
+func rpcGetPlayerStats(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userId, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+
+	var req struct {
+		UserId string `json:"user_id"`
+	}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			return "", errBadInput
+		}
+	}
+	if req.UserId == "" {
+		if userId == "" {
+			return "", errBadInput
+		}
+		req.UserId = userId
+	}
+
+	stats, _, err := readPlayerStats(ctx, nk, req.UserId)
+	if err != nil {
+		logger.Error("StorageRead error: %v", err)
+		return "", errInternal
+	}
+
+	respBytes, _ := json.Marshal(stats)
+	return string(respBytes), nil
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"tictac/rules"
+)
+
+const (
+	// swissMaxGames is how many void games a pairing may take before it is scored as a draw
+	swissMaxGames = 3
+	// swissPairingBudget caps the search for a pairing without repeat opponents
+	swissPairingBudget = 100000
+)
+
+// SwissPlayer is an entrant's record in a Swiss tournament
+type SwissPlayer struct {
+	UserId    string    `json:"user_id"`
+	Points    float64   `json:"points"`    // 1 for a win or bye, 0.5 for a draw
+	Opponents []string  `json:"opponents"` // opponent of each round, empty for a bye
+	Results   []float64 `json:"results"`   // points scored in each round
+	Colours   string    `json:"colours"`   // symbol played in each round, "-" for a bye
+	Byes      int       `json:"byes"`
+}
+
+// colourBalance is how many more games the player had as X than as O
+func (p *SwissPlayer) colourBalance() int {
+	balance := 0
+	for _, c := range p.Colours {
+		switch c {
+		case 'X':
+			balance++
+		case 'O':
+			balance--
+		}
+	}
+	return balance
+}
+
+// lastColour returns the symbol of the player's last game, skipping byes
+func (p *SwissPlayer) lastColour() byte {
+	for i := len(p.Colours) - 1; i >= 0; i-- {
+		if p.Colours[i] != '-' {
+			return p.Colours[i]
+		}
+	}
+	return 0
+}
+
+// SwissGame is one pairing of a Swiss round
+type SwissGame struct {
+	Round   int    `json:"round"`
+	Index   int    `json:"index"`
+	PlayerX string `json:"player_x"`
+	PlayerO string `json:"player_o"`
+	MatchId string `json:"match_id,omitempty"` // game being played, cleared to replay a void game
+	Games   int    `json:"games"`
+	Decided bool   `json:"decided"`
+	Winner  string `json:"winner,omitempty"` // empty for a draw
+	Result  string `json:"result,omitempty"`
+}
+
+// Swiss is a fixed number of rounds in which players meet others on the same score and never the same opponent twice
+type Swiss struct {
+	Rounds   int            `json:"rounds"`
+	Round    int            `json:"round"` // current round, counted from 0
+	Players  []*SwissPlayer `json:"players"`
+	Pairings [][]*SwissGame `json:"pairings"`
+}
+
+// player returns the Swiss record of a user, or nil
+func (s *Swiss) player(userId string) *SwissPlayer {
+	for _, p := range s.Players {
+		if p.UserId == userId {
+			return p
+		}
+	}
+	return nil
+}
+
+// start sets the number of rounds if none was given and pairs the first round
+func (s *Swiss) start(d *directorContext) error {
+	if s.Rounds <= 0 {
+		// Enough rounds to separate a single winner
+		s.Rounds = 1
+		for 1<<s.Rounds < len(d.state.Entrants) {
+			s.Rounds++
+		}
+	}
+	s.Players = nil
+	for _, e := range d.state.Entrants {
+		s.Players = append(s.Players, &SwissPlayer{UserId: e.UserId, Opponents: []string{}, Results: []float64{}})
+	}
+	s.Round = 0
+	s.Pairings = nil
+	s.pairRound(d)
+	return nil
+}
+
+// tick starts every game that is ready and moves on to the next round once the current one is decided
+func (s *Swiss) tick(d *directorContext) {
+	if s.Round >= len(s.Pairings) {
+		return
+	}
+	round := s.Pairings[s.Round]
+	decided := true
+	for _, game := range round {
+		if game.Decided {
+			continue
+		}
+		decided = false
+		if game.MatchId == "" {
+			ref := &TournamentRef{Id: d.state.Id, Kind: FormatSwiss, Round: s.Round, Game: game.Index}
+			symbols := map[string]string{game.PlayerX: "X", game.PlayerO: "O"}
+			if matchId, err := d.createGame(ref, game.PlayerX, game.PlayerO, symbols); err == nil {
+				game.MatchId = matchId
+				game.Games++
+				d.changed()
+			}
+		}
+	}
+	if !decided {
+		return
+	}
+
+	s.recordScores(d)
+	if s.Round+1 < s.Rounds {
+		s.Round++
+		s.pairRound(d)
+		s.tick(d)
+		return
+	}
+	d.state.Status = TournamentFinished
+	d.changed()
+	d.logger.Info("=== TOURNAMENT FINISHED === %s after %d Swiss rounds", d.state.Id, s.Rounds)
+}
+
+// pairRound pairs the current round: players are ordered by points then rating, the lowest ranked player
+// without a bye sits out if the count is odd, and the rest are paired down the order avoiding repeat opponents
+func (s *Swiss) pairRound(d *directorContext) {
+	ratings := map[string]int64{}
+	for _, e := range d.state.Entrants {
+		ratings[e.UserId] = e.Rating
+	}
+	order := append([]*SwissPlayer(nil), s.Players...)
+	sort.SliceStable(order, func(i, j int) bool {
+		if order[i].Points != order[j].Points {
+			return order[i].Points > order[j].Points
+		}
+		return ratings[order[i].UserId] > ratings[order[j].UserId]
+	})
+
+	if len(order)%2 == 1 {
+		bye := len(order) - 1
+		for i := len(order) - 1; i >= 0; i-- {
+			if order[i].Byes == 0 {
+				bye = i
+				break
+			}
+		}
+		p := order[bye]
+		order = append(order[:bye], order[bye+1:]...)
+		p.Byes++
+		p.Points++
+		p.Opponents = append(p.Opponents, "")
+		p.Results = append(p.Results, 1)
+		p.Colours += "-"
+		d.logger.Info("Swiss round %d: bye for %s", s.Round+1, p.UserId)
+	}
+
+	budget := swissPairingBudget
+	pairs, ok := swissPairs(order, true, &budget)
+	if !ok {
+		// Small or late events can run out of new opponents
+		d.logger.Warn("Swiss round %d of %s needs repeat pairings", s.Round+1, d.state.Id)
+		pairs, _ = swissPairs(order, false, &budget)
+	}
+
+	round := make([]*SwissGame, 0, len(pairs))
+	for i, pair := range pairs {
+		x, o := swissColours(pair[0], pair[1])
+		round = append(round, &SwissGame{Round: s.Round, Index: i, PlayerX: x.UserId, PlayerO: o.UserId})
+	}
+	s.Pairings = append(s.Pairings, round)
+	d.changed()
+	d.logger.Info("Swiss round %d of %s paired: %d games", s.Round+1, d.state.Id, len(round))
+}
+
+// swissPairs pairs players in order, each with the highest placed player still free, backtracking when the
+// rest cannot be paired. Repeat opponents are refused if unique is set. The budget bounds the search.
+func swissPairs(players []*SwissPlayer, unique bool, budget *int) ([][2]*SwissPlayer, bool) {
+	if len(players) == 0 {
+		return nil, true
+	}
+	first := players[0]
+	for i := 1; i < len(players); i++ {
+		if unique && *budget <= 0 {
+			return nil, false
+		}
+		*budget--
+		candidate := players[i]
+		if unique && swissMet(first, candidate) {
+			continue
+		}
+		rest := make([]*SwissPlayer, 0, len(players)-2)
+		rest = append(rest, players[1:i]...)
+		rest = append(rest, players[i+1:]...)
+		if pairs, ok := swissPairs(rest, unique, budget); ok {
+			return append([][2]*SwissPlayer{{first, candidate}}, pairs...), true
+		}
+	}
+	if !unique && len(players) >= 2 {
+		// Without the uniqueness rule pairing in order always works
+		pairs, _ := swissPairs(players[2:], false, budget)
+		return append([][2]*SwissPlayer{{players[0], players[1]}}, pairs...), true
+	}
+	return nil, false
+}
+
+// swissMet reports whether two players have already played each other
+func swissMet(a, b *SwissPlayer) bool {
+	for _, opponent := range a.Opponents {
+		if opponent == b.UserId {
+			return true
+		}
+	}
+	return false
+}
+
+// swissColours decides who plays X: the player who had X less often, then the one who had O last,
+// then the higher placed player a
+func swissColours(a, b *SwissPlayer) (*SwissPlayer, *SwissPlayer) {
+	balanceA, balanceB := a.colourBalance(), b.colourBalance()
+	switch {
+	case balanceA < balanceB:
+		return a, b
+	case balanceB < balanceA:
+		return b, a
+	case a.lastColour() == 'X' && b.lastColour() != 'X':
+		return b, a
+	}
+	return a, b
+}
+
+// result scores a finished game. Players who never joined lose, void games are replayed a few times
+// and then scored as a draw.
+func (s *Swiss) result(d *directorContext, record *MatchRecord) {
+	ref := record.Tournament
+	if ref.Round != s.Round || ref.Round >= len(s.Pairings) || ref.Game < 0 || ref.Game >= len(s.Pairings[ref.Round]) {
+		d.logger.Error("Result of %s is for an unknown Swiss game", record.MatchId)
+		return
+	}
+	game := s.Pairings[ref.Round][ref.Game]
+	if game.Decided || game.MatchId != record.MatchId {
+		d.logger.Warn("Ignoring stale result of %s", record.MatchId)
+		return
+	}
+
+	present := map[string]bool{}
+	for _, p := range record.Players {
+		present[p.UserId] = true
+	}
+
+	switch {
+	case record.Winner == game.PlayerX || record.Winner == game.PlayerO:
+		s.decide(d, game, record.Winner, false, "played")
+	case record.EndReason == rules.EndReasonDraw || record.EndReason == rules.EndReasonAdjudicated:
+		s.decide(d, game, "", false, "draw")
+	case !present[game.PlayerX] && !present[game.PlayerO]:
+		s.decide(d, game, "", true, "no_show")
+	case !present[game.PlayerO] && record.StartedAt == 0:
+		s.decide(d, game, game.PlayerX, false, "no_show")
+	case !present[game.PlayerX] && record.StartedAt == 0:
+		s.decide(d, game, game.PlayerO, false, "no_show")
+	case game.Games >= swissMaxGames:
+		s.decide(d, game, "", false, "draw")
+	default:
+		d.logger.Info("Swiss game %d of round %d ended %s, replaying", game.Index, game.Round+1, record.EndReason)
+		game.MatchId = ""
+		d.changed()
+	}
+}
+
+// decide scores a game for both players, a double forfeit scores nothing for either
+func (s *Swiss) decide(d *directorContext, game *SwissGame, winner string, forfeit bool, result string) {
+	game.Decided = true
+	game.Winner = winner
+	game.Result = result
+	d.changed()
+
+	for _, side := range [][2]string{{game.PlayerX, "X"}, {game.PlayerO, "O"}} {
+		p := s.player(side[0])
+		if p == nil {
+			continue
+		}
+		opponent := game.PlayerO
+		if side[0] == game.PlayerO {
+			opponent = game.PlayerX
+		}
+		points := 0.0
+		switch {
+		case forfeit:
+		case winner == p.UserId:
+			points = 1
+		case winner == "":
+			points = 0.5
+		}
+		p.Points += points
+		p.Opponents = append(p.Opponents, opponent)
+		p.Results = append(p.Results, points)
+		p.Colours += side[1]
+	}
+	d.logger.Info("Swiss game %d of round %d decided (%s), winner: %q", game.Index, game.Round+1, result, winner)
+}
+
+// recordScores writes every player's points, with Buchholz as the subscore, to the Nakama tournament
+func (s *Swiss) recordScores(d *directorContext) {
+	for _, standing := range s.standings(d.state) {
+		d.recordScore(standing.UserId, int64(standing.Points*2), int64(standing.Buchholz*2))
+	}
+}
+
+// standings orders players by points, then Buchholz (the sum of their opponents' points),
+// then Sonneborn-Berger (the points of the opponents they beat, plus half for those they drew with)
+func (s *Swiss) standings(t *TournamentState) []*TournamentStanding {
+	points := map[string]float64{}
+	for _, p := range s.Players {
+		points[p.UserId] = p.Points
+	}
+
+	standings := make([]*TournamentStanding, 0, len(s.Players))
+	for _, p := range s.Players {
+		standing := &TournamentStanding{UserId: p.UserId, Points: p.Points}
+		if e := t.entrant(p.UserId); e != nil {
+			standing.Username = e.Username
+		}
+		for i, opponent := range p.Opponents {
+			if opponent == "" {
+				continue
+			}
+			standing.Buchholz += points[opponent]
+			standing.SonnebornBerger += points[opponent] * p.Results[i]
+		}
+		standings = append(standings, standing)
+	}
+
+	sort.SliceStable(standings, func(i, j int) bool {
+		a, b := standings[i], standings[j]
+		if a.Points != b.Points {
+			return a.Points > b.Points
+		}
+		if a.Buchholz != b.Buchholz {
+			return a.Buchholz > b.Buchholz
+		}
+		return a.SonnebornBerger > b.SonnebornBerger
+	})
+	for i, standing := range standings {
+		standing.Place = i + 1
+		if i > 0 {
+			prev := standings[i-1]
+			if prev.Points == standing.Points && prev.Buchholz == standing.Buchholz && prev.SonnebornBerger == standing.SonnebornBerger {
+				standing.Place = prev.Place
+			}
+		}
+	}
+	return standings
+}
+
+// placings returns the places of the standings, players level on every tie-break share a place
+func (s *Swiss) placings(t *TournamentState) map[string]int {
+	placings := map[string]int{}
+	for _, standing := range s.standings(t) {
+		placings[standing.UserId] = standing.Place
+	}
+	return placings
+}
+
+// rpcCreateSwissTournament is the server to server RPC creating a Swiss tournament
+func rpcCreateSwissTournament(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if userId, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string); userId != "" {
+		return "", errPermissionDenied
+	}
+
+	req, err := parseCreateTournamentRequest(payload)
+	if err != nil {
+		return "", err
+	}
+	if req.Rounds < 0 || req.Rounds > 20 {
+		return "", errBadInput
+	}
+	state, err := createTournament(ctx, logger, nk, FormatSwiss, req, systemClock{}.Now().Unix())
+	if err != nil {
+		return "", err
+	}
+
+	respBytes, _ := json.Marshal(state)
+	return string(respBytes), nil
+}
@@ -0,0 +1,895 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"regexp"
+	"slices"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	tournamentCollection     = "tournaments"
+	tournamentDirectorModule = "tournament_director"
+	tournamentDirectorTick   = 1 // director ticks per second
+
+	// Notification code telling a player their tournament game is ready to join
+	notificationTournamentGame = 110
+	// Notification code telling a player how they finished in a tournament
+	notificationTournamentResult = 111
+	// Notification code telling entrants a tournament was called off
+	notificationTournamentCancelled = 112
+)
+
+// TournamentFormat is how a tournament pairs its players
+type TournamentFormat string
+
+const (
+	FormatBracket TournamentFormat = "bracket" // single elimination
+	FormatSwiss   TournamentFormat = "swiss"   // fixed rounds paired by score
+	FormatArena   TournamentFormat = "arena"   // continuous pairing until the arena closes
+)
+
+// tournamentCategory returns the Nakama tournament category of a format, so clients can list events by format
+func tournamentCategory(format TournamentFormat) int {
+	switch format {
+	case FormatBracket:
+		return 1
+	case FormatSwiss:
+		return 2
+	case FormatArena:
+		return 3
+	}
+	return 0
+}
+
+// TournamentStatus is where a tournament is in its life
+type TournamentStatus string
+
+const (
+	TournamentSignup    TournamentStatus = "signup"    // players may join
+	TournamentRunning   TournamentStatus = "running"   // games are being played
+	TournamentFinished  TournamentStatus = "finished"  // every game is decided, rewards follow when the event ends
+	TournamentCancelled TournamentStatus = "cancelled" // too few players signed up
+	TournamentEnded     TournamentStatus = "ended"     // the Nakama tournament ended and rewards were paid
+)
+
+// TournamentRef ties a game to the tournament it was created for
+type TournamentRef struct {
+	Id    string           `json:"id"`
+	Kind  TournamentFormat `json:"kind"`
+	Round int              `json:"round"`
+	Game  int              `json:"game"` // index of the game within the round
+}
+
+// TournamentEntrant is a player signed up for a tournament
+type TournamentEntrant struct {
+	UserId   string `json:"user_id"`
+	Username string `json:"username"`
+	Rating   int64  `json:"rating"` // all-time score in the tournament's mode at signup
+	Seed     int    `json:"seed,omitempty"`
+}
+
+// TournamentState is everything the server keeps about a tournament, stored under its ID.
+// Only the tournament's director match writes it once the tournament is created.
+type TournamentState struct {
+	Id              string               `json:"id"`
+	Title           string               `json:"title"`
+	Format          TournamentFormat     `json:"format"`
+	Mode            GameMode             `json:"mode"`
+	Status          TournamentStatus     `json:"status"`
+	SignupEndsAt    int64                `json:"signup_ends_at"` // unix time
+	EndsAt          int64                `json:"ends_at"`        // unix time the Nakama tournament ends
+	MaxSize         int                  `json:"max_size"`
+	NoShowSec       int                  `json:"no_show_seconds"` // seconds players have to join a tournament game
+	Rewards         []int64              `json:"rewards"`         // coins by finishing place, first place first
+	Entrants        []*TournamentEntrant `json:"entrants"`
+	Bracket         *Bracket             `json:"bracket,omitempty"`
+	Swiss           *Swiss               `json:"swiss,omitempty"`
+	Arena           *Arena               `json:"arena,omitempty"`
+	RewardsPaid     bool                 `json:"rewards_paid"`
+	DirectorMatchId string               `json:"director_match_id,omitempty"`
+	UpdatedAt       int64                `json:"updated_at"`
+	SpectatorDelay                       // how far behind spectators watch the tournament's games
+}
+
+// entrant returns the entrant with the user ID, or nil
+func (t *TournamentState) entrant(userId string) *TournamentEntrant {
+	for _, e := range t.Entrants {
+		if e.UserId == userId {
+			return e
+		}
+	}
+	return nil
+}
+
+// tournamentPairing is implemented by the state of every format
+type tournamentPairing interface {
+	// start pairs the first games once signup has closed
+	start(d *directorContext) error
+	// tick creates games that are ready and finishes the tournament once all are decided
+	tick(d *directorContext)
+	// result applies the outcome of one of the tournament's games
+	result(d *directorContext, record *MatchRecord)
+	// placings returns each entrant's finishing place, 1 for first. Players sharing a place leave a gap
+	// after it, as in competition ranking.
+	placings(t *TournamentState) map[string]int
+	// standings returns the entrants best first
+	standings(t *TournamentState) []*TournamentStanding
+}
+
+// TournamentStanding is an entrant's place in a tournament, the tie-breaks are only used by Swiss events
+// and the streak only by arenas
+type TournamentStanding struct {
+	Place           int     `json:"place"`
+	UserId          string  `json:"user_id"`
+	Username        string  `json:"username"`
+	Points          float64 `json:"points"`
+	Buchholz        float64 `json:"buchholz,omitempty"`
+	SonnebornBerger float64 `json:"sonneborn_berger,omitempty"`
+	Streak          int     `json:"streak,omitempty"`
+}
+
+// pairing returns the format specific state of the tournament
+func (t *TournamentState) pairing() tournamentPairing {
+	switch t.Format {
+	case FormatBracket:
+		if t.Bracket == nil {
+			t.Bracket = &Bracket{}
+		}
+		return t.Bracket
+	case FormatSwiss:
+		if t.Swiss == nil {
+			t.Swiss = &Swiss{}
+		}
+		return t.Swiss
+	case FormatArena:
+		if t.Arena == nil {
+			t.Arena = &Arena{}
+		}
+		return t.Arena
+	}
+	return nil
+}
+
+var (
+	tournamentIdPattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+	errTournamentEnded  = runtime.NewError("tournament has ended", 9) // FAILED_PRECONDITION
+)
+
+// readTournament loads a tournament with the version of its storage object, returning nil if there is none
+func readTournament(ctx context.Context, nk runtime.NakamaModule, id string) (*TournamentState, string, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{
+		Collection: tournamentCollection,
+		Key:        id,
+	}})
+	if err != nil {
+		return nil, "", err
+	}
+	if len(objects) == 0 {
+		return nil, "", nil
+	}
+	var state TournamentState
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), &state); err != nil {
+		return nil, "", err
+	}
+	return &state, objects[0].GetVersion(), nil
+}
+
+// writeTournament stores a tournament if the stored object still has the given version, "*" if it must not exist yet.
+// It returns the new version.
+func writeTournament(ctx context.Context, nk runtime.NakamaModule, state *TournamentState, version string) (string, error) {
+	stateBytes, _ := json.Marshal(state)
+	acks, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+		Collection:      tournamentCollection,
+		Key:             state.Id,
+		Value:           string(stateBytes),
+		Version:         version,
+		PermissionRead:  0,
+		PermissionWrite: 0,
+	}})
+	if err != nil {
+		return "", err
+	}
+	return acks[0].GetVersion(), nil
+}
+
+// TournamentSignal is a request handled by a tournament's director match
+type TournamentSignal struct {
+	Type     string       `json:"type"` // join, result, end or shutdown
+	UserId   string       `json:"user_id,omitempty"`
+	Username string       `json:"username,omitempty"`
+	Record   *MatchRecord `json:"record,omitempty"`
+}
+
+// tournamentSignalReply is the director's answer to a signal
+type tournamentSignalReply struct {
+	Error string `json:"error,omitempty"`
+}
+
+// ensureDirector returns the ID of the tournament's director match, starting one if it is not running,
+// for example after a server restart
+func ensureDirector(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, id string) (string, error) {
+	state, _, err := readTournament(ctx, nk, id)
+	if err != nil {
+		return "", err
+	}
+	if state == nil {
+		return "", errNotFound
+	}
+	if state.Status == TournamentEnded {
+		return "", errTournamentEnded
+	}
+	if state.DirectorMatchId != "" {
+		if match, err := nk.MatchGet(ctx, state.DirectorMatchId); err == nil && match != nil {
+			return state.DirectorMatchId, nil
+		}
+	}
+
+	matchId, err := nk.MatchCreate(ctx, tournamentDirectorModule, matchParams(map[string]interface{}{"tournament_id": id}))
+	if err != nil {
+		// Another caller may have started the director first
+		if state, _, readErr := readTournament(ctx, nk, id); readErr == nil && state != nil && state.DirectorMatchId != "" {
+			return state.DirectorMatchId, nil
+		}
+		return "", err
+	}
+	logger.Info("Started director %s for tournament %s", matchId, id)
+	return matchId, nil
+}
+
+// signalDirector hands a signal to the tournament's director, starting it if needed
+func signalDirector(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, id string, signal *TournamentSignal) (*tournamentSignalReply, error) {
+	signalBytes, _ := json.Marshal(signal)
+	var lastErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		matchId, err := ensureDirector(ctx, logger, nk, id)
+		if err != nil {
+			return nil, err
+		}
+		data, err := nk.MatchSignal(ctx, matchId, string(signalBytes))
+		if err != nil {
+			// The director stopped between the check and the signal
+			lastErr = err
+			continue
+		}
+		var reply tournamentSignalReply
+		if err := json.Unmarshal([]byte(data), &reply); err != nil {
+			return nil, err
+		}
+		return &reply, nil
+	}
+	return nil, lastErr
+}
+
+// reportTournamentResult tells the director of the game's tournament how the game ended
+func reportTournamentResult(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, record *MatchRecord) {
+	reply, err := signalDirector(ctx, logger, nk, record.Tournament.Id, &TournamentSignal{Type: "result", Record: record})
+	if err == errTournamentEnded {
+		logger.Info("Tournament %s ended before match %s finished", record.Tournament.Id, record.MatchId)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to report result of %s to tournament %s: %v", record.MatchId, record.Tournament.Id, err)
+		return
+	}
+	if reply.Error != "" {
+		logger.Error("Tournament %s rejected result of %s: %s", record.Tournament.Id, record.MatchId, reply.Error)
+	}
+}
+
+// tournamentEndHook pays the rewards of a tournament once Nakama ends it
+func tournamentEndHook(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, tournament *api.Tournament, end, reset int64) error {
+	state, _, err := readTournament(ctx, nk, tournament.GetId())
+	if err != nil {
+		logger.Error("Failed to read tournament %s: %v", tournament.GetId(), err)
+		return err
+	}
+	if state == nil || state.Status == TournamentEnded {
+		return nil
+	}
+
+	logger.Info("=== TOURNAMENT ENDED === %s", tournament.GetId())
+	reply, err := signalDirector(ctx, logger, nk, tournament.GetId(), &TournamentSignal{Type: "end"})
+	if err != nil {
+		logger.Error("Failed to end tournament %s: %v", tournament.GetId(), err)
+		return err
+	}
+	if reply.Error != "" {
+		logger.Error("Tournament %s did not end cleanly: %s", tournament.GetId(), reply.Error)
+	}
+	return nil
+}
+
+// rpcJoinTournament signs the caller up for a tournament while signup is open. Arenas may be joined until they close,
+// which also puts a player who missed a game back in the queue.
+func rpcJoinTournament(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userId, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userId == "" {
+		return "", errNoUserId
+	}
+	username, _ := ctx.Value(runtime.RUNTIME_CTX_USERNAME).(string)
+
+	var req struct {
+		TournamentId string `json:"tournament_id"`
+	}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil || !tournamentIdPattern.MatchString(req.TournamentId) {
+		return "", errBadInput
+	}
+
+	reply, err := signalDirector(ctx, logger, nk, req.TournamentId, &TournamentSignal{Type: "join", UserId: userId, Username: username})
+	if err == errNotFound || err == errTournamentEnded {
+		return "", err
+	}
+	if err != nil {
+		logger.Error("Failed to join tournament %s: %v", req.TournamentId, err)
+		return "", errInternal
+	}
+	if reply.Error != "" {
+		return "", runtime.NewError(reply.Error, 9) // FAILED_PRECONDITION
+	}
+	return "{}", nil
+}
+
+// rpcGetTournament returns the state of a tournament: entrants, pairings and results
+func rpcGetTournament(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var req struct {
+		TournamentId string `json:"tournament_id"`
+	}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil || !tournamentIdPattern.MatchString(req.TournamentId) {
+		return "", errBadInput
+	}
+
+	state, _, err := readTournament(ctx, nk, req.TournamentId)
+	if err != nil {
+		logger.Error("StorageRead error: %v", err)
+		return "", errInternal
+	}
+	if state == nil {
+		return "", errNotFound
+	}
+	if state.Format != FormatArena {
+		// Only arena directors can be joined, to watch the live standings
+		state.DirectorMatchId = ""
+	}
+
+	respBytes, _ := json.Marshal(state)
+	return string(respBytes), nil
+}
+
+// rpcGetTournamentStandings returns the entrants of a tournament best first
+func rpcGetTournamentStandings(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var req struct {
+		TournamentId string `json:"tournament_id"`
+	}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil || !tournamentIdPattern.MatchString(req.TournamentId) {
+		return "", errBadInput
+	}
+
+	state, _, err := readTournament(ctx, nk, req.TournamentId)
+	if err != nil {
+		logger.Error("StorageRead error: %v", err)
+		return "", errInternal
+	}
+	if state == nil {
+		return "", errNotFound
+	}
+
+	standings := []*TournamentStanding{}
+	if state.Status != TournamentSignup && state.Status != TournamentCancelled {
+		standings = state.pairing().standings(state)
+	}
+	respBytes, _ := json.Marshal(map[string]interface{}{
+		"tournament_id": state.Id,
+		"format":        state.Format,
+		"status":        state.Status,
+		"standings":     standings,
+	})
+	return string(respBytes), nil
+}
+
+// createTournamentRequest is the payload of the admin RPCs creating a tournament
+type createTournamentRequest struct {
+	Id          string   `json:"tournament_id"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Mode        GameMode `json:"mode"`
+	SignupSec   int      `json:"signup_seconds"`
+	DurationSec int      `json:"duration_seconds"` // from the end of signup to the end of the event
+	MaxSize     int      `json:"max_size"`
+	NoShowSec   int      `json:"no_show_seconds"`
+	Rewards     []int64  `json:"rewards"`
+	Rounds      int      `json:"rounds"` // Swiss only, 0 picks enough rounds for a single winner
+	SpectatorDelay
+}
+
+// parseCreateTournamentRequest decodes and checks a create request, applying defaults
+func parseCreateTournamentRequest(payload string) (*createTournamentRequest, error) {
+	req := &createTournamentRequest{
+		Mode:        GameModeClassic,
+		SignupSec:   600,
+		DurationSec: 7200,
+		MaxSize:     64,
+		NoShowSec:   120,
+	}
+	if err := json.Unmarshal([]byte(payload), req); err != nil {
+		return nil, errBadInput
+	}
+	if !tournamentIdPattern.MatchString(req.Id) || req.SignupSec <= 0 || req.DurationSec <= 0 || req.NoShowSec <= 0 {
+		return nil, errBadInput
+	}
+	if req.MaxSize < 2 || req.MaxSize > 1024 {
+		return nil, errBadInput
+	}
+	switch req.Mode {
+	case GameModeClassic, GameModeTimed:
+	default:
+		return nil, errBadInput
+	}
+	for _, coins := range req.Rewards {
+		if coins < 0 {
+			return nil, errBadInput
+		}
+	}
+	if !req.SpectatorDelay.valid() {
+		return nil, errBadInput
+	}
+	if req.Title == "" {
+		req.Title = req.Id
+	}
+	return req, nil
+}
+
+// createTournament creates the Nakama tournament and the stored state of a new event, then starts its director
+func createTournament(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, format TournamentFormat, req *createTournamentRequest, now int64) (*TournamentState, error) {
+	state := &TournamentState{
+		Id:             req.Id,
+		Title:          req.Title,
+		Format:         format,
+		Mode:           req.Mode,
+		Status:         TournamentSignup,
+		SignupEndsAt:   now + int64(req.SignupSec),
+		EndsAt:         now + int64(req.SignupSec+req.DurationSec),
+		MaxSize:        req.MaxSize,
+		NoShowSec:      req.NoShowSec,
+		SpectatorDelay: req.SpectatorDelay,
+		Rewards:        req.Rewards,
+		Entrants:       []*TournamentEntrant{},
+		UpdatedAt:      now,
+	}
+	if state.Rewards == nil {
+		state.Rewards = []int64{}
+	}
+	switch format {
+	case FormatSwiss:
+		state.Swiss = &Swiss{Rounds: req.Rounds}
+	case FormatArena:
+		// The event outlasts the arena so games still being played when it closes can count
+		state.Arena = &Arena{ClosesAt: state.EndsAt}
+		state.EndsAt += arenaGraceSec(req.NoShowSec)
+	}
+
+	// The stored state goes first so an existing ID is refused before a Nakama tournament is touched
+	if _, err := writeTournament(ctx, nk, state, "*"); err != nil {
+		return nil, runtime.NewError("tournament already exists", 6) // ALREADY_EXISTS
+	}
+
+	metadata := map[string]interface{}{"format": format, "mode": req.Mode}
+	duration := int(state.EndsAt - now)
+	if err := nk.TournamentCreate(ctx, state.Id, true, "desc", "best", "", metadata, req.Title, req.Description,
+		tournamentCategory(format), int(now), int(state.EndsAt), duration, req.MaxSize, 1000000, true, true); err != nil {
+		logger.Error("TournamentCreate error: %v", err)
+		if err := nk.StorageDelete(ctx, []*runtime.StorageDelete{{Collection: tournamentCollection, Key: state.Id}}); err != nil {
+			logger.Error("Failed to remove state of tournament %s: %v", state.Id, err)
+		}
+		return nil, errInternal
+	}
+
+	if _, err := ensureDirector(ctx, logger, nk, state.Id); err != nil {
+		// The director is started again by the first join or result
+		logger.Error("Failed to start director of tournament %s: %v", state.Id, err)
+	}
+	logger.Info("=== TOURNAMENT CREATED === %s (%s, %s mode), signup until %d", state.Id, format, state.Mode, state.SignupEndsAt)
+	return state, nil
+}
+
+// directorContext is what a format needs while the director handles a tick or a signal
+type directorContext struct {
+	ctx    context.Context
+	logger runtime.Logger
+	nk     runtime.NakamaModule
+	state  *TournamentState
+	now    int64
+	dirty  bool
+
+	dispatcher runtime.MatchDispatcher
+}
+
+// changed marks the tournament state for writing at the end of the tick
+func (d *directorContext) changed() {
+	d.dirty = true
+}
+
+// createGame starts a private game between two entrants and invites them to it.
+// Symbols maps user IDs to the symbol they must play, nil leaves it to the join order.
+func (d *directorContext) createGame(ref *TournamentRef, a, b string, symbols map[string]string) (string, error) {
+	params := map[string]interface{}{
+		"invited":             []string{a, b},
+		"private":             true,
+		"tournament":          ref,
+		"reservation_seconds": d.state.NoShowSec,
+	}
+	if symbols != nil {
+		params["symbols"] = symbols
+	}
+	if d.state.Format == FormatArena {
+		params["max_game_seconds"] = arenaMaxGameSec
+	}
+	d.state.SpectatorDelay.addParams(params)
+	matchId, err := d.nk.MatchCreate(d.ctx, "lobby_"+string(d.state.Mode), matchParams(params))
+	if err != nil {
+		d.logger.Error("Failed to create game %d of round %d in tournament %s: %v", ref.Game, ref.Round, ref.Id, err)
+		return "", err
+	}
+
+	for _, pair := range [][2]string{{a, b}, {b, a}} {
+		opponent := ""
+		if e := d.state.entrant(pair[1]); e != nil {
+			opponent = e.Username
+		}
+		d.notify(pair[0], "Your tournament game is ready", notificationTournamentGame, map[string]interface{}{
+			"tournament_id": ref.Id,
+			"match_id":      matchId,
+			"round":         ref.Round,
+			"opponent_id":   pair[1],
+			"opponent":      opponent,
+		})
+	}
+	d.logger.Info("Tournament %s round %d game %d: %s vs %s in match %s", ref.Id, ref.Round, ref.Game, a, b, matchId)
+	return matchId, nil
+}
+
+// notify sends a persistent notification to an entrant
+func (d *directorContext) notify(userId, subject string, code int, content map[string]interface{}) {
+	if err := d.nk.NotificationSend(d.ctx, userId, subject, content, code, "", true); err != nil {
+		d.logger.Error("Failed to notify %s: %v", userId, err)
+	}
+}
+
+// recordScore writes an entrant's score to the Nakama tournament
+func (d *directorContext) recordScore(userId string, score, subscore int64) {
+	username := ""
+	if e := d.state.entrant(userId); e != nil {
+		username = e.Username
+	}
+	if _, err := d.nk.TournamentRecordWrite(d.ctx, d.state.Id, userId, username, score, subscore, nil, nil); err != nil {
+		d.logger.Error("Failed to write tournament record of %s: %v", userId, err)
+	}
+}
+
+// payRewards credits every entrant the coins of their finishing place, once
+func (d *directorContext) payRewards() {
+	if d.state.RewardsPaid {
+		return
+	}
+	placings := map[string]int{}
+	if pairing := d.state.pairing(); pairing != nil && d.state.Status != TournamentCancelled {
+		placings = pairing.placings(d.state)
+	}
+	for _, e := range d.state.Entrants {
+		place, placed := placings[e.UserId]
+		coins := int64(0)
+		if placed && place >= 1 && place <= len(d.state.Rewards) {
+			coins = d.state.Rewards[place-1]
+		}
+		if coins > 0 {
+			metadata := map[string]interface{}{"tournament_id": d.state.Id, "place": place}
+			if _, _, err := d.nk.WalletUpdate(d.ctx, e.UserId, map[string]int64{"coins": coins}, metadata, true); err != nil {
+				d.logger.Error("Failed to pay %d coins to %s: %v", coins, e.UserId, err)
+				continue
+			}
+		}
+		content := map[string]interface{}{"tournament_id": d.state.Id, "coins": coins}
+		if placed {
+			content["place"] = place
+		}
+		d.notify(e.UserId, "Tournament finished", notificationTournamentResult, content)
+	}
+	d.state.RewardsPaid = true
+	d.changed()
+	d.logger.Info("Paid rewards of tournament %s", d.state.Id)
+}
+
+// TournamentDirector is the authoritative match that runs one tournament: it takes signups, pairs games
+// and applies results. Being a match, everything it does happens one tick or signal at a time.
+type TournamentDirector struct {
+	clock Clock
+}
+
+// DirectorState is the director's match state
+type DirectorState struct {
+	Tournament    *TournamentState
+	Version       string           // storage version of the last write, so a second director cannot overwrite this one
+	InitialStatus TournamentStatus // status when the director started
+	Done          bool             // the director stops at the end of this tick
+	Watchers      []runtime.Presence
+	Encodings     map[string]Encoding // session ID to the encoding a watcher asked for
+}
+
+// NewTournamentDirector returns a director using the system clock
+func NewTournamentDirector() *TournamentDirector {
+	return &TournamentDirector{clock: systemClock{}}
+}
+
+// MatchInit loads the tournament and claims it for this director
+func (td *TournamentDirector) MatchInit(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, params map[string]interface{}) (interface{}, int, string) {
+	id, _ := params["tournament_id"].(string)
+	matchId, _ := ctx.Value(runtime.RUNTIME_CTX_MATCH_ID).(string)
+
+	state, version, err := readTournament(ctx, nk, id)
+	if err != nil || state == nil {
+		logger.Error("Director cannot load tournament %q: %v", id, err)
+		return nil, tournamentDirectorTick, ""
+	}
+	state.DirectorMatchId = matchId
+	if version, err = writeTournament(ctx, nk, state, version); err != nil {
+		logger.Error("Director lost the claim on tournament %s: %v", id, err)
+		return nil, tournamentDirectorTick, ""
+	}
+
+	labelBytes, _ := json.Marshal(map[string]interface{}{"tournament_id": id, "format": state.Format})
+	logger.Info("=== TOURNAMENT DIRECTOR STARTED === %s (%s)", id, state.Status)
+	return &DirectorState{Tournament: state, Version: version, InitialStatus: state.Status, Encodings: make(map[string]Encoding)}, tournamentDirectorTick, string(labelBytes)
+}
+
+// MatchJoinAttempt lets anyone watch the standings of an arena, nobody plays in the director
+func (td *TournamentDirector) MatchJoinAttempt(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, presence runtime.Presence, metadata map[string]string) (interface{}, bool, string) {
+	ds := state.(*DirectorState)
+	if ds.Tournament.Format != FormatArena {
+		return state, false, "tournament directors cannot be joined"
+	}
+	encoding, ok := parseEncoding(metadata)
+	if !ok {
+		return state, false, "unsupported encoding, use json or protobuf"
+	}
+	ds.Encodings[presence.GetSessionId()] = encoding
+	return state, true, ""
+}
+
+// MatchJoin sends the current standings of the arena to the new watchers
+func (td *TournamentDirector) MatchJoin(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, presences []runtime.Presence) interface{} {
+	ds := state.(*DirectorState)
+	ds.Watchers = append(ds.Watchers, presences...)
+	if ds.Tournament.Arena != nil {
+		if err := sendEncoded(dispatcher, ds.Encodings, OpCodeArenaStandings, newArenaStandingsMessage(ds.Tournament), presences); err != nil {
+			logger.Error("Failed to send arena standings: %v", err)
+		}
+	}
+	return state
+}
+
+// MatchLeave forgets watchers who left
+func (td *TournamentDirector) MatchLeave(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, presences []runtime.Presence) interface{} {
+	ds := state.(*DirectorState)
+	for _, presence := range presences {
+		delete(ds.Encodings, presence.GetSessionId())
+		ds.Watchers = slices.DeleteFunc(ds.Watchers, func(p runtime.Presence) bool {
+			return p.GetSessionId() == presence.GetSessionId()
+		})
+	}
+	return state
+}
+
+// MatchLoop closes signup when it is due and lets the format pair the next games.
+// Once nothing is left to play the director stops, the end of the tournament starts it again to pay rewards.
+func (td *TournamentDirector) MatchLoop(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, messages []runtime.MatchData) interface{} {
+	ds := state.(*DirectorState)
+	d := td.context(ctx, logger, nk, dispatcher, ds)
+	t := ds.Tournament
+
+	switch t.Status {
+	case TournamentSignup:
+		if d.now >= t.SignupEndsAt {
+			td.startTournament(d)
+		}
+	case TournamentRunning:
+		t.pairing().tick(d)
+	}
+	if t.Arena != nil && t.Arena.EndPending && t.Status == TournamentFinished {
+		td.end(d, ds)
+	}
+	played := ds.InitialStatus == TournamentSignup || ds.InitialStatus == TournamentRunning
+	if played && (t.Status == TournamentFinished || t.Status == TournamentCancelled) {
+		logger.Info("Director of tournament %s stopping until the event ends", t.Id)
+		ds.Done = true
+	}
+
+	if !td.persist(d, ds) || ds.Done {
+		return nil
+	}
+	return ds
+}
+
+// startTournament closes signup and pairs the first games, or calls the event off if too few joined
+func (td *TournamentDirector) startTournament(d *directorContext) {
+	t := d.state
+	d.changed()
+	// An arena opens however few signed up, players may still join while it runs
+	if len(t.Entrants) < 2 && t.Format != FormatArena {
+		t.Status = TournamentCancelled
+		for _, e := range t.Entrants {
+			d.notify(e.UserId, "Tournament cancelled", notificationTournamentCancelled, map[string]interface{}{
+				"tournament_id": t.Id,
+				"reason":        "not_enough_players",
+			})
+		}
+		d.logger.Info("Tournament %s cancelled with %d entrants", t.Id, len(t.Entrants))
+		return
+	}
+
+	if err := t.pairing().start(d); err != nil {
+		d.logger.Error("Failed to start tournament %s: %v", t.Id, err)
+		return
+	}
+	t.Status = TournamentRunning
+	d.logger.Info("=== TOURNAMENT STARTED === %s with %d entrants", t.Id, len(t.Entrants))
+	t.pairing().tick(d)
+}
+
+// MatchTerminate saves the tournament before the server stops
+func (td *TournamentDirector) MatchTerminate(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, graceSeconds int) interface{} {
+	ds := state.(*DirectorState)
+	d := td.context(ctx, logger, nk, dispatcher, ds)
+	d.changed()
+	td.persist(d, ds)
+	return ds
+}
+
+// MatchSignal handles joins, game results and the end of the tournament
+func (td *TournamentDirector) MatchSignal(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, data string) (interface{}, string) {
+	ds := state.(*DirectorState)
+	d := td.context(ctx, logger, nk, dispatcher, ds)
+	t := ds.Tournament
+
+	reply := func(errMessage string) (interface{}, string) {
+		td.persist(d, ds)
+		replyBytes, _ := json.Marshal(&tournamentSignalReply{Error: errMessage})
+		return ds, string(replyBytes)
+	}
+
+	var signal TournamentSignal
+	if err := json.Unmarshal([]byte(data), &signal); err != nil {
+		return reply("invalid signal")
+	}
+
+	switch signal.Type {
+	case "join":
+		return reply(td.join(d, signal.UserId, signal.Username))
+
+	case "result":
+		if signal.Record == nil || signal.Record.Tournament == nil || signal.Record.Tournament.Id != t.Id {
+			return reply("result is not from this tournament")
+		}
+		if t.Status == TournamentRunning {
+			t.pairing().result(d, signal.Record)
+			t.pairing().tick(d)
+		}
+		return reply("")
+
+	case "end":
+		if t.Status == TournamentRunning && t.Arena != nil && len(t.Arena.Active) > 0 {
+			// Games paired before the arena closed still count, the rewards wait for the last of them
+			t.Arena.EndPending = true
+			d.changed()
+			logger.Info("Tournament %s ended with %d arena games in progress, waiting for them", t.Id, len(t.Arena.Active))
+			return reply("")
+		}
+		td.end(d, ds)
+		return reply("")
+
+	case "shutdown":
+		d.changed()
+		return reply("")
+	}
+	return reply("unknown signal")
+}
+
+// end pays the rewards and closes the tournament for good
+func (td *TournamentDirector) end(d *directorContext, ds *DirectorState) {
+	t := d.state
+	if t.Status == TournamentSignup {
+		t.Status = TournamentCancelled
+	}
+	d.payRewards()
+	t.Status = TournamentEnded
+	d.changed()
+	ds.Done = true
+}
+
+// join signs a player up, returning why they may not join if they cannot
+func (td *TournamentDirector) join(d *directorContext, userId, username string) string {
+	t := d.state
+	if t.Format == FormatArena && t.Status == TournamentRunning {
+		return td.joinArena(d, userId, username)
+	}
+	switch {
+	case t.Status != TournamentSignup || d.now >= t.SignupEndsAt:
+		return "signup is closed"
+	case t.entrant(userId) != nil:
+		return "already joined"
+	case len(t.Entrants) >= t.MaxSize:
+		return "tournament is full"
+	}
+
+	if err := d.nk.TournamentJoin(d.ctx, t.Id, userId, username); err != nil {
+		d.logger.Error("TournamentJoin error: %v", err)
+		return "could not join tournament"
+	}
+	t.Entrants = append(t.Entrants, &TournamentEntrant{
+		UserId:   userId,
+		Username: username,
+		Rating:   lookupRating(d.ctx, d.logger, d.nk, t.Mode, userId),
+	})
+	d.changed()
+	d.logger.Info("Player %s joined tournament %s (%d entrants)", userId, t.Id, len(t.Entrants))
+	return ""
+}
+
+// joinArena lets a player into an arena that is running, or queues an entrant who missed a game again
+func (td *TournamentDirector) joinArena(d *directorContext, userId, username string) string {
+	t := d.state
+	if d.now >= t.Arena.ClosesAt {
+		return "arena is closed"
+	}
+	if t.entrant(userId) != nil {
+		if p := t.Arena.player(userId); p != nil && !p.Paused {
+			return "already joined"
+		}
+		return t.Arena.enqueue(d, userId)
+	}
+	if len(t.Entrants) >= t.MaxSize {
+		return "tournament is full"
+	}
+
+	if err := d.nk.TournamentJoin(d.ctx, t.Id, userId, username); err != nil {
+		d.logger.Error("TournamentJoin error: %v", err)
+		return "could not join tournament"
+	}
+	t.Entrants = append(t.Entrants, &TournamentEntrant{
+		UserId:   userId,
+		Username: username,
+		Rating:   lookupRating(d.ctx, d.logger, d.nk, t.Mode, userId),
+	})
+	d.logger.Info("Player %s joined arena %s (%d entrants)", userId, t.Id, len(t.Entrants))
+	return t.Arena.enqueue(d, userId)
+}
+
+// context builds the directorContext of one tick or signal
+func (td *TournamentDirector) context(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, ds *DirectorState) *directorContext {
+	return &directorContext{ctx: ctx, logger: logger, nk: nk, state: ds.Tournament, now: td.clock.Now().Unix(), dispatcher: dispatcher}
+}
+
+// persist writes the tournament if it changed, reporting false if another director has taken it over
+func (td *TournamentDirector) persist(d *directorContext, ds *DirectorState) bool {
+	if !d.dirty {
+		return true
+	}
+	ds.Tournament.UpdatedAt = d.now
+	version, err := writeTournament(d.ctx, d.nk, ds.Tournament, ds.Version)
+	if err != nil {
+		d.logger.Error("Failed to save tournament %s, stopping director: %v", ds.Tournament.Id, err)
+		return false
+	}
+	ds.Version = version
+	d.dirty = false
+
+	if ds.Tournament.Arena != nil && d.dispatcher != nil && len(ds.Watchers) > 0 {
+		if err := sendEncoded(d.dispatcher, ds.Encodings, OpCodeArenaStandings, newArenaStandingsMessage(ds.Tournament), ds.Watchers); err != nil {
+			d.logger.Error("Failed to broadcast arena standings: %v", err)
+		}
+	}
+	return true
+}